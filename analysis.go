@@ -0,0 +1,498 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/AustralianCyberSecurityCentre/azul-bedrock/v10/gosrc/events"
+	"github.com/AustralianCyberSecurityCentre/azul-bedrock/v10/gosrc/plugin"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/encoded"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/entropy"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/render"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/secrets"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/sections"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/xor"
+)
+
+// Source of the content of a binary, implemented by plugin jobs and by files for the cli.
+type ContentSource interface {
+	// Get the bytes from startChunk to endChunk (inclusive) and whether the end of the content was reached.
+	GetContentChunk(startChunk uint64, endChunk uint64) ([]byte, bool, *plugin.PluginError)
+}
+
+// Feature produced by an analysis.
+type analysisFeature struct {
+	Name   string `json:"name"`
+	Value  any    `json:"value"`
+	Label  string `json:"label,omitempty"`
+	Offset uint64 `json:"offset,omitempty"`
+	Size   uint64 `json:"size,omitempty"`
+}
+
+// Rendered output produced by an analysis.
+type analysisStream struct {
+	// Name of the output including its file extension, used when the cli writes streams to disk.
+	Name  string
+	Label events.DatastreamLabel
+	Data  []byte
+}
+
+// Everything produced by analysing a binary, published to the job by the plugin or printed by the cli.
+type analysisResult struct {
+	// Size of the binary, counted as it is read when analysed with unknownSize.
+	Size uint64
+	Info EventInfoEntropy
+	// Type of the binary detected from its content, see detectFileType.
+	FileType string
+	// Chi-square statistic of the byte histogram, see entropy.ChiSquare.
+	ChiSquare float64
+	Features  []analysisFeature
+	Streams   []analysisStream
+	// Time spent fetching and analysing the content, not published as it differs between runs.
+	Metrics fetchMetrics
+	// Names of features that aren't added, see EntropySettings.DisabledFeatures.
+	disabledFeatures map[string]bool
+}
+
+func (ar *analysisResult) addFeature(name string, value any, options *plugin.AddFeatureOptions) {
+	if ar.disabledFeatures[name] {
+		return
+	}
+	feature := analysisFeature{Name: name, Value: value}
+	if options != nil {
+		feature.Label, feature.Offset, feature.Size = options.Label, options.Offset, options.Size
+	}
+	ar.Features = append(ar.Features, feature)
+}
+
+// Mark the result as cut short by the time budget after analysedBytes bytes of content.
+func (ar *analysisResult) truncate(config *EntropySettings, analysedBytes uint64) {
+	ar.Info.Truncated = &EventInfoTruncated{
+		AnalysedBytes: analysedBytes,
+		Reason:        fmt.Sprintf("time budget of %v ran out", config.TimeBudget),
+	}
+	ar.addFeature("entropy_truncated", analysedBytes, nil)
+}
+
+// Context the content of a binary is analysed within, done when ctx is or when the time budget runs out.
+func (s *EntropySettings) budgetContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.TimeBudget > 0 {
+		return context.WithTimeout(ctx, s.TimeBudget)
+	}
+	return context.WithCancel(ctx)
+}
+
+// Error for an analysis stopped by its context, rather than by the time budget.
+func cancelledError(err error) *plugin.PluginError {
+	return plugin.NewPluginError(plugin.ErrorTimeout, "Analysis cancelled", "the analysis was cancelled before it finished").WithCausalError(err)
+}
+
+// Blocks entirely within the bytes analysed, when the analysis stopped before the end of the binary.
+func analysedBlocks(blocks []float64, blockSize int, analysed uint64) []float64 {
+	return blocks[:min(len(blocks), int(analysed/uint64(max(blockSize, 1))))]
+}
+
+// Size of content of unknown length, such as stdin, which is read once in order.
+const unknownSize = math.MaxUint64
+
+// Run every enabled analysis over the content of a binary of the given size, also analysing the ranges of interest on
+// their own. The analysis stops with an error when ctx is done. When the time budget runs out the results of the bytes
+// analysed so far are returned, marked as truncated.
+// Content of unknownSize is read once in order, so is never sampled or analysed by its ranges only.
+func analyse(ctx context.Context, config *EntropySettings, size uint64, source ContentSource, interest []byteRange) (*analysisResult, *plugin.PluginError) {
+	streaming := size == unknownSize
+	if !streaming && config.rangesOnly(size) {
+		return analyseRangesOnly(ctx, config, size, source, interest)
+	}
+	if !streaming && config.sampling(size) {
+		return analyseSampled(ctx, config, size, source, interest)
+	}
+	var err error
+	resolutionBlocks, err := config.resolutionBlocks()
+	if err != nil {
+		return nil, plugin.NewPluginError(plugin.ErrorException, "Invalid resolution settings", "could not parse the resolution block counts").WithCausalError(err)
+	}
+	// The other resolutions are calculated from the same bytes as the blocks.
+	blockCounts := append([]int{config.Blocks}, resolutionBlocks...)
+	var bufferedEntropy *entropy.EntropyBuffered
+	if streaming {
+		// Blocks are merged as the content is read, so their size is the minimum block size times a power of two.
+		bufferedEntropy = entropy.NewStreaming(config.MinBlockSize, blockCounts...)
+	} else {
+		bufferedEntropy = entropy.NewBufferedResolutions(size, config.MinBlockSize, blockCounts...)
+	}
+	if config.Workers > 0 {
+		bufferedEntropy.SetWorkers(config.Workers)
+	}
+	var stringScanner *secrets.Scanner
+	if config.StringsEnabled {
+		stringScanner = secrets.NewScanner(secrets.Options{
+			MinLength:     config.StringsMinLength,
+			MaxLength:     config.StringsMaxLength,
+			MinEntropy:    config.StringsMinEntropy,
+			MaxCandidates: config.StringsMaxCandidates,
+		})
+	}
+	var blobScanner *encoded.Scanner
+	if config.EncodedEnabled {
+		blobScanner = encoded.NewScanner(encoded.Options{
+			MinLength: config.EncodedMinLength,
+			MaxBlobs:  config.EncodedMaxBlobs,
+		})
+	}
+	var digraph *entropy.DigraphBuffered
+	if config.DigraphEnabled {
+		digraph = entropy.NewDigraphBuffered()
+	}
+	var xorScanner *xor.Scanner
+	if config.XorEnabled {
+		xorScanner = xor.NewScanner(xor.Options{
+			WindowSize:     config.XorWindowSize,
+			MinEntropy:     config.XorMinEntropy,
+			MaxEntropy:     config.XorMaxEntropy,
+			MaxWindows:     config.XorMaxWindows,
+			MaxKeyLength:   config.XorMaxKeyLength,
+			MinEntropyDrop: config.XorMinEntropyDrop,
+			MaxCandidates:  config.XorMaxCandidates,
+		})
+	}
+	// The range index and hilbert map are laid out over the length of the binary, so aren't made without it.
+	var rangeIndex *entropy.RangeIndex
+	if config.RangeIndexEnabled && !streaming {
+		rangeIndex = entropy.NewRangeIndex(size, config.RangeIndexGranules, config.RangeIndexMinGranuleSize)
+	}
+	var hilbertMap *render.HilbertMap
+	if config.HilbertEnabled && !streaming {
+		hilbertMap, err = render.NewHilbertMap(size, render.HilbertOptions{
+			Size: config.HilbertSize,
+			Mode: render.HilbertMode(config.HilbertMode),
+		})
+		if err != nil {
+			return nil, plugin.NewPluginError(plugin.ErrorException, "Invalid hilbert settings", "could not create the hilbert map").WithCausalError(err)
+		}
+	}
+
+	contentReader := newContentReader(source, size)
+	if streaming {
+		contentReader.keepTail(uint64(config.TailSize))
+	} else if ranges := config.headTailRanges(size); len(ranges) > 0 && ranges[len(ranges)-1].Label == "tail" {
+		contentReader.keepTail(ranges[len(ranges)-1].Size)
+	}
+
+	// The next chunk is fetched while the current chunk is analysed.
+	fetcher := newChunkFetcher(source, uint64(config.FetchChunkSize), config.PrefetchDepth, uint64(config.PrefetchMaxBytes))
+	defer fetcher.Close()
+	var metrics fetchMetrics
+	started := time.Now()
+	budget, cancel := config.budgetContext(ctx)
+	defer cancel()
+
+	endOfFile := false
+	truncated := false
+	startChunk := uint64(0)
+	// Calculate entropy
+	for !endOfFile {
+		waited := time.Now()
+		// Checked between chunks, so the analysis stops within the time taken to analyse one chunk.
+		chunk, err := fetcher.Next(budget)
+		metrics.Wait += time.Since(waited)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, cancelledError(ctx.Err())
+			}
+			truncated = true
+			break
+		}
+		metrics.Fetch += chunk.duration
+		if chunk.pluginErr != nil {
+			return nil, chunk.pluginErr
+		}
+		analysed := time.Now()
+		rawChunk := chunk.data
+		endOfFile = chunk.endOfFile
+		if startChunk == 0 {
+			contentReader.setHead(rawChunk)
+		}
+		contentReader.appendChunk(rawChunk)
+		bufferedEntropy.AppendAndCalculateBufferedValues(rawChunk)
+		if digraph != nil {
+			digraph.AppendAndCount(rawChunk)
+		}
+		if rangeIndex != nil {
+			rangeIndex.AppendAndCount(rawChunk)
+		}
+		if stringScanner != nil {
+			stringScanner.Append(rawChunk)
+		}
+		if blobScanner != nil {
+			blobScanner.Append(rawChunk)
+		}
+		if xorScanner != nil {
+			xorScanner.Append(rawChunk)
+		}
+		if hilbertMap != nil {
+			hilbertMap.Append(rawChunk)
+		}
+		startChunk += uint64(len(rawChunk))
+		metrics.Chunks++
+		metrics.Analysis += time.Since(analysed)
+	}
+	metrics.Elapsed = time.Since(started)
+	if streaming {
+		// The content can't be read again, so only its head and tail are available to the sections and ranges.
+		size = startChunk
+		contentReader.size = size
+		contentReader.source = nil
+	}
+
+	entChunks, entSize, entCount := bufferedEntropy.GetChunkEntropySizeAndCount()
+	var overall float64
+	if truncated {
+		overall = bufferedEntropy.PartialValue()
+		entChunks = analysedBlocks(entChunks, entSize, startChunk)
+		entCount = len(entChunks)
+	} else {
+		overall, err = bufferedEntropy.TotalValue()
+		if err != nil {
+			return nil, plugin.NewPluginError(plugin.ErrorException, "TotalValue error", "TotalValue error").WithCausalError(err)
+		}
+	}
+
+	result := &analysisResult{Size: size, Metrics: metrics, disabledFeatures: config.disabledFeatures()}
+	result.Info = EventInfoEntropy{
+		Overall:    overall,
+		Blocks:     entChunks,
+		BlockSize:  entSize,
+		BlockCount: entCount,
+	}
+	entropyInfo := &result.Info
+	for _, resolution := range bufferedEntropy.Resolutions()[1:] {
+		blocks := resolution.Entropies
+		if truncated {
+			blocks = analysedBlocks(blocks, resolution.Size, startChunk)
+		}
+		entropyInfo.Resolutions = append(entropyInfo.Resolutions, EventInfoResolution{
+			MaxBlocks:  resolution.MaxCount,
+			BlockSize:  resolution.Size,
+			BlockCount: len(blocks),
+			Blocks:     blocks,
+		})
+	}
+	result.addFeature("entropy", overall, nil)
+	if truncated {
+		result.truncate(config, startChunk)
+	}
+	if stringScanner != nil {
+		for _, candidate := range stringScanner.Candidates() {
+			entropyInfo.Strings = append(entropyInfo.Strings, EventInfoString{
+				Offset:            candidate.Offset,
+				Size:              candidate.Size,
+				Value:             candidate.Value,
+				Encoding:          string(candidate.Encoding),
+				Charset:           string(candidate.Charset),
+				Entropy:           candidate.Entropy,
+				NormalisedEntropy: candidate.NormalisedEntropy,
+			})
+			result.addFeature("high_entropy_string", candidate.Value, &plugin.AddFeatureOptions{
+				Label:  string(candidate.Charset),
+				Offset: candidate.Offset,
+				Size:   candidate.Size,
+			})
+		}
+	}
+	if blobScanner != nil {
+		for _, blob := range blobScanner.Blobs() {
+			entropyInfo.Encoded = append(entropyInfo.Encoded, EventInfoEncoded{
+				Offset:         blob.Offset,
+				Size:           blob.Size,
+				Encoding:       string(blob.Encoding),
+				DecodedLength:  blob.DecodedLength,
+				DecodedEntropy: blob.DecodedEntropy,
+			})
+			options := &plugin.AddFeatureOptions{Offset: blob.Offset, Size: blob.Size}
+			result.addFeature("encoded_blob", string(blob.Encoding), options)
+			if blob.DecodedEntropy >= config.EncodedHighEntropy {
+				result.addFeature("encoded_high_entropy_blob", string(blob.Encoding), options)
+			}
+		}
+	}
+	if xorScanner != nil {
+		for _, key := range xorScanner.Candidates() {
+			entropyInfo.Xor = append(entropyInfo.Xor, EventInfoXor{
+				Offset:         key.Offset,
+				Key:            hex.EncodeToString(key.Key),
+				KeyLength:      len(key.Key),
+				Magic:          key.Magic,
+				Count:          key.Count,
+				Entropy:        key.Entropy,
+				DecodedEntropy: key.DecodedEntropy,
+			})
+			result.addFeature("xor_key", hex.EncodeToString(key.Key), &plugin.AddFeatureOptions{
+				Label:  key.Magic,
+				Offset: key.Offset,
+			})
+			if key.Magic != "" {
+				result.addFeature("xor_encoded_format", key.Magic, &plugin.AddFeatureOptions{Offset: key.Offset})
+			}
+		}
+	}
+	if digraph != nil {
+		digraphStats := digraph.Stats()
+		matrix, err := compressMatrix(digraph.Quantised())
+		if err != nil {
+			return nil, plugin.NewPluginError(plugin.ErrorException, "Failed to compress digraph", "could not compress the digraph matrix").WithCausalError(err)
+		}
+		entropyInfo.Digraph = &EventInfoDigraph{
+			Matrix:              matrix,
+			MaxCount:            digraph.MaxCount(),
+			Total:               digraph.Total(),
+			NullTransitionRatio: digraphStats.NullTransitionRatio,
+			RepeatRatio:         digraphStats.RepeatRatio,
+			PrintableRatio:      digraphStats.PrintableRatio,
+			DistinctRatio:       digraphStats.DistinctRatio,
+		}
+		result.addFeature("digraph_null_transition_ratio", digraphStats.NullTransitionRatio, nil)
+		result.addFeature("digraph_repeat_ratio", digraphStats.RepeatRatio, nil)
+		result.addFeature("digraph_printable_ratio", digraphStats.PrintableRatio, nil)
+		result.addFeature("digraph_distinct_ratio", digraphStats.DistinctRatio, nil)
+	}
+	if config.SignatureEnabled {
+		entropyInfo.Signature = entropy.Signature(entChunks)
+		// Binaries too small for a block have no shape to match.
+		if entropyInfo.Signature != "" {
+			result.addFeature("entropy_signature", entropyInfo.Signature, nil)
+		}
+	}
+	if rangeIndex != nil {
+		index, err := rangeIndex.MarshalBinary()
+		if err != nil {
+			return nil, plugin.NewPluginError(plugin.ErrorException, "Failed to serialise range index", "could not serialise the range index").WithCausalError(err)
+		}
+		entropyInfo.RangeIndex = &EventInfoRangeIndex{GranuleSize: rangeIndex.GranuleSize(), Granules: rangeIndex.Granules()}
+		// The index holds byte counts rather than content from the binary.
+		result.Streams = append(result.Streams, analysisStream{Name: "range_index.bin", Label: events.DataLabelReport, Data: index})
+	}
+	if config.HistogramEnabled {
+		entropyInfo.Histogram = histogramInfo(bufferedEntropy.Histogram(), config.HistogramTopBytes)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, cancelledError(err)
+	}
+	// Parsing the sections and the ranges may fetch more content, which the time budget doesn't allow for once it has
+	// run out. The entropy of the sections is a feature of the classifier.
+	if (config.SectionsEnabled || config.ClassifierEnabled) && !truncated {
+		pluginErr := sectionsInfo(entropyInfo, contentReader)
+		if pluginErr != nil {
+			return nil, pluginErr
+		}
+	}
+	if !truncated {
+		_, pluginErr := addRanges(ctx, result, config, contentReader, size, interest)
+		if pluginErr != nil {
+			return nil, pluginErr
+		}
+	}
+	result.FileType = detectFileType(entropyInfo.Format, contentReader.head)
+	result.ChiSquare = entropy.ChiSquare(bufferedEntropy.Histogram())
+	if config.ClassifierEnabled {
+		model, err := loadClassifier(config.ClassifierPath)
+		if err != nil {
+			return nil, plugin.NewPluginError(plugin.ErrorException, "Failed to load classifier", "could not load the classifier model").WithCausalError(err)
+		}
+		prediction := model.Predict(classifierFeatures(entropyInfo, size, result.ChiSquare, config.bands()))
+		entropyInfo.Classification = &EventInfoClassification{
+			Class:         prediction.Class,
+			Probability:   prediction.Probability,
+			Probabilities: prediction.Probabilities,
+		}
+		result.addFeature("entropy_class", prediction.Class, nil)
+		result.addFeature("entropy_class_probability", prediction.Probability, &plugin.AddFeatureOptions{Label: prediction.Class})
+	}
+
+	if config.GraphEnabled {
+		graph, err := render.EntropyGraph(entChunks, render.GraphOptions{Width: config.GraphWidth, Height: config.GraphHeight, Bands: config.bands()})
+		if err != nil {
+			return nil, plugin.NewPluginError(plugin.ErrorException, "Failed to render graph", "could not render the entropy graph").WithCausalError(err)
+		}
+		// safe_png is the only image label, the graph is rendered by the plugin so holds nothing from the binary.
+		result.Streams = append(result.Streams, analysisStream{Name: "graph.png", Label: events.DataLabelSafePng, Data: graph})
+	}
+	if config.ChartsEnabled {
+		profile := profileFromInfo(entropyInfo, size, config.bands())
+		chartOptions := render.ChartOptions{Width: config.ChartWidth, Height: config.ChartHeight, Bands: config.bands()}
+		result.Streams = append(result.Streams, analysisStream{Name: "chart.svg", Label: events.DataLabelReport, Data: render.EntropySVG(profile, chartOptions)})
+		spec, err := render.EntropyVegaLite(profile, chartOptions)
+		if err != nil {
+			return nil, plugin.NewPluginError(plugin.ErrorException, "Failed to build vega-lite chart", "could not build the vega-lite spec").WithCausalError(err)
+		}
+		result.Streams = append(result.Streams, analysisStream{Name: "chart.vl.json", Label: events.DataLabelReport, Data: spec})
+	}
+	if hilbertMap != nil {
+		hilbert, err := hilbertMap.PNG()
+		if err != nil {
+			return nil, plugin.NewPluginError(plugin.ErrorException, "Failed to render hilbert map", "could not render the hilbert map").WithCausalError(err)
+		}
+		result.Streams = append(result.Streams, analysisStream{Name: "hilbert.png", Label: events.DataLabelSafePng, Data: hilbert})
+	}
+	return result, nil
+}
+
+// Summarise the byte histogram for the info.
+func histogramInfo(counts [256]int, topBytes int) *EventInfoHistogram {
+	histogramStats := entropy.CalculateHistogramStats(counts, topBytes)
+	histogram := &EventInfoHistogram{
+		Normalised:     histogramStats.Normalised[:],
+		DistinctBytes:  histogramStats.DistinctBytes,
+		MostFrequent:   []EventInfoByteFrequency{},
+		PrintableRatio: histogramStats.PrintableRatio,
+		ZeroRatio:      histogramStats.ZeroRatio,
+		ChiSquare:      histogramStats.ChiSquare,
+	}
+	for _, frequency := range histogramStats.MostFrequent {
+		histogram.MostFrequent = append(histogram.MostFrequent, EventInfoByteFrequency{
+			Byte:  frequency.Byte,
+			Ratio: frequency.Ratio,
+		})
+	}
+	return histogram
+}
+
+// Parse the sections of the binary into the info. Malformed headers are common in malware, so the binary is still
+// profiled without its sections when they can't be parsed, only failing to download the headers is an error.
+func sectionsInfo(entropyInfo *EventInfoEntropy, contentReader *contentReader) *plugin.PluginError {
+	format, fileSections, err := sections.Parse(contentReader)
+	var downloadErr *plugin.PluginError
+	if errors.As(err, &downloadErr) {
+		return downloadErr
+	}
+	if err != nil {
+		format, fileSections = "", nil
+	}
+	entropyInfo.Format = string(format)
+	for _, section := range fileSections {
+		entropyInfo.Sections = append(entropyInfo.Sections, EventInfoSection{
+			Name:   section.Name,
+			Offset: section.Offset,
+			Size:   section.Size,
+		})
+	}
+	return nil
+}
+
+// Profile of the blocks, regions classified into the bands and sections of a binary for rendering.
+func profileFromInfo(info *EventInfoEntropy, size uint64, bands []render.Band) render.Profile {
+	profile := render.Profile{
+		Blocks:    info.Blocks,
+		BlockSize: uint64(info.BlockSize),
+		Size:      size,
+		Regions:   render.ClassifyRegions(info.Blocks, uint64(info.BlockSize), bands),
+	}
+	for _, section := range info.Sections {
+		profile.Sections = append(profile.Sections, render.Region{Label: section.Name, Offset: section.Offset, Size: section.Size})
+	}
+	return profile
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/AustralianCyberSecurityCentre/azul-bedrock/v10/gosrc/plugin"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/baseline"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/render"
+)
+
+// Detect the type of a binary from its executable format, or by sniffing its mime type from the start of its content.
+func detectFileType(format string, head []byte) string {
+	if format != "" {
+		return format
+	}
+	mimeType, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	return mimeType
+}
+
+// Metrics of a binary compared against the baseline of its type: the overall entropy, statistics of the block
+// entropies, and the ratio of blocks in each of the bands (the region mix).
+func entropyMetrics(info *EventInfoEntropy, bands []render.Band) baseline.Metrics {
+	metrics := baseline.Metrics{"overall": info.Overall}
+	if len(info.Blocks) == 0 {
+		return metrics
+	}
+	var sum, maximum float64
+	counts := map[string]int{}
+	for _, value := range info.Blocks {
+		sum += value
+		maximum = max(maximum, value)
+		counts[render.Classify(value, bands)]++
+	}
+	mean := sum / float64(len(info.Blocks))
+	var squares float64
+	for _, value := range info.Blocks {
+		squares += (value - mean) * (value - mean)
+	}
+	metrics["block_mean"] = mean
+	metrics["block_std"] = math.Sqrt(squares / float64(len(info.Blocks)))
+	metrics["block_max"] = maximum
+	for _, band := range bands {
+		metrics["region_"+band.Label] = float64(counts[band.Label]) / float64(len(info.Blocks))
+	}
+	return metrics
+}
+
+// Score the binary against the baseline of its declared type, or its detected type if the model hasn't learnt the
+// declared type, publishing the score in the info and as a feature labelled with the type.
+func (ep *EntropyPlugin) scoreAnomaly(declaredType string, result *analysisResult) {
+	fileType := declaredType
+	if !ep.baseline.Has(fileType) {
+		fileType = result.FileType
+	}
+	score, ok := ep.baseline.Score(fileType, entropyMetrics(&result.Info, ep.getSettings().bands()))
+	if !ok {
+		return
+	}
+	result.Info.Anomaly = &EventInfoAnomaly{Type: score.Type, Score: score.Score, ZScores: score.ZScores}
+	result.addFeature("entropy_anomaly", score.Score, &plugin.AddFeatureOptions{Label: score.Type})
+}
@@ -0,0 +1,173 @@
+/*
+Baseline distributions of entropy metrics for each file type, learnt from a corpus, to score how unusual a file is for
+its type. An entropy of 7.2 is normal for a JPEG and alarming for a text file.
+
+The model keeps a running mean and variance of each metric (Welford's algorithm), so a model can be trained further
+on more files without the original corpus.
+*/
+package baseline
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Version of the model file format.
+const modelVersion = 1
+
+// Minimum number of files of a type before files are scored against it.
+const MinSamples = 2
+
+// Smallest standard deviation used for scoring, so a metric that never varied in training doesn't give infinite scores.
+const minStdDev = 0.05
+
+// Named values measured from a file, such as its overall entropy.
+type Metrics map[string]float64
+
+// Running distribution of a metric.
+type Stats struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	// Sum of squared differences from the mean.
+	M2 float64 `json:"m2"`
+}
+
+func (s *Stats) add(value float64) {
+	s.Count++
+	delta := value - s.Mean
+	s.Mean += delta / float64(s.Count)
+	s.M2 += delta * (value - s.Mean)
+}
+
+// Sample standard deviation of the values added.
+func (s *Stats) StdDev() float64 {
+	if s.Count < 2 {
+		return 0
+	}
+	return math.Sqrt(s.M2 / float64(s.Count-1))
+}
+
+// Distributions of each metric for a file type.
+type TypeBaseline struct {
+	// Number of files of the type learnt from.
+	Count   int               `json:"count"`
+	Metrics map[string]*Stats `json:"metrics"`
+}
+
+type Model struct {
+	Version int                      `json:"version"`
+	Types   map[string]*TypeBaseline `json:"types"`
+}
+
+// How unusual a file is compared with the baseline of its type.
+type Score struct {
+	Type string
+	// Largest absolute z-score of the metrics.
+	Score float64
+	// Number of standard deviations each metric is from the mean of the type.
+	ZScores map[string]float64
+}
+
+func NewModel() *Model {
+	return &Model{Version: modelVersion, Types: map[string]*TypeBaseline{}}
+}
+
+// Load a model saved with Save.
+func Load(path string) (*Model, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	model := NewModel()
+	err = json.Unmarshal(content, model)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if model.Version != modelVersion {
+		return nil, fmt.Errorf("%s: unsupported model version %d", path, model.Version)
+	}
+	return model, nil
+}
+
+// Save the model as JSON, replacing the file only once the whole model is written.
+func (m *Model) Save(path string) error {
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	_, err = temp.Write(content)
+	if err != nil {
+		temp.Close()
+		return err
+	}
+	err = temp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// Learn the metrics of a file of the given type.
+func (m *Model) Add(fileType string, metrics Metrics) {
+	baseline, ok := m.Types[fileType]
+	if !ok {
+		baseline = &TypeBaseline{Metrics: map[string]*Stats{}}
+		m.Types[fileType] = baseline
+	}
+	baseline.Count++
+	for name, value := range metrics {
+		stats, ok := baseline.Metrics[name]
+		if !ok {
+			stats = &Stats{}
+			baseline.Metrics[name] = stats
+		}
+		stats.add(value)
+	}
+}
+
+// Whether the model has learnt enough files of the type to score against it.
+func (m *Model) Has(fileType string) bool {
+	baseline, ok := m.Types[fileType]
+	return ok && baseline.Count >= MinSamples
+}
+
+// Sorted names of the types the model has learnt enough files of to score against.
+func (m *Model) KnownTypes() []string {
+	result := []string{}
+	for fileType := range m.Types {
+		if m.Has(fileType) {
+			result = append(result, fileType)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Score the metrics of a file against the baseline of its type, false if the type hasn't been learnt.
+// Metrics missing from the baseline are ignored.
+func (m *Model) Score(fileType string, metrics Metrics) (Score, bool) {
+	if !m.Has(fileType) {
+		return Score{}, false
+	}
+	baseline := m.Types[fileType]
+	result := Score{Type: fileType, ZScores: map[string]float64{}}
+	for name, value := range metrics {
+		stats, ok := baseline.Metrics[name]
+		if !ok || stats.Count < MinSamples {
+			continue
+		}
+		z := (value - stats.Mean) / max(stats.StdDev(), minStdDev)
+		result.ZScores[name] = z
+		result.Score = max(result.Score, math.Abs(z))
+	}
+	return result, true
+}
@@ -0,0 +1,84 @@
+package baseline
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func trainedModel() *Model {
+	model := NewModel()
+	for _, value := range []float64{7.8, 7.9, 8.0} {
+		model.Add("image/jpeg", Metrics{"overall": value})
+	}
+	for _, value := range []float64{4.0, 4.5, 5.0} {
+		model.Add("text/plain", Metrics{"overall": value, "constant": 1})
+	}
+	model.Add("rare", Metrics{"overall": 1})
+	return model
+}
+
+func TestStats(t *testing.T) {
+	stats := &Stats{}
+	for _, value := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		stats.add(value)
+	}
+	if stats.Mean != 5 || math.Abs(stats.StdDev()-math.Sqrt(32.0/7)) > 1e-9 {
+		t.Errorf("Unexpected stats, got: %+v %v", stats, stats.StdDev())
+	}
+}
+
+func TestScore(t *testing.T) {
+	model := trainedModel()
+	// The same entropy is normal for one type and unusual for another.
+	jpeg, ok := model.Score("image/jpeg", Metrics{"overall": 7.9})
+	if !ok || jpeg.Score > 1e-9 {
+		t.Errorf("Unexpected jpeg score, got: %+v", jpeg)
+	}
+	text, ok := model.Score("text/plain", Metrics{"overall": 7.9, "constant": 1, "unknown": 3})
+	if !ok || math.Abs(text.Score-6.8) > 1e-9 || !reflect.DeepEqual(text.ZScores, map[string]float64{"overall": text.Score, "constant": 0}) {
+		t.Errorf("Unexpected text score, got: %+v", text)
+	}
+	// A metric that never varied uses the minimum deviation.
+	text, _ = model.Score("text/plain", Metrics{"constant": 1.1})
+	if math.Abs(text.Score-2) > 1e-9 {
+		t.Errorf("Unexpected constant score, got: %+v", text)
+	}
+	if _, ok := model.Score("rare", Metrics{"overall": 1}); ok {
+		t.Errorf("Expected types with too few files not to be scored")
+	}
+	if !reflect.DeepEqual(model.KnownTypes(), []string{"image/jpeg", "text/plain"}) {
+		t.Errorf("Unexpected known types, got: %v", model.KnownTypes())
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model.json")
+	model := trainedModel()
+	err := model.Save(path)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if !reflect.DeepEqual(loaded, model) {
+		t.Errorf("Expected the loaded model to match, got: %+v", loaded)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary files left, got: %v", entries)
+	}
+
+	err = os.WriteFile(path, []byte(`{"version": 99}`), 0o644)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	_, err = Load(path)
+	if err == nil {
+		t.Errorf("Expected an error for an unsupported version")
+	}
+}
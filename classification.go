@@ -0,0 +1,59 @@
+package main
+
+import (
+	"math"
+	"sync"
+
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/classifier"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/render"
+)
+
+// Models loaded from each path, so a model is only read once rather than for every binary.
+var classifierModels = struct {
+	sync.Mutex
+	byPath map[string]*classifier.Model
+}{byPath: map[string]*classifier.Model{}}
+
+// Load the classifier model at the path, or the embedded default model if the path is empty.
+func loadClassifier(path string) (*classifier.Model, error) {
+	classifierModels.Lock()
+	defer classifierModels.Unlock()
+	if model, ok := classifierModels.byPath[path]; ok {
+		return model, nil
+	}
+	var model *classifier.Model
+	var err error
+	if path == "" {
+		model = classifier.Default()
+	} else {
+		model, err = classifier.Load(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	classifierModels.byPath[path] = model
+	return model, nil
+}
+
+// Feature vector of a binary for the classifier: the baseline metrics (overall entropy, block statistics and region
+// mix), the chi-square statistic and the entropy of its sections.
+func classifierFeatures(info *EventInfoEntropy, size uint64, chiSquare float64, bands []render.Band) classifier.Features {
+	features := classifier.Features(entropyMetrics(info, bands))
+	// The chi-square statistic of random data has a mean of 255 and a standard deviation of sqrt(510) whatever its
+	// length, so the deviation from it keeps random data near 0 at every size while structured data deviates further.
+	// The log keeps the large deviations of long structured files from swamping the other features.
+	deviation := (chiSquare - 255) / math.Sqrt(510)
+	features["chi_square_deviation"] = math.Copysign(math.Log10(1+math.Abs(deviation)), deviation)
+	features["section_count"] = float64(len(info.Sections))
+	if len(info.Sections) > 0 {
+		profile := compareProfileFromInfo(info, size)
+		lowest, highest := math.Inf(1), math.Inf(-1)
+		for _, section := range info.Sections {
+			value := profile.MeanEntropy(section.Offset, section.Size)
+			lowest, highest = min(lowest, value), max(highest, value)
+		}
+		features["section_entropy_min"] = lowest
+		features["section_entropy_max"] = highest
+	}
+	return features
+}
@@ -0,0 +1,257 @@
+/*
+Lightweight classifier giving a verdict (such as packed, encrypted or benign) from a vector of named entropy features.
+
+The model is multinomial logistic regression over standardised features, stored as JSON so it can be trained and
+shipped without any dependencies. A default model trained on a synthetic corpus is embedded, see Default.
+*/
+package classifier
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// Version of the model file format.
+const modelVersion = 1
+
+// Deviation below which a feature is treated as constant.
+const minStdDev = 1e-9
+
+// Named feature values of a sample, features missing from a sample are zero.
+type Features map[string]float64
+
+// A labelled sample to train from.
+type Sample struct {
+	Class    string
+	Features Features
+}
+
+// Softmax regression over standardised features.
+type Model struct {
+	Version int `json:"version"`
+	// Names of the classes and the features, in the order of the weights.
+	Classes  []string `json:"classes"`
+	Features []string `json:"features"`
+	// Mean and standard deviation of each feature in training, used to standardise features before weighting.
+	Mean   []float64 `json:"mean"`
+	StdDev []float64 `json:"std_dev"`
+	// Weight of each feature for each class, and the bias of each class.
+	Weights [][]float64 `json:"weights"`
+	Bias    []float64   `json:"bias"`
+}
+
+// Predicted class of a sample.
+type Prediction struct {
+	Class       string
+	Probability float64
+	// Probability of every class.
+	Probabilities map[string]float64
+}
+
+// Parameters of gradient descent training.
+type TrainOptions struct {
+	// Number of passes over the samples.
+	Iterations int
+	// Step size of each pass.
+	LearningRate float64
+	// Strength of the L2 penalty keeping weights small.
+	Regularisation float64
+}
+
+var DefaultTrainOptions = TrainOptions{Iterations: 2000, LearningRate: 0.5, Regularisation: 0.001}
+
+//go:embed default_model.json
+var defaultModelJson []byte
+
+// The embedded default model, trained on the synthetic corpus of benign, packed and encrypted files written by
+// classifier/corpus. Train a model on a corpus like the binaries being analysed for better verdicts.
+func Default() *Model {
+	model, err := parse(defaultModelJson)
+	if err != nil {
+		// The embedded model is checked by the tests.
+		panic(err)
+	}
+	return model
+}
+
+// Load a model saved with Save.
+func Load(path string) (*Model, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	model, err := parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return model, nil
+}
+
+func parse(content []byte) (*Model, error) {
+	model := &Model{}
+	err := json.Unmarshal(content, model)
+	if err != nil {
+		return nil, err
+	}
+	if model.Version != modelVersion {
+		return nil, fmt.Errorf("unsupported model version %d", model.Version)
+	}
+	if len(model.Classes) == 0 || len(model.Weights) != len(model.Classes) || len(model.Bias) != len(model.Classes) ||
+		len(model.Mean) != len(model.Features) || len(model.StdDev) != len(model.Features) {
+		return nil, errors.New("model has mismatched classes, features and weights")
+	}
+	for _, weights := range model.Weights {
+		if len(weights) != len(model.Features) {
+			return nil, errors.New("model has mismatched classes, features and weights")
+		}
+	}
+	return model, nil
+}
+
+// Save the model as JSON.
+func (m *Model) Save(path string) error {
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0o644)
+}
+
+// Train a model on labelled samples, using every feature found in the samples.
+func Train(samples []Sample, options TrainOptions) (*Model, error) {
+	classIndex := map[string]int{}
+	featureSet := map[string]bool{}
+	for _, sample := range samples {
+		classIndex[sample.Class] = 0
+		for name := range sample.Features {
+			featureSet[name] = true
+		}
+	}
+	if len(classIndex) < 2 {
+		return nil, errors.New("samples of at least two classes are needed to train")
+	}
+	model := &Model{Version: modelVersion}
+	for class := range classIndex {
+		model.Classes = append(model.Classes, class)
+	}
+	sort.Strings(model.Classes)
+	for i, class := range model.Classes {
+		classIndex[class] = i
+	}
+	for name := range featureSet {
+		model.Features = append(model.Features, name)
+	}
+	sort.Strings(model.Features)
+
+	// Standardise the features so the learning rate suits all of them.
+	vectors := make([][]float64, len(samples))
+	for i, sample := range samples {
+		vectors[i] = model.vector(sample.Features, false)
+	}
+	model.Mean = make([]float64, len(model.Features))
+	model.StdDev = make([]float64, len(model.Features))
+	for j := range model.Features {
+		for _, vector := range vectors {
+			model.Mean[j] += vector[j] / float64(len(vectors))
+		}
+		for _, vector := range vectors {
+			model.StdDev[j] += (vector[j] - model.Mean[j]) * (vector[j] - model.Mean[j]) / float64(len(vectors))
+		}
+		model.StdDev[j] = math.Sqrt(model.StdDev[j])
+		// Rounding leaves a tiny deviation for features that don't vary, which would magnify them.
+		if model.StdDev[j] < minStdDev {
+			model.StdDev[j] = 1
+		}
+	}
+	for i := range vectors {
+		vectors[i] = model.vector(samples[i].Features, true)
+	}
+
+	model.Weights = make([][]float64, len(model.Classes))
+	for c := range model.Weights {
+		model.Weights[c] = make([]float64, len(model.Features))
+	}
+	model.Bias = make([]float64, len(model.Classes))
+	for range options.Iterations {
+		weightGradients := make([][]float64, len(model.Classes))
+		for c := range weightGradients {
+			weightGradients[c] = make([]float64, len(model.Features))
+		}
+		biasGradients := make([]float64, len(model.Classes))
+		for i, vector := range vectors {
+			probabilities := model.probabilities(vector)
+			for c, probability := range probabilities {
+				// Gradient of the cross entropy loss with respect to the score of each class.
+				errorTerm := probability
+				if c == classIndex[samples[i].Class] {
+					errorTerm -= 1
+				}
+				for j, value := range vector {
+					weightGradients[c][j] += errorTerm * value
+				}
+				biasGradients[c] += errorTerm
+			}
+		}
+		for c := range model.Weights {
+			for j := range model.Weights[c] {
+				gradient := weightGradients[c][j]/float64(len(samples)) + options.Regularisation*model.Weights[c][j]
+				model.Weights[c][j] -= options.LearningRate * gradient
+			}
+			model.Bias[c] -= options.LearningRate * biasGradients[c] / float64(len(samples))
+		}
+	}
+	return model, nil
+}
+
+// Predict the class of a sample from its features.
+func (m *Model) Predict(features Features) Prediction {
+	probabilities := m.probabilities(m.vector(features, true))
+	result := Prediction{Probabilities: map[string]float64{}}
+	for c, probability := range probabilities {
+		result.Probabilities[m.Classes[c]] = probability
+		if probability > result.Probability {
+			result.Class, result.Probability = m.Classes[c], probability
+		}
+	}
+	return result
+}
+
+// Features of a sample in the order of the model, optionally standardised.
+func (m *Model) vector(features Features, standardise bool) []float64 {
+	vector := make([]float64, len(m.Features))
+	for j, name := range m.Features {
+		vector[j] = features[name]
+		if standardise {
+			vector[j] = (vector[j] - m.Mean[j]) / m.StdDev[j]
+		}
+	}
+	return vector
+}
+
+// Softmax of the score of each class for a standardised vector.
+func (m *Model) probabilities(vector []float64) []float64 {
+	scores := make([]float64, len(m.Classes))
+	highest := math.Inf(-1)
+	for c := range m.Classes {
+		scores[c] = m.Bias[c]
+		for j, value := range vector {
+			scores[c] += m.Weights[c][j] * value
+		}
+		highest = max(highest, scores[c])
+	}
+	// Subtracting the highest score keeps the exponentials from overflowing.
+	total := 0.0
+	for c := range scores {
+		scores[c] = math.Exp(scores[c] - highest)
+		total += scores[c]
+	}
+	for c := range scores {
+		scores[c] /= total
+	}
+	return scores
+}
@@ -0,0 +1,83 @@
+package classifier
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Samples of two classes separated by their overall entropy, with a feature that doesn't vary.
+func testSamples() []Sample {
+	random := rand.New(rand.NewSource(1))
+	samples := []Sample{}
+	for range 20 {
+		samples = append(samples,
+			Sample{Class: "benign", Features: Features{"overall": 4 + random.Float64(), "constant": 1}},
+			Sample{Class: "encrypted", Features: Features{"overall": 7.5 + random.Float64()/2, "constant": 1}},
+		)
+	}
+	return samples
+}
+
+func TestTrainAndPredict(t *testing.T) {
+	model, err := Train(testSamples(), DefaultTrainOptions)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if !reflect.DeepEqual(model.Classes, []string{"benign", "encrypted"}) || !reflect.DeepEqual(model.Features, []string{"constant", "overall"}) {
+		t.Errorf("Unexpected model, got: %+v", model)
+	}
+	prediction := model.Predict(Features{"overall": 7.9})
+	if prediction.Class != "encrypted" || prediction.Probability < 0.9 {
+		t.Errorf("Unexpected prediction, got: %+v", prediction)
+	}
+	prediction = model.Predict(Features{"overall": 4.2, "unknown": 100})
+	if prediction.Class != "benign" || prediction.Probability < 0.9 {
+		t.Errorf("Unexpected prediction, got: %+v", prediction)
+	}
+	if total := prediction.Probabilities["benign"] + prediction.Probabilities["encrypted"]; total < 0.999999 || total > 1.000001 {
+		t.Errorf("Expected probabilities to sum to 1, got: %v", prediction.Probabilities)
+	}
+
+	_, err = Train(testSamples()[:1], DefaultTrainOptions)
+	if err == nil {
+		t.Errorf("Expected an error training a single class")
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	model, err := Train(testSamples(), TrainOptions{Iterations: 10, LearningRate: 0.5})
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "model.json")
+	err = model.Save(path)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if !reflect.DeepEqual(loaded, model) {
+		t.Errorf("Expected the loaded model to match, got: %+v", loaded)
+	}
+
+	err = os.WriteFile(path, []byte(`{"version": 1, "classes": ["a"], "features": ["x"], "mean": [0], "std_dev": [1], "weights": [[]], "bias": [0]}`), 0o644)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	_, err = Load(path)
+	if err == nil {
+		t.Errorf("Expected an error for mismatched weights")
+	}
+}
+
+func TestDefault(t *testing.T) {
+	model := Default()
+	if len(model.Classes) < 2 || len(model.Features) == 0 {
+		t.Errorf("Unexpected default model, got: %+v", model)
+	}
+}
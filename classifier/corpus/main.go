@@ -0,0 +1,192 @@
+/*
+Write the synthetic corpus the default classifier model is trained on, labelled by directory for the classifier
+subcommand. From the root of the repository, with no PLUGIN_ settings set:
+
+	go run ./classifier/corpus /tmp/corpus
+	go run . classifier -model classifier/default_model.json /tmp/corpus
+
+The corpus is generated from a fixed seed, so it and the model trained on it are the same every time. Each class has
+samples from 2KiB to 2MiB, spread evenly over the log of the size, so no class is told apart by its length:
+
+  - benign - generated text, structured records and executable-like files of headers, code, string tables, relocation
+    tables and padding.
+  - packed - benign samples compressed with DEFLATE, half of them after an uncompressed stub of an executable-like
+    file.
+  - encrypted - random bytes, half of them after a short header.
+*/
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Samples written for each class.
+const samplesPerClass = 40
+
+// Smallest and largest samples.
+const (
+	minSampleSize = 2 * 1024
+	maxSampleSize = 2 * 1024 * 1024
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s DIR\n", filepath.Base(os.Args[0]))
+		os.Exit(2)
+	}
+	err := writeCorpus(os.Args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Write the samples of every class to the directory named after the class.
+func writeCorpus(dir string) error {
+	random := rand.New(rand.NewSource(1))
+	classes := map[string]func(random *rand.Rand, i int, size int) []byte{
+		"benign":    benign,
+		"packed":    packed,
+		"encrypted": encrypted,
+	}
+	for _, class := range []string{"benign", "packed", "encrypted"} {
+		err := os.MkdirAll(filepath.Join(dir, class), 0o755)
+		if err != nil {
+			return err
+		}
+		for i := range samplesPerClass {
+			size := sampleSize(i)
+			content := classes[class](random, i, size)
+			err = os.WriteFile(filepath.Join(dir, class, fmt.Sprintf("%03d", i)), content[:min(len(content), size)], 0o644)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Size of the ith sample of a class, spread evenly over the log of the size.
+func sampleSize(i int) int {
+	scale := float64(i) / float64(samplesPerClass-1)
+	return int(minSampleSize * math.Pow(maxSampleSize/minSampleSize, scale))
+}
+
+// Text, records or an executable-like file of at least size bytes.
+func benign(random *rand.Rand, i int, size int) []byte {
+	switch i % 3 {
+	case 0:
+		return text(random, size)
+	case 1:
+		return records(random, size)
+	}
+	return executable(random, size)
+}
+
+// Benign content compressed to at least size bytes, half after a stub of an executable-like file.
+func packed(random *rand.Rand, i int, size int) []byte {
+	var out bytes.Buffer
+	if i%2 == 1 {
+		out.Write(executable(random, 512+random.Intn(4096)))
+	}
+	writer, _ := flate.NewWriter(&out, flate.BestCompression)
+	for chunk := 0; out.Len() < size; chunk++ {
+		// Chunks of varied content, so the compressed data isn't one repeated pattern.
+		writer.Write(benign(random, i+chunk, 64*1024))
+		writer.Flush()
+	}
+	writer.Close()
+	return out.Bytes()
+}
+
+// Random bytes, half after a short header.
+func encrypted(random *rand.Rand, i int, size int) []byte {
+	content := make([]byte, size)
+	random.Read(content)
+	if i%2 == 1 {
+		copy(content, "Salted__")
+	}
+	return content
+}
+
+// Words made of random syllables, as the same few hundred words are common in any text.
+func vocabulary(random *rand.Rand) []string {
+	syllables := []string{"a", "e", "i", "o", "u", "th", "an", "er", "in", "re", "on", "st", "en", "at", "ing", "ed", "to", "es", "or", "al"}
+	words := make([]string, 300)
+	for i := range words {
+		for range 1 + random.Intn(3) {
+			words[i] += syllables[random.Intn(len(syllables))]
+		}
+	}
+	return words
+}
+
+// Sentences of words, common words being more likely, broken into paragraphs.
+func text(random *rand.Rand, size int) []byte {
+	words := vocabulary(random)
+	var out bytes.Buffer
+	for out.Len() < size {
+		sentence := make([]string, 4+random.Intn(16))
+		for i := range sentence {
+			sentence[i] = words[int(float64(len(words))*math.Pow(random.Float64(), 3))]
+		}
+		sentence[0] = strings.ToUpper(sentence[0][:1]) + sentence[0][1:]
+		out.WriteString(strings.Join(sentence, " "))
+		out.WriteString([]string{". ", ". ", ", ", "? ", ".\n\n"}[random.Intn(5)])
+	}
+	return out.Bytes()
+}
+
+// Lines of comma separated records of names, numbers and dates.
+func records(random *rand.Rand, size int) []byte {
+	words := vocabulary(random)
+	var out bytes.Buffer
+	for id := 1; out.Len() < size; id++ {
+		fmt.Fprintf(&out, "%d,%s,%s,%d.%02d,2024-%02d-%02d,%t\n", id, words[random.Intn(len(words))], words[random.Intn(len(words))],
+			random.Intn(10000), random.Intn(100), 1+random.Intn(12), 1+random.Intn(28), random.Intn(2) == 0)
+	}
+	return out.Bytes()
+}
+
+// A header, then regions of code, strings, relocations and padding like the sections of an executable.
+func executable(random *rand.Rand, size int) []byte {
+	var out bytes.Buffer
+	header := make([]byte, 256)
+	for i := 0; i < len(header); i += 4 {
+		binary.LittleEndian.PutUint32(header[i:], uint32(random.Intn(0x1000)))
+	}
+	out.Write(header)
+	// Opcodes are drawn from a skewed distribution, a few are far more common than the rest.
+	opcodes := random.Perm(256)
+	words := vocabulary(random)
+	for out.Len() < size {
+		switch random.Intn(4) {
+		case 0, 1:
+			for range 1024 + random.Intn(8192) {
+				out.WriteByte(byte(opcodes[int(256*math.Pow(random.Float64(), 2.5))]))
+			}
+		case 2:
+			for range 32 + random.Intn(256) {
+				out.WriteString(words[random.Intn(len(words))])
+				out.WriteByte(0)
+			}
+		case 3:
+			address := uint32(random.Intn(0x100000))
+			for range 64 + random.Intn(512) {
+				address += uint32(4 + 4*random.Intn(8))
+				binary.Write(&out, binary.LittleEndian, address)
+			}
+		}
+		// Sections are aligned with null bytes.
+		out.Write(make([]byte, (512-out.Len()%512)%512))
+	}
+	return out.Bytes()
+}
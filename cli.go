@@ -0,0 +1,444 @@
+/*
+Standalone command line mode, running the same analysis as the plugin over local files without an Azul deployment.
+
+	azul-entropy cli [-format json|csv|table|graph] [-output FILE] [-streams DIR] [-ranges START-END,...] [PATH ...]
+
+Paths may be files or directories (analysed recursively), "-" or no paths reads stdin, which is analysed as it is read.
+Only the results are written to stdout, the settings printed when the binary starts go to stderr (see the stdio
+package).
+*/
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/AustralianCyberSecurityCentre/azul-bedrock/v10/gosrc/plugin"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/render"
+)
+
+// Name of the subcommand that runs the cli instead of the plugin.
+const cliCommand = "cli"
+
+// Path standing for stdin as an input or stdout as the output.
+const stdioPath = "-"
+
+// Content of a local file, served in chunks like the content of a plugin job.
+type readerSource struct {
+	reader io.ReaderAt
+	size   uint64
+}
+
+func (rs *readerSource) GetContentChunk(startChunk uint64, endChunk uint64) ([]byte, bool, *plugin.PluginError) {
+	if rs.size == 0 {
+		return []byte{}, true, nil
+	}
+	if startChunk >= rs.size {
+		return []byte{}, true, plugin.NewPluginError(plugin.ErrorRunner, "Failed to read content chunk", "requested start chunk is after the end of the file")
+	}
+	endOfFile := false
+	if endChunk >= rs.size-1 {
+		endChunk = rs.size - 1
+		endOfFile = true
+	}
+	chunk := make([]byte, endChunk-startChunk+1)
+	n, err := rs.reader.ReadAt(chunk, int64(startChunk))
+	if err != nil && !(errors.Is(err, io.EOF) && n == len(chunk)) {
+		return nil, false, plugin.NewPluginError(plugin.ErrorRunner, "Failed to read content chunk", "could not read the file").WithCausalError(err)
+	}
+	return chunk[:n], endOfFile, nil
+}
+
+// Content of stdin, served in chunks as it is read so it doesn't have to fit in memory. Its size isn't known until it
+// has been read, so chunks can only be fetched in order.
+type streamSource struct {
+	reader io.Reader
+	offset uint64
+}
+
+func (ss *streamSource) GetContentChunk(startChunk uint64, endChunk uint64) ([]byte, bool, *plugin.PluginError) {
+	if startChunk != ss.offset {
+		return nil, false, plugin.NewPluginError(plugin.ErrorRunner, "Failed to read content chunk", "stdin can only be read in order")
+	}
+	chunk := make([]byte, endChunk-startChunk+1)
+	n, err := io.ReadFull(ss.reader, chunk)
+	ss.offset += uint64(n)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return chunk[:n], true, nil
+	}
+	if err != nil {
+		return nil, false, plugin.NewPluginError(plugin.ErrorRunner, "Failed to read content chunk", "could not read stdin").WithCausalError(err)
+	}
+	return chunk, false, nil
+}
+
+// Output of the analysis of one path.
+type cliRecord struct {
+	Path     string            `json:"path"`
+	Size     uint64            `json:"size"`
+	FileType string            `json:"file_type"`
+	Entropy  EventInfoEntropy  `json:"entropy"`
+	Features []analysisFeature `json:"features"`
+}
+
+// Writes records in one of the output formats.
+type cliWriter interface {
+	write(record *cliRecord) error
+	// Write anything buffered once every record is written.
+	flush() error
+}
+
+// One JSON object per line.
+type jsonWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *jsonWriter) write(record *cliRecord) error {
+	return w.encoder.Encode(record)
+}
+
+func (w *jsonWriter) flush() error {
+	return nil
+}
+
+// Summary columns shared by the csv and table outputs.
+var cliSummaryColumns = []string{"path", "size", "entropy", "class", "format", "strings", "encoded", "xor"}
+
+// The class is the band of the overall entropy.
+func cliSummary(record *cliRecord, bands []render.Band) []string {
+	return []string{
+		record.Path,
+		strconv.FormatUint(record.Size, 10),
+		strconv.FormatFloat(record.Entropy.Overall, 'f', 4, 64),
+		render.Classify(record.Entropy.Overall, bands),
+		record.Entropy.Format,
+		strconv.Itoa(len(record.Entropy.Strings)),
+		strconv.Itoa(len(record.Entropy.Encoded)),
+		strconv.Itoa(len(record.Entropy.Xor)),
+	}
+}
+
+// Summary columns followed by the block entropies, separated by spaces.
+type csvWriter struct {
+	writer        *csv.Writer
+	bands         []render.Band
+	headerWritten bool
+}
+
+func (w *csvWriter) write(record *cliRecord) error {
+	if !w.headerWritten {
+		w.headerWritten = true
+		err := w.writer.Write(append(append([]string{}, cliSummaryColumns...), "block_size", "blocks"))
+		if err != nil {
+			return err
+		}
+	}
+	blocks := make([]string, len(record.Entropy.Blocks))
+	for i, value := range record.Entropy.Blocks {
+		blocks[i] = strconv.FormatFloat(value, 'f', 4, 64)
+	}
+	return w.writer.Write(append(cliSummary(record, w.bands), strconv.Itoa(record.Entropy.BlockSize), strings.Join(blocks, " ")))
+}
+
+func (w *csvWriter) flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// Aligned summary columns for reading in a terminal.
+type tableWriter struct {
+	writer        *tabwriter.Writer
+	bands         []render.Band
+	headerWritten bool
+}
+
+func (w *tableWriter) write(record *cliRecord) error {
+	if !w.headerWritten {
+		w.headerWritten = true
+		_, err := fmt.Fprintln(w.writer, strings.ToUpper(strings.Join(cliSummaryColumns, "\t")))
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w.writer, strings.Join(cliSummary(record, w.bands), "\t"))
+	return err
+}
+
+func (w *tableWriter) flush() error {
+	return w.writer.Flush()
+}
+
+// The path and summary of each record followed by its profile drawn as a terminal bar graph.
+type graphWriter struct {
+	out     io.Writer
+	options render.TerminalOptions
+}
+
+func (w *graphWriter) write(record *cliRecord) error {
+	graph := render.TerminalGraph(profileFromInfo(&record.Entropy, record.Size, w.options.Bands), w.options)
+	_, err := fmt.Fprintf(w.out, "%s  size %d  entropy %.4f  %s\n%s\n\n",
+		record.Path, record.Size, record.Entropy.Overall, render.Classify(record.Entropy.Overall, w.options.Bands), graph)
+	return err
+}
+
+func (w *graphWriter) flush() error {
+	return nil
+}
+
+// Writer of the format, the bands of the graph options also classify the entropy in the summary of the other formats.
+func newCliWriter(format string, out io.Writer, graphOptions render.TerminalOptions) (cliWriter, error) {
+	switch format {
+	case "json":
+		return &jsonWriter{encoder: json.NewEncoder(out)}, nil
+	case "csv":
+		return &csvWriter{writer: csv.NewWriter(out), bands: graphOptions.Bands}, nil
+	case "table":
+		return &tableWriter{writer: tabwriter.NewWriter(out, 0, 0, 2, ' ', 0), bands: graphOptions.Bands}, nil
+	case "graph":
+		return &graphWriter{out: out, options: graphOptions}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q, expected json, csv, table or graph", format)
+}
+
+// Run the cli with the arguments following the subcommand, returning the exit code.
+// Paths that can't be analysed are reported to stderr and the remaining paths are still analysed.
+func runCli(args []string, config *EntropySettings, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet(cliCommand, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [options] [PATH ...]\n", filepath.Base(os.Args[0]), cliCommand)
+		fmt.Fprintln(flags.Output(), "Analyse files, directories (recursively) or stdin (\"-\" or no paths).")
+		fmt.Fprintln(flags.Output(), "Settings are read from the same PLUGIN_* environment variables as the plugin.")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "table", "output format: json, csv, table or graph")
+	output := flags.String("output", stdioPath, "file to write the results to, \"-\" for stdout")
+	streamsDir := flags.String("streams", "", "directory to write the rendered graphs and charts to")
+	graphWidth := flags.Int("width", 80, "columns of the graph format")
+	graphHeight := flags.Int("height", 4, "rows of the graph format, 1 for a sparkline")
+	colour := flags.String("colour", "auto", "colour the graph format: auto (when writing to a terminal), always or never")
+	timing := flags.Bool("timing", false, "report the time spent fetching and analysing each file to stderr")
+	rangesValue := flags.String("ranges", "", "comma separated START-END ranges of interest to analyse on their own")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	interest, err := parseInterestRanges(*rangesValue)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if *output != stdioPath {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		defer file.Close()
+		stdout = file
+	}
+	graphOptions := render.TerminalOptions{Width: *graphWidth, Height: *graphHeight, Bands: config.bands()}
+	switch *colour {
+	case "auto":
+		graphOptions.Colour = isTerminal(stdout)
+	case "always":
+		graphOptions.Colour = true
+	case "never":
+	default:
+		fmt.Fprintf(stderr, "unknown colour mode %q, expected auto, always or never\n", *colour)
+		return 2
+	}
+	writer, err := newCliWriter(*format, stdout, graphOptions)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{stdioPath}
+	}
+
+	exitCode := 0
+	fail := func(path string, err error) {
+		fmt.Fprintf(stderr, "%s: %v\n", path, err)
+		exitCode = 1
+	}
+	analysePath := func(path string) {
+		record, result, err := analyseLocal(path, config, stdin, interest)
+		if err != nil {
+			fail(path, err)
+			return
+		}
+		if *timing {
+			metrics := result.Metrics
+			fmt.Fprintf(stderr, "%s: chunks %d  fetch %v  analysis %v  wait %v  overlap %v  elapsed %v\n", path, metrics.Chunks,
+				metrics.Fetch, metrics.Analysis, metrics.Wait, metrics.Overlap(), metrics.Elapsed)
+		}
+		err = writer.write(record)
+		if err != nil {
+			fail(path, err)
+			return
+		}
+		if *streamsDir != "" {
+			err = writeStreams(*streamsDir, path, result.Streams)
+			if err != nil {
+				fail(path, err)
+			}
+		}
+	}
+	walkFiles(paths, analysePath, fail)
+	err = writer.flush()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return exitCode
+}
+
+// Reported for a path that is skipped as it isn't a file, such as a device, socket or link to a directory.
+var errNotRegular = errors.New("skipped as it isn't a regular file")
+
+// Call fn with each file of the paths, walking directories recursively, or with stdioPath as given. Symbolic links to
+// files are followed, links to directories are only followed when given as a path so the walk can't loop. Anything
+// else that isn't a regular file, and any path that can't be read, is passed to fail.
+func walkFiles(paths []string, fn func(path string), fail func(path string, err error)) {
+	for _, root := range paths {
+		if root == stdioPath {
+			fn(root)
+			continue
+		}
+		info, err := os.Stat(root)
+		if err != nil {
+			fail(root, err)
+			continue
+		}
+		if !info.IsDir() {
+			if !info.Mode().IsRegular() {
+				fail(root, errNotRegular)
+				continue
+			}
+			fn(root)
+			continue
+		}
+		walkRoot := root
+		if link, err := os.Lstat(root); err == nil && link.Mode()&fs.ModeSymlink != 0 {
+			// The walk only follows a link to a directory given with a trailing separator.
+			walkRoot = root + string(filepath.Separator)
+		}
+		err = filepath.WalkDir(walkRoot, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				fail(path, err)
+				return nil
+			}
+			if entry.IsDir() {
+				return nil
+			}
+			mode := entry.Type()
+			if mode&fs.ModeSymlink != 0 {
+				info, err := os.Stat(path)
+				if err != nil {
+					fail(path, err)
+					return nil
+				}
+				mode = info.Mode()
+			}
+			if !mode.IsRegular() {
+				fail(path, errNotRegular)
+				return nil
+			}
+			fn(path)
+			return nil
+		})
+		if err != nil {
+			fail(root, err)
+		}
+	}
+}
+
+// Whether the output is a terminal rather than a file or pipe.
+func isTerminal(out io.Writer) bool {
+	file, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	stat, err := file.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// Parse comma separated START-END ranges of interest, each labelled with its text.
+func parseInterestRanges(value string) ([]byteRange, error) {
+	ranges := []byteRange{}
+	for _, text := range strings.Split(value, ",") {
+		if text = strings.TrimSpace(text); text == "" {
+			continue
+		}
+		start, end, err := parseRange(text)
+		if err != nil {
+			return nil, err
+		}
+		if end <= start {
+			return nil, fmt.Errorf("range %q ends before it starts", text)
+		}
+		ranges = append(ranges, byteRange{Label: text, Offset: start, Size: end - start})
+	}
+	return ranges, nil
+}
+
+// Analyse a local file, or stdin for "-", along with the ranges of interest. Stdin is analysed as it is read, see
+// unknownSize.
+func analyseLocal(path string, config *EntropySettings, stdin io.Reader, interest []byteRange) (*cliRecord, *analysisResult, error) {
+	var source ContentSource
+	size := uint64(unknownSize)
+	if path == stdioPath {
+		source = &streamSource{reader: stdin}
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer file.Close()
+		stat, err := file.Stat()
+		if err != nil {
+			return nil, nil, err
+		}
+		size = uint64(stat.Size())
+		source = &readerSource{reader: file, size: size}
+	}
+	result, pluginErr := analyse(context.Background(), config, size, source, interest)
+	if pluginErr != nil {
+		return nil, nil, pluginErr
+	}
+	record := &cliRecord{Path: path, Size: result.Size, FileType: result.FileType, Entropy: result.Info, Features: result.Features}
+	return record, result, nil
+}
+
+// Write the rendered streams of a path to the directory, named after the path so files from different directories
+// don't overwrite each other.
+func writeStreams(dir string, path string, streams []analysisStream) error {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+	base := "stdin"
+	if path != stdioPath {
+		base = strings.Trim(strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(filepath.Clean(path)), "._")
+	}
+	for _, stream := range streams {
+		err = os.WriteFile(filepath.Join(dir, base+"."+stream.Name), stream.Data, 0o644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/baseline"
+)
+
+// Name of the subcommand that trains a baseline model from a local corpus.
+const baselineCommand = "baseline"
+
+// Ways the type of each file in the corpus is decided.
+const (
+	// Detected from the content, as the plugin does for binaries without a declared type the model knows.
+	baselineTypesDetect = "detect"
+	// Declared by the directory the file is in, relative to the corpus (e.g. CORPUS/image/jpeg/a.jpg is image/jpeg),
+	// so the types can match the file formats Azul declares.
+	baselineTypesDirs = "dirs"
+)
+
+// Run the baseline subcommand with the arguments following it, returning the exit code.
+// Files that can't be analysed are reported to stderr and the remaining files are still learnt.
+func runBaseline(args []string, config *EntropySettings, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet(baselineCommand, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [options] CORPUS ...\n", filepath.Base(os.Args[0]), baselineCommand)
+		fmt.Fprintln(flags.Output(), "Learn the entropy baseline of each file type from the files in the corpus directories.")
+		fmt.Fprintln(flags.Output(), "An existing model is trained further.")
+		flags.PrintDefaults()
+	}
+	modelPath := flags.String("model", config.BaselinePath, "file of the model")
+	types := flags.String("types", baselineTypesDetect, "how the type of each file is decided: detect (from the content) or dirs (from its directory)")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	if *modelPath == "" {
+		fmt.Fprintln(stderr, "a model file is required, set -model or PLUGIN_BASELINE_PATH")
+		return 2
+	}
+	if *types != baselineTypesDetect && *types != baselineTypesDirs {
+		fmt.Fprintf(stderr, "unknown types %q, expected detect or dirs\n", *types)
+		return 2
+	}
+	model, err := baseline.Load(*modelPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		model, err = baseline.NewModel(), nil
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	exitCode := walkCorpus(flags.Args(), *types == baselineTypesDirs, config, stderr, func(fileType string, record *cliRecord, result *analysisResult) {
+		if fileType == "" {
+			fileType = record.FileType
+		}
+		model.Add(fileType, entropyMetrics(&record.Entropy, config.bands()))
+	})
+	err = model.Save(*modelPath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	// Summarise what the model has learnt, types with too few files aren't used for scoring yet.
+	table := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "TYPE\tFILES\tOVERALL_MEAN\tOVERALL_STD")
+	for _, fileType := range slices.Sorted(maps.Keys(model.Types)) {
+		overall := model.Types[fileType].Metrics["overall"]
+		fmt.Fprintf(table, "%s\t%d\t%.4f\t%.4f\n", fileType, model.Types[fileType].Count, overall.Mean, overall.StdDev())
+	}
+	err = table.Flush()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return exitCode
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/baseline"
+)
+
+func TestBaselineTraining(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	files := map[string][]byte{}
+	for i := range 3 {
+		packed := make([]byte, 2048+i*256)
+		random.Read(packed)
+		files["text/plain/sample"+string(rune('a'+i))] = []byte(strings.Repeat("the quick brown fox ", 100+i*10))
+		files["packed/sample"+string(rune('a'+i))] = packed
+	}
+	corpus := writeCorpus(t, files)
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+
+	var stdout, stderr bytes.Buffer
+	code := runBaseline([]string{"-model", modelPath, "-types", "dirs", corpus}, NewDefaultEntropySettings(), nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code %v: %v", code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "packed ") || !strings.HasPrefix(lines[2], "text/plain ") {
+		t.Errorf("Unexpected summary, got: %v", stdout.String())
+	}
+	model, err := baseline.Load(modelPath)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if model.Types["text/plain"].Count != 3 || model.Types["text/plain"].Metrics["region_text"].Mean != 1 {
+		t.Errorf("Unexpected model, got: %+v", model.Types)
+	}
+
+	// Training again adds to the model, with types detected from the content.
+	stdout.Reset()
+	code = runBaseline([]string{"-model", modelPath, filepath.Join(corpus, "text")}, NewDefaultEntropySettings(), nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code %v: %v", code, stderr.String())
+	}
+	model, err = baseline.Load(modelPath)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if model.Types["text/plain"].Count != 6 {
+		t.Errorf("Expected the model to be trained further, got: %+v", model.Types)
+	}
+}
+
+func TestBaselineTypesFromDirs(t *testing.T) {
+	corpus := writeCorpus(t, map[string][]byte{"untyped": make([]byte, 512)})
+	var stdout, stderr bytes.Buffer
+	code := runBaseline([]string{"-model", filepath.Join(t.TempDir(), "model.json"), "-types", "dirs", corpus}, NewDefaultEntropySettings(), nil, &stdout, &stderr)
+	if code != 1 || !strings.Contains(stderr.String(), "untyped: not in a directory naming its label") {
+		t.Errorf("Expected files outside a type directory to be reported, got: %v %v", code, stderr.String())
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/classifier"
+)
+
+// Name of the subcommand that trains a classifier model from labelled local samples.
+const classifierCommand = "classifier"
+
+// Run the classifier subcommand with the arguments following it, returning the exit code.
+// Files that can't be analysed are reported to stderr and the model is trained on the remaining files.
+func runClassifier(args []string, config *EntropySettings, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet(classifierCommand, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [options] CORPUS ...\n", filepath.Base(os.Args[0]), classifierCommand)
+		fmt.Fprintln(flags.Output(), "Train a classifier on the files in the corpus directories, labelled by the directory they are in")
+		fmt.Fprintln(flags.Output(), "(e.g. CORPUS/packed/a.exe is packed).")
+		flags.PrintDefaults()
+	}
+	modelPath := flags.String("model", config.ClassifierPath, "file to save the model to")
+	iterations := flags.Int("iterations", classifier.DefaultTrainOptions.Iterations, "number of passes of gradient descent")
+	learningRate := flags.Float64("learning-rate", classifier.DefaultTrainOptions.LearningRate, "step size of gradient descent")
+	regularisation := flags.Float64("regularisation", classifier.DefaultTrainOptions.Regularisation, "strength of the L2 penalty on the weights")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	if *modelPath == "" {
+		fmt.Fprintln(stderr, "a model file is required, set -model or PLUGIN_CLASSIFIER_PATH")
+		return 2
+	}
+
+	// The classifier being trained isn't loaded, and the outputs the samples don't need aren't rendered. The sections
+	// are parsed as they are when classifying.
+	training := *config
+	training.ClassifierEnabled = false
+	training.SectionsEnabled = true
+	training.GraphEnabled = false
+	training.ChartsEnabled = false
+	training.HilbertEnabled = false
+	training.RangeIndexEnabled = false
+	samples := []classifier.Sample{}
+	exitCode := walkCorpus(flags.Args(), true, &training, stderr, func(label string, record *cliRecord, result *analysisResult) {
+		samples = append(samples, classifier.Sample{
+			Class:    label,
+			Features: classifierFeatures(&record.Entropy, record.Size, result.ChiSquare, config.bands()),
+		})
+	})
+	model, err := classifier.Train(samples, classifier.TrainOptions{
+		Iterations:     *iterations,
+		LearningRate:   *learningRate,
+		Regularisation: *regularisation,
+	})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	err = model.Save(*modelPath)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	// Report how well the model fits the samples it was trained on.
+	counts, correct := map[string]int{}, map[string]int{}
+	for _, sample := range samples {
+		counts[sample.Class]++
+		if model.Predict(sample.Features).Class == sample.Class {
+			correct[sample.Class]++
+		}
+	}
+	table := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "CLASS\tSAMPLES\tTRAINING_ACCURACY")
+	for _, class := range model.Classes {
+		fmt.Fprintf(table, "%s\t%d\t%.4f\n", class, counts[class], float64(correct[class])/float64(counts[class]))
+	}
+	err = table.Flush()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return exitCode
+}
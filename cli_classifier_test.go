@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/classifier"
+)
+
+func TestClassifierTraining(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	files := map[string][]byte{}
+	for i := range 4 {
+		encrypted := make([]byte, 2048+i*256)
+		random.Read(encrypted)
+		files["benign/sample"+string(rune('a'+i))] = []byte(strings.Repeat("the quick brown fox ", 100+i*10))
+		files["encrypted/sample"+string(rune('a'+i))] = encrypted
+	}
+	corpus := writeCorpus(t, files)
+	modelPath := filepath.Join(t.TempDir(), "model.json")
+
+	var stdout, stderr bytes.Buffer
+	code := runClassifier([]string{"-model", modelPath, "-iterations", "200", corpus}, NewDefaultEntropySettings(), nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code %v: %v", code, stderr.String())
+	}
+	expected := "CLASS      SAMPLES  TRAINING_ACCURACY\nbenign     4        1.0000\nencrypted  4        1.0000\n"
+	if stdout.String() != expected {
+		t.Errorf("Unexpected summary, got: %v", stdout.String())
+	}
+	model, err := classifier.Load(modelPath)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if len(model.Classes) != 2 || len(model.Features) == 0 {
+		t.Errorf("Unexpected model, got: %+v", model)
+	}
+
+	// The trained model is used by the analysis when configured.
+	config := NewDefaultEntropySettings()
+	config.ClassifierEnabled = true
+	config.ClassifierPath = modelPath
+	record, _, err := analyseLocal(filepath.Join(corpus, "encrypted", "samplea"), config, nil, nil)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if record.Entropy.Classification == nil || record.Entropy.Classification.Class != "encrypted" {
+		t.Errorf("Unexpected classification, got: %+v", record.Entropy.Classification)
+	}
+}
+
+func TestClassifierTrainingNewModel(t *testing.T) {
+	encrypted := make([]byte, 2048)
+	rand.New(rand.NewSource(1)).Read(encrypted)
+	corpus := writeCorpus(t, map[string][]byte{
+		"benign/sample":    []byte(strings.Repeat("the quick brown fox ", 100)),
+		"encrypted/sample": encrypted,
+	})
+	// The plugin settings of the model being trained, which doesn't exist yet.
+	config := NewDefaultEntropySettings()
+	config.ClassifierEnabled = true
+	config.ClassifierPath = filepath.Join(t.TempDir(), "model.json")
+	config.GraphEnabled = true
+	var stdout, stderr bytes.Buffer
+	code := runClassifier([]string{corpus}, config, nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code %v: %v", code, stderr.String())
+	}
+	if _, err := classifier.Load(config.ClassifierPath); err != nil {
+		t.Errorf("Expected the model to be saved, got: %v", err)
+	}
+}
+
+func TestClassifierSingleClass(t *testing.T) {
+	corpus := writeCorpus(t, map[string][]byte{"benign/sample": make([]byte, 512)})
+	var stdout, stderr bytes.Buffer
+	code := runClassifier([]string{"-model", filepath.Join(t.TempDir(), "model.json"), corpus}, NewDefaultEntropySettings(), nil, &stdout, &stderr)
+	if code != 1 || !strings.Contains(stderr.String(), "at least two classes") {
+		t.Errorf("Expected training a single class to fail, got: %v %v", code, stderr.String())
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/compare"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/sections"
+)
+
+// Name of the subcommand that compares the profiles of two files.
+const compareCommand = "compare"
+
+// Output of comparing two paths, the alignment path is left out as it is only useful for drawing.
+type compareRecord struct {
+	A          string                 `json:"a"`
+	B          string                 `json:"b"`
+	Similarity float64                `json:"similarity"`
+	Distance   float64                `json:"distance"`
+	BlockSize  uint64                 `json:"block_size"`
+	Divergent  []compare.Divergence   `json:"divergent"`
+	Sections   []compare.SectionDelta `json:"sections"`
+}
+
+// Profile of an analysed binary for comparison.
+func compareProfileFromInfo(info *EventInfoEntropy, size uint64) compare.Profile {
+	profile := compare.Profile{Blocks: info.Blocks, BlockSize: uint64(info.BlockSize), Size: size}
+	for _, section := range info.Sections {
+		profile.Sections = append(profile.Sections, sections.Section{Name: section.Name, Offset: section.Offset, Size: section.Size})
+	}
+	return profile
+}
+
+// Run the compare subcommand with the arguments following it, returning the exit code.
+func runCompare(args []string, config *EntropySettings, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet(compareCommand, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [options] ORIGINAL MODIFIED\n", filepath.Base(os.Args[0]), compareCommand)
+		fmt.Fprintln(flags.Output(), "Align the entropy profiles of two files (\"-\" for stdin) and report where they diverge.")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "table", "output format: json or table")
+	output := flags.String("output", stdioPath, "file to write the results to, \"-\" for stdout")
+	threshold := flags.Float64("threshold", compare.DefaultThreshold, "difference in entropy between aligned blocks reported as divergent")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+	if flags.Arg(0) == stdioPath && flags.Arg(1) == stdioPath {
+		fmt.Fprintln(stderr, "stdin can only be read for one of the files")
+		return 2
+	}
+	if *format != "json" && *format != "table" {
+		fmt.Fprintf(stderr, "unknown output format %q, expected json or table\n", *format)
+		return 2
+	}
+
+	// The section deltas are part of the comparison, and the outputs it doesn't use aren't rendered. The profiles are
+	// resampled to the same block size by compare.Compare.
+	comparing := *config
+	comparing.SectionsEnabled = true
+	comparing.GraphEnabled = false
+	comparing.ChartsEnabled = false
+	comparing.HilbertEnabled = false
+	comparing.RangeIndexEnabled = false
+	profiles := make([]compare.Profile, 2)
+	for i, path := range flags.Args() {
+		record, _, err := analyseLocal(path, &comparing, stdin, nil)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", path, err)
+			return 1
+		}
+		profiles[i] = compareProfileFromInfo(&record.Entropy, record.Size)
+	}
+	result := compare.Compare(profiles[0], profiles[1], compare.Options{Threshold: *threshold})
+	record := compareRecord{
+		A:          flags.Arg(0),
+		B:          flags.Arg(1),
+		Similarity: result.Similarity,
+		Distance:   result.Distance,
+		BlockSize:  result.BlockSize,
+		Divergent:  result.Divergent,
+		Sections:   result.Sections,
+	}
+
+	if *output != stdioPath {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		defer file.Close()
+		stdout = file
+	}
+	if *format == "json" {
+		err = json.NewEncoder(stdout).Encode(&record)
+	} else {
+		err = writeCompareTable(stdout, &record)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// Write the scores followed by tables of the divergent regions and sections.
+func writeCompareTable(out io.Writer, record *compareRecord) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	formatEntropy := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', 4, 64)
+	}
+	lines := []string{
+		"A\t" + record.A,
+		"B\t" + record.B,
+		"SIMILARITY\t" + formatEntropy(record.Similarity),
+		"DISTANCE\t" + formatEntropy(record.Distance),
+		"BLOCK_SIZE\t" + strconv.FormatUint(record.BlockSize, 10),
+		"",
+		"A_OFFSET\tA_SIZE\tB_OFFSET\tB_SIZE\tDELTA",
+	}
+	for _, region := range record.Divergent {
+		lines = append(lines, strings.Join([]string{
+			formatHex(region.AOffset), formatHex(region.ASize), formatHex(region.BOffset), formatHex(region.BSize),
+			formatEntropy(region.Delta),
+		}, "\t"))
+	}
+	if len(record.Sections) > 0 {
+		lines = append(lines, "", "SECTION\tA_OFFSET\tA_ENTROPY\tB_OFFSET\tB_ENTROPY\tDELTA")
+	}
+	for _, section := range record.Sections {
+		// Sections missing from a file are shown as "-".
+		aOffset, aEntropy, bOffset, bEntropy := "-", "-", "-", "-"
+		if section.ASize > 0 {
+			aOffset, aEntropy = formatHex(section.AOffset), formatEntropy(section.AEntropy)
+		}
+		if section.BSize > 0 {
+			bOffset, bEntropy = formatHex(section.BOffset), formatEntropy(section.BEntropy)
+		}
+		lines = append(lines, strings.Join([]string{section.Name, aOffset, aEntropy, bOffset, bEntropy, formatEntropy(section.Delta)}, "\t"))
+	}
+	for _, line := range lines {
+		_, err := fmt.Fprintln(writer, line)
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+func formatHex(value uint64) string {
+	return fmt.Sprintf("0x%x", value)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompareJson(t *testing.T) {
+	dir := t.TempDir()
+	original := filepath.Join(dir, "original")
+	err := os.WriteFile(original, buildElf(t, make([]byte, 4096)), 0o644)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	// The same layout with random bytes packed into the .text section.
+	text := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(text)
+	// The sections are compared without enabling them.
+	settings := NewDefaultEntropySettings()
+
+	var stdout, stderr bytes.Buffer
+	code := runCompare([]string{"-format", "json", original, "-"}, settings, bytes.NewReader(buildElf(t, text)), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code %v: %v", code, stderr.String())
+	}
+	var record compareRecord
+	err = json.Unmarshal(stdout.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if record.A != original || record.B != "-" || record.Similarity >= 0.5 || len(record.Divergent) != 1 {
+		t.Errorf("Unexpected comparison, got: %+v", record)
+	}
+	if region := record.Divergent[0]; region.AOffset != 0 || region.BOffset != 0 || region.Delta < 6 {
+		t.Errorf("Expected the .text section to diverge, got: %+v", region)
+	}
+	if len(record.Sections) != 2 || record.Sections[0].Name != ".text" || record.Sections[0].Delta < 6 {
+		t.Errorf("Unexpected section deltas, got: %+v", record.Sections)
+	}
+}
+
+func TestCompareBlockSizes(t *testing.T) {
+	dir := t.TempDir()
+	content := make([]byte, 128*1024)
+	rand.New(rand.NewSource(1)).Read(content[:64*1024])
+	original := filepath.Join(dir, "original")
+	err := os.WriteFile(original, content, 0o644)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	// Null bytes appended, so the larger file is analysed with larger blocks.
+	var stdout, stderr bytes.Buffer
+	modified := append(content, make([]byte, 256*1024)...)
+	code := runCompare([]string{"-format", "json", original, "-"}, NewDefaultEntropySettings(), bytes.NewReader(modified), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code %v: %v", code, stderr.String())
+	}
+	var record compareRecord
+	err = json.Unmarshal(stdout.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	// Both profiles have the larger block size, so the random bytes line up.
+	if record.BlockSize != 512 || record.Similarity != 1 || len(record.Divergent) != 0 {
+		t.Errorf("Unexpected comparison, got: %+v", record)
+	}
+}
+
+func TestCompareTable(t *testing.T) {
+	dir := writeCliFiles(t)
+	var stdout, stderr bytes.Buffer
+	path := filepath.Join(dir, "a.bin")
+	code := runCompare([]string{path, path}, NewDefaultEntropySettings(), nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code %v: %v", code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 7 || lines[2] != "SIMILARITY  1.0000" || !strings.HasPrefix(lines[6], "A_OFFSET") {
+		t.Errorf("Unexpected table, got: %v", stdout.String())
+	}
+}
+
+func TestCompareUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := runCompare([]string{"only-one"}, NewDefaultEntropySettings(), nil, &stdout, &stderr)
+	if code != 2 || !strings.Contains(stderr.String(), "ORIGINAL MODIFIED") {
+		t.Errorf("Expected usage for a missing path, got: %v %v", code, stderr.String())
+	}
+}
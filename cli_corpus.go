@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// Analyse each file in the corpus directories for training a model, passing fn the results and, when labelled, the
+// label of the file from the directory it is in (see corpusLabel). The corpora are walked in the same way as the cli
+// paths, see walkFiles. Files that can't be read, labelled or analysed are reported to stderr and the remaining files
+// are still passed to fn. Returns 1 if any file was reported, otherwise 0.
+func walkCorpus(corpora []string, labelled bool, config *EntropySettings, stderr io.Writer, fn func(label string, record *cliRecord, result *analysisResult)) int {
+	exitCode := 0
+	fail := func(path string, err error) {
+		fmt.Fprintf(stderr, "%s: %v\n", path, err)
+		exitCode = 1
+	}
+	for _, corpus := range corpora {
+		walkFiles([]string{corpus}, func(path string) {
+			label := ""
+			if labelled {
+				var err error
+				label, err = corpusLabel(corpus, path)
+				if err != nil {
+					fail(path, err)
+					return
+				}
+			}
+			record, result, err := analyseLocal(path, config, nil, nil)
+			if err != nil {
+				fail(path, err)
+				return
+			}
+			fn(label, record, result)
+		}, fail)
+	}
+	return exitCode
+}
+
+// Label of a file in a corpus from the directory it is in relative to the corpus, e.g. CORPUS/image/jpeg/a.jpg is
+// image/jpeg.
+func corpusLabel(corpus string, path string) (string, error) {
+	dir, err := filepath.Rel(corpus, filepath.Dir(path))
+	if err != nil || dir == "." {
+		return "", errors.New("not in a directory naming its label")
+	}
+	return filepath.ToSlash(dir), nil
+}
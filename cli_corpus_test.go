@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Write a corpus of files labelled by the directory they are in, files maps the path of each file within the corpus
+// (e.g. "packed/samplea") to its content.
+func writeCorpus(t *testing.T, files map[string][]byte) string {
+	corpus := t.TempDir()
+	for path, content := range files {
+		path = filepath.Join(corpus, filepath.FromSlash(path))
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err == nil {
+			err = os.WriteFile(path, content, 0o644)
+		}
+		if err != nil {
+			t.Fatalf("error %v", err)
+		}
+	}
+	return corpus
+}
+
+func TestWalkCorpus(t *testing.T) {
+	corpus := writeCorpus(t, map[string][]byte{
+		"text/plain/a": []byte(strings.Repeat("a", 512)),
+		"packed/b":     make([]byte, 512),
+		"unlabelled":   make([]byte, 512),
+	})
+	var stderr strings.Builder
+	labels := []string{}
+	code := walkCorpus([]string{corpus, filepath.Join(corpus, "missing")}, true, NewDefaultEntropySettings(), &stderr, func(label string, record *cliRecord, result *analysisResult) {
+		labels = append(labels, label+" "+filepath.Base(record.Path))
+	})
+	// Files are walked in lexical order, those that can't be labelled or read are reported.
+	if strings.Join(labels, ",") != "packed b,text/plain a" {
+		t.Errorf("Unexpected files, got: %v", labels)
+	}
+	if code != 1 || !strings.Contains(stderr.String(), "unlabelled: not in a directory naming its label") || !strings.Contains(stderr.String(), "missing") {
+		t.Errorf("Expected the unlabelled and missing files to be reported, got: %v %v", code, stderr.String())
+	}
+
+	// Without labels every file is passed on.
+	labels = labels[:0]
+	code = walkCorpus([]string{corpus}, false, NewDefaultEntropySettings(), &stderr, func(label string, record *cliRecord, result *analysisResult) {
+		labels = append(labels, filepath.Base(record.Path))
+	})
+	if code != 0 || len(labels) != 3 {
+		t.Errorf("Expected every file, got: %v %v", code, labels)
+	}
+}
+
+func TestWalkCorpusSymlink(t *testing.T) {
+	corpus := writeCorpus(t, map[string][]byte{"packed/b": make([]byte, 512)})
+	link := filepath.Join(t.TempDir(), "corpus")
+	err := os.Symlink(corpus, link)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	// A corpus given as a link is walked, labelling its files in the same way.
+	var stderr strings.Builder
+	labels := []string{}
+	code := walkCorpus([]string{link}, true, NewDefaultEntropySettings(), &stderr, func(label string, record *cliRecord, result *analysisResult) {
+		labels = append(labels, label+" "+record.Path)
+	})
+	if code != 0 || strings.Join(labels, ",") != "packed "+filepath.Join(link, "packed", "b") {
+		t.Errorf("Unexpected files, got: %v %v %v", code, labels, stderr.String())
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/entropy"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/similarity"
+)
+
+// Name of the subcommand that adds files to and queries a local similarity index.
+const indexCommand = "index"
+
+// Actions of the index subcommand.
+const (
+	indexAdd   = "add"
+	indexQuery = "query"
+)
+
+// Nearest profiles in the index to a queried path.
+type indexRecord struct {
+	Path       string                 `json:"path"`
+	Sha256     string                 `json:"sha256"`
+	Signature  string                 `json:"signature"`
+	Neighbours []similarity.Neighbour `json:"neighbours"`
+}
+
+// Run the index subcommand with the arguments following it, returning the exit code.
+// Paths that can't be analysed are reported to stderr and the remaining paths are still added or queried.
+func runIndex(args []string, config *EntropySettings, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet(indexCommand, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [options] add|query PATH ...\n", filepath.Base(os.Args[0]), indexCommand)
+		fmt.Fprintln(flags.Output(), "Add the entropy signatures of files, directories (recursively) or stdin (\"-\") to a local index,")
+		fmt.Fprintln(flags.Output(), "or find the nearest profiles to them.")
+		flags.PrintDefaults()
+	}
+	indexPath := flags.String("db", config.IndexPath, "file of the index, created when first added to")
+	neighbours := flags.Int("k", config.IndexNeighbours, "number of the nearest profiles found for each queried file")
+	format := flags.String("format", "table", "output format of queries: json or table")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	action := flags.Arg(0)
+	if flags.NArg() < 2 || (action != indexAdd && action != indexQuery) {
+		flags.Usage()
+		return 2
+	}
+	if *indexPath == "" {
+		fmt.Fprintln(stderr, "an index file is required, set -db or PLUGIN_INDEX_PATH")
+		return 2
+	}
+	if *format != "json" && *format != "table" {
+		fmt.Fprintf(stderr, "unknown output format %q, expected json or table\n", *format)
+		return 2
+	}
+	index, err := similarity.Open(*indexPath)
+	// The index is limited in the same way as by the plugin when adding to it.
+	if err == nil && action == indexAdd {
+		err = index.SetMaxEntries(config.IndexMaxEntries)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if repaired := index.Repaired(); repaired != nil {
+		fmt.Fprintf(stderr, "dropped the partial last line of the index: %v\n", repaired)
+	}
+
+	exitCode := 0
+	table := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	if action == indexQuery && *format == "table" {
+		fmt.Fprintln(table, "PATH\tNEIGHBOUR\tNEIGHBOUR_PATH\tDISTANCE")
+	}
+	encoder := json.NewEncoder(stdout)
+	indexLocal := func(path string) error {
+		// Profiles are named by sha256 as they are by the plugin, so a shared index has one kind of name.
+		hash := sha256.New()
+		var input io.Reader
+		if path == stdioPath {
+			input = io.TeeReader(stdin, hash)
+		}
+		record, _, err := analyseLocal(path, config, input, nil)
+		if err == nil && path != stdioPath {
+			err = hashFile(path, hash)
+		}
+		if err != nil {
+			return err
+		}
+		if record.Entropy.Truncated != nil {
+			return errors.New("only part of the file was analysed in the time budget")
+		}
+		signature := entropy.Signature(record.Entropy.Blocks)
+		if signature == "" {
+			return errors.New("too small for an entropy signature")
+		}
+		entry := similarity.Entry{Name: hex.EncodeToString(hash.Sum(nil)), Signature: signature}
+		if path != stdioPath {
+			entry.Path = path
+		}
+		if action == indexAdd {
+			return index.AddEntry(entry)
+		}
+		found, err := index.Query(signature, *neighbours)
+		if err != nil {
+			return err
+		}
+		if *format == "json" {
+			return encoder.Encode(&indexRecord{Path: path, Sha256: entry.Name, Signature: signature, Neighbours: found})
+		}
+		for _, neighbour := range found {
+			// Profiles added by the plugin have no path.
+			neighbourPath := neighbour.Path
+			if neighbourPath == "" {
+				neighbourPath = "-"
+			}
+			_, err = fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", path, neighbour.Name, neighbourPath, strconv.FormatFloat(neighbour.Distance, 'f', 4, 64))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	fail := func(path string, err error) {
+		fmt.Fprintf(stderr, "%s: %v\n", path, err)
+		exitCode = 1
+	}
+	walkFiles(flags.Args()[1:], func(path string) {
+		err := indexLocal(path)
+		if err != nil {
+			fail(path, err)
+		}
+	}, fail)
+	err = table.Flush()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return exitCode
+}
+
+// Add the content of a local file to the hash.
+func hashFile(path string, hash io.Writer) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(hash, file)
+	return err
+}
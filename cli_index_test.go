@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIndexAddAndQuery(t *testing.T) {
+	dir := t.TempDir()
+	random := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(random)
+	files := map[string][]byte{
+		"low":  make([]byte, 4096),
+		"high": random,
+		"half": append(make([]byte, 2048), random[:2048]...),
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), content, 0o644)
+		if err != nil {
+			t.Fatalf("error %v", err)
+		}
+	}
+	db := filepath.Join(t.TempDir(), "index.jsonl")
+
+	var stdout, stderr bytes.Buffer
+	code := runIndex([]string{"-db", db, "add", dir}, NewDefaultEntropySettings(), nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code %v: %v", code, stderr.String())
+	}
+	code = runIndex([]string{"-db", db, "-format", "json", "query", "-"}, NewDefaultEntropySettings(), bytes.NewReader(random), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code %v: %v", code, stderr.String())
+	}
+	var record indexRecord
+	err := json.Unmarshal(stdout.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	// The file with no entropy shares no buckets with the query. Profiles are named by sha256 as they are by the plugin,
+	// with the path they were added from.
+	if len(record.Neighbours) != 2 || record.Neighbours[0].Path != filepath.Join(dir, "high") || record.Neighbours[0].Distance != 0 ||
+		record.Neighbours[1].Path != filepath.Join(dir, "half") {
+		t.Errorf("Unexpected neighbours, got: %+v", record.Neighbours)
+	}
+	if hash := fmt.Sprintf("%x", sha256.Sum256(random)); record.Sha256 != hash || record.Neighbours[0].Name != hash {
+		t.Errorf("Expected profiles named by sha256, got: %+v", record)
+	}
+
+	stdout.Reset()
+	code = runIndex([]string{"-db", db, "-k", "1", "query", filepath.Join(dir, "low")}, NewDefaultEntropySettings(), nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code %v: %v", code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "PATH") || !strings.HasSuffix(lines[1], "0.0000") {
+		t.Errorf("Unexpected table, got: %v", stdout.String())
+	}
+}
+
+func TestIndexRequiresFile(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := runIndex([]string{"query", "-"}, NewDefaultEntropySettings(), nil, &stdout, &stderr)
+	if code != 2 || !strings.Contains(stderr.String(), "PLUGIN_INDEX_PATH") {
+		t.Errorf("Expected a missing index file to be reported, got: %v %v", code, stderr.String())
+	}
+}
+
+func TestIndexSymlinksAndErrors(t *testing.T) {
+	dir := t.TempDir()
+	random := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(random)
+	err := os.WriteFile(filepath.Join(dir, "high"), random, 0o644)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	link := filepath.Join(t.TempDir(), "link")
+	err = os.Symlink(filepath.Join(dir, "high"), link)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	db := filepath.Join(t.TempDir(), "index.jsonl")
+
+	// The linked file is added and the missing path is reported.
+	var stdout, stderr bytes.Buffer
+	missing := filepath.Join(dir, "missing")
+	code := runIndex([]string{"-db", db, "add", link, missing}, NewDefaultEntropySettings(), nil, &stdout, &stderr)
+	if code != 1 || !strings.HasPrefix(stderr.String(), missing+": ") {
+		t.Errorf("Expected the missing path to be reported, got: %v %v", code, stderr.String())
+	}
+	code = runIndex([]string{"-db", db, "-format", "json", "query", "-"}, NewDefaultEntropySettings(), bytes.NewReader(random), &stdout, &stderr)
+	var record indexRecord
+	err = json.Unmarshal(stdout.Bytes(), &record)
+	if code != 0 || err != nil || len(record.Neighbours) != 1 || record.Neighbours[0].Path != link {
+		t.Errorf("Expected the linked file to be indexed, got: %v %v %+v", code, err, record)
+	}
+}
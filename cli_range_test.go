@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRangeFromStream(t *testing.T) {
+	dir := t.TempDir()
+	// Null bytes followed by random bytes, indexed in 1KiB granules.
+	content := make([]byte, 0x10000)
+	rand.New(rand.NewSource(1)).Read(content[0x8000:])
+	err := os.WriteFile(filepath.Join(dir, "a.bin"), content, 0o644)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	settings := NewDefaultEntropySettings()
+	settings.RangeIndexEnabled = true
+	settings.RangeIndexGranules = 64
+	settings.RangeIndexMinGranuleSize = 1024
+	streams := filepath.Join(dir, "streams")
+
+	var stdout, stderr bytes.Buffer
+	code := runCli([]string{"-streams", streams, filepath.Join(dir, "a.bin")}, settings, nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code %v: %v", code, stderr.String())
+	}
+	indexes, err := filepath.Glob(filepath.Join(streams, "*a.bin.range_index.bin"))
+	if err != nil || len(indexes) != 1 {
+		t.Fatalf("Expected a range index stream, got: %v %v", indexes, err)
+	}
+
+	stdout.Reset()
+	code = runRange([]string{"-format", "json", indexes[0], "0x4000-0x9200", "0-0x8000", "0x8000-65536"}, settings, nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code %v: %v", code, stderr.String())
+	}
+	records := []rangeRecord{}
+	decoder := json.NewDecoder(&stdout)
+	for decoder.More() {
+		var record rangeRecord
+		err = decoder.Decode(&record)
+		if err != nil {
+			t.Fatalf("error %v", err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected a record per range, got: %+v", records)
+	}
+	if records[0].MeasuredStart != 0x4000 || records[0].MeasuredEnd != 0x9400 || records[0].Entropy <= 1 || records[0].Entropy >= 7 {
+		t.Errorf("Unexpected mixed range, got: %+v", records[0])
+	}
+	if records[1].Entropy != 0 || records[2].Entropy < 7.9 {
+		t.Errorf("Unexpected entropy of the null and random ranges, got: %+v", records[1:])
+	}
+}
+
+func TestRangeInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not_an_index")
+	err := os.WriteFile(path, []byte("content"), 0o644)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	var stdout, stderr bytes.Buffer
+	code := runRange([]string{path, "0-1"}, NewDefaultEntropySettings(), nil, &stdout, &stderr)
+	if code != 1 || !strings.Contains(stderr.String(), "not a range index") {
+		t.Errorf("Expected an invalid index to be reported, got: %v %v", code, stderr.String())
+	}
+	code = runRange([]string{path}, NewDefaultEntropySettings(), nil, &stdout, &stderr)
+	if code != 2 {
+		t.Errorf("Expected missing ranges to be reported, got: %v", code)
+	}
+}
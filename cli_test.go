@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Write files for the cli to analyse, returning the directory holding them.
+func writeCliFiles(t *testing.T) string {
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "nested"), 0o755)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "a.bin"), bytes.Repeat([]byte("a"), 2216), 0o644)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "nested", "b.bin"), buildElf(t, make([]byte, 512)), 0o644)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	return dir
+}
+
+func TestCliJson(t *testing.T) {
+	dir := writeCliFiles(t)
+	var stdout, stderr bytes.Buffer
+	settings := NewDefaultEntropySettings()
+	settings.SectionsEnabled = true
+	code := runCli([]string{"-format", "json", dir}, settings, nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code %v: %v", code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected a record per file, got: %v", stdout.String())
+	}
+	var record cliRecord
+	err := json.Unmarshal([]byte(lines[0]), &record)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	// The same analysis as the plugin, see TestGeneratedBinary.
+	if record.Path != filepath.Join(dir, "a.bin") || record.Size != 2216 || record.Entropy.BlockCount != 8 || record.Entropy.Overall != 0 {
+		t.Errorf("Unexpected record, got: %+v", record)
+	}
+	if len(record.Features) != 1 || record.Features[0].Name != "entropy" {
+		t.Errorf("Unexpected features, got: %+v", record.Features)
+	}
+	err = json.Unmarshal([]byte(lines[1]), &record)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if record.Path != filepath.Join(dir, "nested", "b.bin") || record.Entropy.Format != "elf" || len(record.Entropy.Sections) != 2 {
+		t.Errorf("Unexpected record, got: %+v", record)
+	}
+}
+
+func TestCliCsvStdin(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	stdin := strings.NewReader(strings.Repeat("ab", 256))
+	code := runCli([]string{"-format", "csv"}, NewDefaultEntropySettings(), stdin, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code %v: %v", code, stderr.String())
+	}
+	expected := "path,size,entropy,class,format,strings,encoded,xor,block_size,blocks\n" +
+		"-,512,1.0000,text,,0,0,0,256,1.0000 1.0000\n"
+	if stdout.String() != expected {
+		t.Errorf("Unexpected csv, got: %v", stdout.String())
+	}
+}
+
+func TestCliGraph(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	stdin := strings.NewReader(strings.Repeat("ab", 256))
+	code := runCli([]string{"-format", "graph", "-width", "8", "-height", "1"}, NewDefaultEntropySettings(), stdin, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code %v: %v", code, stderr.String())
+	}
+	expected := "-  size 512  entropy 1.0000  text\n" +
+		"▁▁▁▁▁▁▁▁\n" +
+		"|text\n" +
+		"^0x0   ^0x200\n\n"
+	if stdout.String() != expected {
+		t.Errorf("Unexpected graph, got: %q", stdout.String())
+	}
+}
+
+func TestCliTableAndStreams(t *testing.T) {
+	dir := writeCliFiles(t)
+	streams := t.TempDir()
+	output := filepath.Join(t.TempDir(), "results.txt")
+	var stdout, stderr bytes.Buffer
+	settings := NewDefaultEntropySettings()
+	settings.GraphEnabled = true
+	settings.HilbertEnabled = true
+	settings.ChartsEnabled = true
+	settings.RangeIndexEnabled = true
+	code := runCli([]string{"-output", output, "-streams", streams, filepath.Join(dir, "a.bin"), filepath.Join(dir, "missing")},
+		settings, nil, &stdout, &stderr)
+	// A missing path is reported without stopping the other paths.
+	if code != 1 || !strings.Contains(stderr.String(), "missing") {
+		t.Errorf("Expected missing path to be reported, got: %v %v", code, stderr.String())
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("Expected results in the output file, got: %v", stdout.String())
+	}
+	table, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(table)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "PATH") || !strings.Contains(lines[1], " padding ") {
+		t.Errorf("Unexpected table, got: %v", string(table))
+	}
+	entries, err := os.ReadDir(streams)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name()[strings.Index(entry.Name(), "a.bin"):])
+	}
+	expected := "a.bin.chart.svg a.bin.chart.vl.json a.bin.graph.png a.bin.hilbert.png a.bin.range_index.bin"
+	if strings.Join(names, " ") != expected {
+		t.Errorf("Unexpected streams, got: %v", names)
+	}
+}
+
+func TestCliInvalidFormat(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := runCli([]string{"-format", "xml"}, NewDefaultEntropySettings(), nil, &stdout, &stderr)
+	if code != 2 || !strings.Contains(stderr.String(), "xml") {
+		t.Errorf("Expected invalid format to be reported, got: %v %v", code, stderr.String())
+	}
+}
+
+func TestCliRanges(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	stdin := strings.NewReader(strings.Repeat("a", 256) + strings.Repeat("ab", 128))
+	code := runCli([]string{"-format", "json", "-ranges", "0-0x100, 256-512"}, NewDefaultEntropySettings(), stdin, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code %v: %v", code, stderr.String())
+	}
+	var record cliRecord
+	err := json.Unmarshal(stdout.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	ranges := record.Entropy.Ranges
+	if len(ranges) != 2 || ranges[0].Label != "0-0x100" || ranges[0].Entropy != 0 || ranges[1].Offset != 256 || ranges[1].Entropy != 1 {
+		t.Errorf("Unexpected ranges, got: %+v", ranges)
+	}
+
+	for _, value := range []string{"0x100", "512-256"} {
+		stderr.Reset()
+		code = runCli([]string{"-ranges", value}, NewDefaultEntropySettings(), nil, &stdout, &stderr)
+		if code != 2 || !strings.Contains(stderr.String(), value) {
+			t.Errorf("Expected invalid range %q to be reported, got: %v %v", value, code, stderr.String())
+		}
+	}
+}
+
+func TestCliStdinStreaming(t *testing.T) {
+	// More than the blocks of the minimum size hold, so the blocks are merged as stdin is read.
+	content := make([]byte, 300*1024+100)
+	rand.New(rand.NewSource(1)).Read(content[len(content)-4096:])
+	settings := NewDefaultEntropySettings()
+	settings.TailSize = 4096
+	var stdout, stderr bytes.Buffer
+	// Only a reader, so stdin can't be read again.
+	stdin := struct{ io.Reader }{bytes.NewReader(content)}
+	code := runCli([]string{"-format", "json", "-ranges", "0-0x100"}, settings, stdin, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Unexpected exit code %v: %v", code, stderr.String())
+	}
+	var record cliRecord
+	err := json.Unmarshal(stdout.Bytes(), &record)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	info := record.Entropy
+	if record.Size != uint64(len(content)) || info.BlockSize != 512 || info.BlockCount != 600 || len(info.Blocks) != 600 {
+		t.Errorf("Unexpected blocks, got: %v %v %v", record.Size, info.BlockSize, info.BlockCount)
+	}
+	if info.Blocks[0] != 0 || info.Blocks[599] < 7 {
+		t.Errorf("Unexpected block entropy, got: %v %v", info.Blocks[0], info.Blocks[599])
+	}
+	// The tail is kept as stdin is read.
+	ranges := info.Ranges
+	if len(ranges) != 2 || ranges[0].Label != "tail" || ranges[0].Offset != uint64(len(content)-4096) || ranges[0].Entropy < 7.9 {
+		t.Errorf("Unexpected ranges, got: %+v", ranges)
+	}
+
+	// Ranges outside the head and tail can't be read.
+	stdout.Reset()
+	code = runCli([]string{"-ranges", "0x20000-0x20100"}, settings, struct{ io.Reader }{bytes.NewReader(content)}, &stdout, &stderr)
+	if code != 1 || !strings.Contains(stderr.String(), "head and tail") {
+		t.Errorf("Expected the range outside the head and tail to be reported, got: %v %v", code, stderr.String())
+	}
+}
+
+func TestCliSymlinks(t *testing.T) {
+	dir := writeCliFiles(t)
+	links := t.TempDir()
+	for link, target := range map[string]string{"file": filepath.Join(dir, "a.bin"), "dir": dir} {
+		err := os.Symlink(target, filepath.Join(links, link))
+		if err != nil {
+			t.Fatalf("error %v", err)
+		}
+	}
+	// A link inside a directory that would loop back to it.
+	err := os.Symlink(dir, filepath.Join(dir, "nested", "loop"))
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	var stdout, stderr bytes.Buffer
+	code := runCli([]string{"-format", "csv", filepath.Join(links, "file"), filepath.Join(links, "dir")}, NewDefaultEntropySettings(), nil, &stdout, &stderr)
+	// Links given as paths are followed, the link to a directory within the walk is reported rather than followed.
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if code != 1 || len(lines) != 4 {
+		t.Fatalf("Unexpected output %v: %v", code, stdout.String())
+	}
+	if !strings.HasPrefix(lines[1], filepath.Join(links, "file")+",") || !strings.HasPrefix(lines[2], filepath.Join(links, "dir", "a.bin")+",") {
+		t.Errorf("Expected the linked files, got: %v", stdout.String())
+	}
+	if expected := filepath.Join(links, "dir", "nested", "loop") + ": " + errNotRegular.Error(); strings.TrimSpace(stderr.String()) != expected {
+		t.Errorf("Expected the link to a directory to be reported, got: %v", stderr.String())
+	}
+}
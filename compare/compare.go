@@ -0,0 +1,293 @@
+/*
+Compare the entropy profiles of two files, such as a suspected trojanised binary and its clean original.
+Profiles are aligned with dynamic time warping, so content inserted into or removed from one of the files stretches the
+alignment instead of making every block after it differ. Both profiles are first resampled to the same number of bytes
+per block, so files analysed with different block sizes line up, and to at most Options.MaxBlocks blocks, as aligning
+takes memory for every pair of blocks.
+*/
+package compare
+
+import (
+	"math"
+
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/sections"
+)
+
+// Difference in entropy between aligned blocks above which they are divergent, when no threshold is given.
+const DefaultThreshold = 1.0
+
+// Most blocks of each profile aligned when no maximum is given, taking 16MiB to align.
+const DefaultMaxBlocks = 4096
+
+// Entropy profile of one of the files compared.
+type Profile struct {
+	Blocks    []float64
+	BlockSize uint64
+	// Length of the file, the end of the last block.
+	Size uint64
+	// Sections of the file where its structure is known, compared by name.
+	Sections []sections.Section
+}
+
+type Options struct {
+	// Minimum difference in entropy between aligned blocks for them to be divergent, DefaultThreshold if zero.
+	Threshold float64
+	// Most blocks of each profile aligned, DefaultMaxBlocks if zero. Longer profiles are resampled to larger blocks.
+	MaxBlocks int
+}
+
+// Blocks of the two files aligned with each other.
+type Step struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+// A run of aligned blocks whose entropy differs by more than the threshold.
+type Divergence struct {
+	// Range of each file covered by the run of blocks.
+	AOffset uint64 `json:"a_offset"`
+	ASize   uint64 `json:"a_size"`
+	BOffset uint64 `json:"b_offset"`
+	BSize   uint64 `json:"b_size"`
+	// Mean change in entropy from the first file to the second over the run.
+	Delta float64 `json:"delta"`
+}
+
+// Entropy of a section in each file. Sizes are zero for a file without the section.
+type SectionDelta struct {
+	Name     string  `json:"name"`
+	AOffset  uint64  `json:"a_offset"`
+	ASize    uint64  `json:"a_size"`
+	AEntropy float64 `json:"a_entropy"`
+	BOffset  uint64  `json:"b_offset"`
+	BSize    uint64  `json:"b_size"`
+	BEntropy float64 `json:"b_entropy"`
+	// Change in entropy from the first file to the second, zero unless both files have the section.
+	Delta float64 `json:"delta"`
+}
+
+type Result struct {
+	// Fraction of aligned blocks within the threshold of each other, 1 when nothing diverges.
+	Similarity float64 `json:"similarity"`
+	// Mean difference in entropy between aligned blocks, 0 for identical profiles.
+	Distance float64 `json:"distance"`
+	// Aligned blocks from the start of both files to the end, empty if either profile has no blocks. The blocks are
+	// those of the resampled profiles, see BlockSize.
+	Path []Step `json:"path"`
+	// Bytes per block of both profiles once resampled.
+	BlockSize uint64         `json:"block_size"`
+	Divergent []Divergence   `json:"divergent"`
+	Sections  []SectionDelta `json:"sections"`
+}
+
+// Moves through the cost matrix, recorded to trace the alignment back from the end of both profiles.
+const (
+	moveDiagonal byte = iota
+	// Next block of the first profile aligned with the same block of the second, content removed from the second.
+	moveA
+	// Next block of the second profile aligned with the same block of the first, content inserted into the second.
+	moveB
+)
+
+// Align the profiles and report how similar they are, where they diverge and how the entropy of each section changed.
+func Compare(a Profile, b Profile, options Options) Result {
+	threshold := options.Threshold
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+	maxBlocks := options.MaxBlocks
+	if maxBlocks <= 0 {
+		maxBlocks = DefaultMaxBlocks
+	}
+	// Sections are measured on the profiles as given, which are at least as fine as the resampled ones.
+	sectionDeltas := compareSections(a, b)
+	blockSize := commonBlockSize(a, b, maxBlocks)
+	a, b = a.Resample(blockSize), b.Resample(blockSize)
+	result := Result{Path: align(a.Blocks, b.Blocks), BlockSize: blockSize, Divergent: []Divergence{}, Sections: sectionDeltas}
+	if len(result.Path) == 0 {
+		if len(a.Blocks) == 0 && len(b.Blocks) == 0 {
+			result.Similarity = 1
+		} else {
+			// Everything in the file with content diverges from nothing.
+			result.Divergent = append(result.Divergent, Divergence{ASize: a.Size, BSize: b.Size})
+		}
+		return result
+	}
+
+	var total float64
+	matching := 0
+	// Index in the path of the start of the current divergent run, -1 outside a run.
+	start := -1
+	var runSum float64
+	for i, step := range result.Path {
+		delta := b.Blocks[step.B] - a.Blocks[step.A]
+		total += math.Abs(delta)
+		if math.Abs(delta) <= threshold {
+			matching++
+			start = -1
+			continue
+		}
+		if start < 0 {
+			start, runSum = i, 0
+			result.Divergent = append(result.Divergent, Divergence{})
+		}
+		runSum += delta
+		run := &result.Divergent[len(result.Divergent)-1]
+		run.AOffset, run.ASize = blockRange(a, result.Path[start].A, step.A)
+		run.BOffset, run.BSize = blockRange(b, result.Path[start].B, step.B)
+		run.Delta = runSum / float64(i-start+1)
+	}
+	result.Similarity = float64(matching) / float64(len(result.Path))
+	result.Distance = total / float64(len(result.Path))
+	return result
+}
+
+// Bytes per block both profiles are resampled to, the larger of their block sizes unless that gives either more than
+// maxBlocks blocks.
+func commonBlockSize(a Profile, b Profile, maxBlocks int) uint64 {
+	covered := max(uint64(len(a.Blocks))*a.BlockSize, uint64(len(b.Blocks))*b.BlockSize)
+	return max(a.BlockSize, b.BlockSize, (covered+uint64(maxBlocks)-1)/uint64(maxBlocks))
+}
+
+// Profile with blockSize bytes per block covering the same bytes as the blocks of the profile, the entropy of each
+// being the MeanEntropy of the bytes it covers. The last block is short when the bytes don't divide into blocks.
+// Entropy isn't additive, so this only approximates the entropy of the larger blocks.
+func (p Profile) Resample(blockSize uint64) Profile {
+	if blockSize == 0 || p.BlockSize == 0 || blockSize == p.BlockSize {
+		return p
+	}
+	covered := uint64(len(p.Blocks)) * p.BlockSize
+	resampled := p
+	resampled.BlockSize = blockSize
+	resampled.Blocks = make([]float64, 0, (covered+blockSize-1)/blockSize)
+	for offset := uint64(0); offset < covered; offset += blockSize {
+		resampled.Blocks = append(resampled.Blocks, p.MeanEntropy(offset, min(blockSize, covered-offset)))
+	}
+	return resampled
+}
+
+// Warping path with the least total difference in entropy, aligning the first and last blocks of both profiles.
+func align(a []float64, b []float64) []Step {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return []Step{}
+	}
+	moves := make([]byte, n*m)
+	previous := make([]float64, m)
+	current := make([]float64, m)
+	for i := range n {
+		for j := range m {
+			cost := math.Abs(a[i] - b[j])
+			switch {
+			case i == 0 && j == 0:
+				current[j] = cost
+				moves[j] = moveDiagonal
+			case i == 0:
+				current[j] = cost + current[j-1]
+				moves[j] = moveB
+			case j == 0:
+				current[j] = cost + previous[j]
+				moves[i*m] = moveA
+			default:
+				// Prefer the diagonal on ties so identical profiles align block for block.
+				best, move := previous[j-1], moveDiagonal
+				if previous[j] < best {
+					best, move = previous[j], moveA
+				}
+				if current[j-1] < best {
+					best, move = current[j-1], moveB
+				}
+				current[j] = cost + best
+				moves[i*m+j] = move
+			}
+		}
+		previous, current = current, previous
+	}
+
+	path := make([]Step, 0, max(n, m))
+	i, j := n-1, m-1
+	for {
+		path = append(path, Step{A: i, B: j})
+		if i == 0 && j == 0 {
+			break
+		}
+		switch moves[i*m+j] {
+		case moveDiagonal:
+			i, j = i-1, j-1
+		case moveA:
+			i--
+		case moveB:
+			j--
+		}
+	}
+	for left, right := 0, len(path)-1; left < right; left, right = left+1, right-1 {
+		path[left], path[right] = path[right], path[left]
+	}
+	return path
+}
+
+// Offset and size of the bytes covered by the blocks from first to last (inclusive), clamped to the file.
+func blockRange(p Profile, first int, last int) (uint64, uint64) {
+	first, last = min(first, last), max(first, last)
+	offset := min(uint64(first)*p.BlockSize, p.Size)
+	end := min(uint64(last+1)*p.BlockSize, p.Size)
+	return offset, end - offset
+}
+
+// Pair up the sections of the files by name, in the order of the first file followed by those only in the second.
+// Sections sharing a name are paired in the order they appear.
+func compareSections(a Profile, b Profile) []SectionDelta {
+	result := []SectionDelta{}
+	unmatched := map[string][]sections.Section{}
+	for _, section := range b.Sections {
+		unmatched[section.Name] = append(unmatched[section.Name], section)
+	}
+	for _, section := range a.Sections {
+		delta := SectionDelta{
+			Name:     section.Name,
+			AOffset:  section.Offset,
+			ASize:    section.Size,
+			AEntropy: a.MeanEntropy(section.Offset, section.Size),
+		}
+		if candidates := unmatched[section.Name]; len(candidates) > 0 {
+			other := candidates[0]
+			unmatched[section.Name] = candidates[1:]
+			delta.BOffset, delta.BSize = other.Offset, other.Size
+			delta.BEntropy = b.MeanEntropy(other.Offset, other.Size)
+			delta.Delta = delta.BEntropy - delta.AEntropy
+		}
+		result = append(result, delta)
+	}
+	for _, section := range b.Sections {
+		candidates := unmatched[section.Name]
+		if len(candidates) == 0 || candidates[0] != section {
+			continue
+		}
+		unmatched[section.Name] = candidates[1:]
+		result = append(result, SectionDelta{
+			Name:     section.Name,
+			BOffset:  section.Offset,
+			BSize:    section.Size,
+			BEntropy: b.MeanEntropy(section.Offset, section.Size),
+		})
+	}
+	return result
+}
+
+// Entropy of the blocks overlapping a range of the file, weighted by how much of each block is in the range.
+func (p Profile) MeanEntropy(offset uint64, size uint64) float64 {
+	if p.BlockSize == 0 {
+		return 0
+	}
+	end := offset + size
+	var sum, weight float64
+	for i := offset / p.BlockSize; i < uint64(len(p.Blocks)) && i*p.BlockSize < end; i++ {
+		overlap := min(end, (i+1)*p.BlockSize) - max(offset, i*p.BlockSize)
+		sum += p.Blocks[i] * float64(overlap)
+		weight += float64(overlap)
+	}
+	if weight == 0 {
+		return 0
+	}
+	return sum / weight
+}
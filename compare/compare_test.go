@@ -0,0 +1,167 @@
+package compare
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/sections"
+)
+
+var original = Profile{
+	Blocks:    []float64{1, 1, 5, 5, 6, 2, 2},
+	BlockSize: 100,
+	Size:      700,
+	Sections: []sections.Section{
+		{Name: ".text", Offset: 200, Size: 300},
+		{Name: ".data", Offset: 500, Size: 200},
+	},
+}
+
+func TestCompareIdentical(t *testing.T) {
+	result := Compare(original, original, Options{})
+	if result.Similarity != 1 || result.Distance != 0 || len(result.Divergent) != 0 {
+		t.Errorf("Expected identical profiles to match, got: %+v", result)
+	}
+	for i, step := range result.Path {
+		if step.A != i || step.B != i {
+			t.Fatalf("Expected blocks to align one to one, got: %v", result.Path)
+		}
+	}
+	for _, section := range result.Sections {
+		if section.Delta != 0 || section.ASize != section.BSize {
+			t.Errorf("Unexpected section delta, got: %+v", section)
+		}
+	}
+}
+
+func TestCompareInsertion(t *testing.T) {
+	// Two blocks of encrypted content inserted after the code, moving the data section.
+	trojan := Profile{
+		Blocks:    []float64{1, 1, 5, 5, 6, 7.9, 8, 2, 2},
+		BlockSize: 100,
+		Size:      900,
+		Sections: []sections.Section{
+			{Name: ".text", Offset: 200, Size: 300},
+			{Name: ".evil", Offset: 500, Size: 200},
+			{Name: ".data", Offset: 700, Size: 200},
+		},
+	}
+	result := Compare(original, trojan, Options{})
+	// The blocks after the insertion still align with the original.
+	last := result.Path[len(result.Path)-1]
+	if last.A != 6 || last.B != 8 || len(result.Path) != 9 {
+		t.Errorf("Unexpected path, got: %v", result.Path)
+	}
+	expected := []Divergence{{AOffset: 400, ASize: 100, BOffset: 500, BSize: 200, Delta: 1.95}}
+	if len(result.Divergent) != 1 || math.Abs(result.Divergent[0].Delta-expected[0].Delta) > 1e-9 {
+		t.Fatalf("Unexpected divergent regions, got: %+v", result.Divergent)
+	}
+	expected[0].Delta = result.Divergent[0].Delta
+	if !reflect.DeepEqual(result.Divergent, expected) {
+		t.Errorf("Unexpected divergent regions, got: %+v", result.Divergent)
+	}
+	if math.Abs(result.Similarity-7.0/9) > 1e-9 {
+		t.Errorf("Unexpected similarity, got: %v", result.Similarity)
+	}
+
+	if len(result.Sections) != 3 {
+		t.Fatalf("Unexpected sections, got: %+v", result.Sections)
+	}
+	if text := result.Sections[0]; text.Name != ".text" || math.Abs(text.AEntropy-16.0/3) > 1e-9 || text.Delta != 0 {
+		t.Errorf("Unexpected .text delta, got: %+v", text)
+	}
+	if data := result.Sections[1]; data.Name != ".data" || data.AOffset != 500 || data.BOffset != 700 || data.Delta != 0 {
+		t.Errorf("Unexpected .data delta, got: %+v", data)
+	}
+	// Sections only in the second file are reported after the rest.
+	if evil := result.Sections[2]; evil.Name != ".evil" || evil.ASize != 0 || evil.BSize != 200 || evil.BEntropy != 7.95 {
+		t.Errorf("Unexpected .evil delta, got: %+v", evil)
+	}
+}
+
+func TestCompareThreshold(t *testing.T) {
+	modified := original
+	modified.Blocks = []float64{1, 1, 5, 5, 6, 3.5, 3.5}
+	if result := Compare(original, modified, Options{}); len(result.Divergent) != 1 || result.Divergent[0].AOffset != 500 {
+		t.Errorf("Expected a divergent region at the data, got: %+v", result.Divergent)
+	}
+	if result := Compare(original, modified, Options{Threshold: 2}); len(result.Divergent) != 0 || result.Similarity != 1 {
+		t.Errorf("Expected no divergent regions within the threshold, got: %+v", result.Divergent)
+	}
+}
+
+func TestCompareBlockSizes(t *testing.T) {
+	// The original with half the bytes per block.
+	fine := Profile{BlockSize: 50, Size: 700, Sections: original.Sections}
+	for _, block := range original.Blocks {
+		fine.Blocks = append(fine.Blocks, block, block)
+	}
+	result := Compare(fine, original, Options{})
+	if result.BlockSize != 100 || len(result.Path) != 7 || result.Similarity != 1 || result.Distance != 0 {
+		t.Errorf("Expected the profiles to be resampled to the same blocks, got: %+v", result)
+	}
+	for _, section := range result.Sections {
+		if section.Delta != 0 {
+			t.Errorf("Unexpected section delta, got: %+v", section)
+		}
+	}
+}
+
+func TestCompareMaxBlocks(t *testing.T) {
+	long := Profile{BlockSize: 100, Size: 1000000}
+	for i := range 10000 {
+		long.Blocks = append(long.Blocks, float64(i%8))
+	}
+	result := Compare(long, long, Options{MaxBlocks: 300})
+	// 10000 blocks of 100 bytes in blocks of at least 3334 bytes, the last being short.
+	if result.BlockSize != 3334 || len(result.Path) != 300 || result.Similarity != 1 {
+		t.Errorf("Expected the profiles to be resampled to the maximum blocks, got: %v %v %v", result.BlockSize, len(result.Path), result.Similarity)
+	}
+	modified := long
+	modified.Blocks = append([]float64{}, long.Blocks...)
+	for i := 5000; i < 6000; i++ {
+		modified.Blocks[i] = 8
+	}
+	result = Compare(long, modified, Options{MaxBlocks: 300})
+	// The bytes changed from 500000 to 600000 are in the resampled blocks from 500100 to 600120, the block before them
+	// being mostly unchanged.
+	if len(result.Divergent) != 1 || result.Divergent[0].BOffset != 500100 || result.Divergent[0].BSize != 100020 {
+		t.Errorf("Expected the divergent region in bytes of the file, got: %+v", result.Divergent)
+	}
+}
+
+func TestResample(t *testing.T) {
+	resampled := original.Resample(300)
+	expected := []float64{7.0 / 3, 13.0 / 3, 2}
+	if resampled.BlockSize != 300 || resampled.Size != 700 || len(resampled.Blocks) != len(expected) {
+		t.Fatalf("Unexpected profile, got: %+v", resampled)
+	}
+	for i, block := range expected {
+		if math.Abs(resampled.Blocks[i]-block) > 1e-9 {
+			t.Errorf("Unexpected blocks, got: %v", resampled.Blocks)
+		}
+	}
+}
+
+func TestCompareEmpty(t *testing.T) {
+	result := Compare(Profile{}, Profile{}, Options{})
+	if result.Similarity != 1 || len(result.Divergent) != 0 {
+		t.Errorf("Expected empty profiles to match, got: %+v", result)
+	}
+	result = Compare(Profile{}, original, Options{})
+	expected := []Divergence{{BSize: 700}}
+	if result.Similarity != 0 || !reflect.DeepEqual(result.Divergent, expected) {
+		t.Errorf("Expected the whole file to diverge, got: %+v", result)
+	}
+}
+
+func TestMeanEntropy(t *testing.T) {
+	// Half of block 1 and all of block 2.
+	if value := original.MeanEntropy(150, 150); math.Abs(value-11.0/3) > 1e-9 {
+		t.Errorf("Unexpected mean entropy, got: %v", value)
+	}
+	if value := original.MeanEntropy(800, 100); value != 0 {
+		t.Errorf("Expected no entropy past the end, got: %v", value)
+	}
+}
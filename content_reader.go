@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+// Number of bytes from the start of the binary kept in memory, enough for the headers of most executables.
+var contentHeadSize = 64 * 1024
+
+// Returned for reads outside the head and tail of content that can only be read once.
+var errContentNotKept = errors.New("only the head and tail of content of unknown length are kept")
+
+// Random access to the content of a binary, used to parse headers without downloading the whole binary.
+// Reads within the head and tail are served from memory, anything else is downloaded as a chunk. Without a source,
+// as for content of unknown length that can only be read once, reads outside the head and tail fail.
+type contentReader struct {
+	source ContentSource
+	size   uint64
+	head   []byte
+	// Last tailSize bytes of the chunks passed to appendChunk, ending at end.
+	tail     []byte
+	tailSize uint64
+	end      uint64
+}
+
+func newContentReader(source ContentSource, size uint64) *contentReader {
+	return &contentReader{source: source, size: size}
+}
+
+// Keep the start of the binary from the first chunk downloaded.
+func (r *contentReader) setHead(chunk []byte) {
+	r.head = append([]byte{}, chunk[:min(len(chunk), contentHeadSize)]...)
+}
+
+// Keep the last size bytes of the chunks as they are passed to appendChunk, so reading the end of the binary doesn't
+// download it again. The size of the binary doesn't need to be known.
+func (r *contentReader) keepTail(size uint64) {
+	r.tailSize = size
+	r.tail = make([]byte, 0, size)
+}
+
+// Keep the bytes of the next chunk that are in the tail.
+func (r *contentReader) appendChunk(chunk []byte) {
+	r.end += uint64(len(chunk))
+	if r.tailSize == 0 {
+		return
+	}
+	if uint64(len(chunk)) >= r.tailSize {
+		r.tail = append(r.tail[:0], chunk[uint64(len(chunk))-r.tailSize:]...)
+		return
+	}
+	r.tail = append(r.tail, chunk...)
+	if uint64(len(r.tail)) > r.tailSize {
+		r.tail = r.tail[:copy(r.tail, r.tail[uint64(len(r.tail))-r.tailSize:])]
+	}
+}
+
+func (r *contentReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || uint64(off) >= r.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	end := min(uint64(off)+uint64(len(p)), r.size)
+	var n int
+	if end <= uint64(len(r.head)) {
+		n = copy(p, r.head[off:end])
+	} else if tailOffset := r.end - uint64(len(r.tail)); len(r.tail) > 0 && uint64(off) >= tailOffset && end <= r.end {
+		n = copy(p, r.tail[uint64(off)-tailOffset:end-tailOffset])
+	} else if r.source == nil {
+		return 0, errContentNotKept
+	} else {
+		// Chunk ends are inclusive.
+		chunk, _, pluginErr := r.source.GetContentChunk(uint64(off), end-1)
+		if pluginErr != nil {
+			return 0, pluginErr
+		}
+		n = copy(p, chunk)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
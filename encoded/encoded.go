@@ -0,0 +1,382 @@
+/*
+Detect runs of text encoded with a restricted alphabet (hex, base32, base64 and ascii85) and calculate the entropy of
+the decoded bytes.
+Decoding is done while the bytes are appended so arbitrarily long blobs can be measured without holding them in memory.
+*/
+package encoded
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/entropy"
+)
+
+type Encoding string
+
+const (
+	EncodingHex     Encoding = "hex"
+	EncodingBase32  Encoding = "base32"
+	EncodingBase64  Encoding = "base64"
+	EncodingAscii85 Encoding = "ascii85"
+)
+
+// An encoded region of the file.
+type Blob struct {
+	// Offset of the first encoded character in the file.
+	Offset uint64
+	// Number of bytes the encoded text occupies in the file, including line breaks and delimiters.
+	Size     uint64
+	Encoding Encoding
+	// Number of bytes produced by decoding the blob.
+	DecodedLength uint64
+	// Shannon's entropy of the decoded bytes.
+	DecodedEntropy float64
+}
+
+// Thresholds controlling which blobs are reported.
+type Options struct {
+	// Minimum number of encoded characters for a blob to be reported.
+	MinLength int
+	// Maximum number of blobs kept, the blobs with the highest decoded entropy are kept.
+	MaxBlobs int
+}
+
+// Decodes a stream of characters into bits, counting the decoded bytes.
+type decoder struct {
+	valid  bool
+	bits   uint
+	nbits  uint
+	length uint64
+	counts [256]int
+}
+
+// Add the value of the next character, which holds width bits.
+func (d *decoder) add(value uint, width uint) {
+	d.bits = (d.bits << width) | value
+	d.nbits += width
+	if d.nbits >= 8 {
+		d.nbits -= 8
+		d.counts[byte(d.bits>>d.nbits)]++
+		d.length += 1
+		d.bits &= (1 << d.nbits) - 1
+	}
+}
+
+func (d *decoder) reset() {
+	*d = decoder{valid: true}
+}
+
+// A run of base64 alphabet characters, decoded as hex, base32 and base64 until it can't be any of them.
+type alphabetRun struct {
+	start uint64
+	// Number of bytes covered by the run, including line breaks.
+	size uint64
+	// Number of encoded characters in the run.
+	chars int
+	// Number of line breaks since the last encoded character.
+	trailing uint64
+	padded   bool
+	// Whether characters only found in the standard or url safe base64 alphabets have been seen.
+	standard bool
+	urlSafe  bool
+	// Character classes seen, real encoded data mixes them where identifiers and repeated characters don't.
+	hasDigit bool
+	hasUpper bool
+	hasLower bool
+	hex      decoder
+	base32   decoder
+	base64   decoder
+}
+
+// A run of ascii85 characters between '<~' and '~>' delimiters.
+type ascii85Run struct {
+	active bool
+	start  uint64
+	group  [5]uint32
+	nchars int
+	chars  int
+	dec    decoder
+}
+
+// Scanner finds encoded blobs in bytes appended in order.
+type Scanner struct {
+	options Options
+	offset  uint64
+	run     alphabetRun
+	a85     ascii85Run
+	// Last byte seen, needed to find ascii85 delimiters split across appends.
+	previous byte
+	blobs    blobHeap
+}
+
+// Create a new Scanner that reports blobs matching the provided options.
+func NewScanner(options Options) *Scanner {
+	s := &Scanner{options: options}
+	s.resetRun()
+	return s
+}
+
+// Append the next bytes of the file to the scanner, measuring any blobs completed by the bytes.
+func (s *Scanner) Append(buf []byte) {
+	for _, b := range buf {
+		s.appendAlphabet(b)
+		s.appendAscii85(b)
+		s.previous = b
+		s.offset += 1
+	}
+}
+
+// Return the blobs with the highest decoded entropy, sorted from highest to lowest decoded entropy.
+// Expected to be called once the whole file has been appended.
+func (s *Scanner) Blobs() []Blob {
+	s.flushRun()
+	result := make([]Blob, len(s.blobs))
+	copy(result, s.blobs)
+	sort.SliceStable(result, func(i, j int) bool {
+		return ranksBelow(result[j], result[i])
+	})
+	return result
+}
+
+func (s *Scanner) appendAlphabet(b byte) {
+	// Line breaks are allowed inside a blob (e.g. PEM), but don't start one.
+	// Url safe text isn't wrapped, so a line break ends it.
+	if (b == '\n' || b == '\r') && s.run.chars > 0 && !s.run.urlSafe {
+		s.run.size += 1
+		s.run.trailing += 1
+		return
+	}
+	value, ok := base64Value(b)
+	standard := b == '+' || b == '/'
+	urlSafe := b == '-' || b == '_'
+	// Padding ends the blob, so anything following it starts a new one.
+	// The standard and url safe alphabets can't be mixed, so switching between them starts a new blob.
+	if !ok || (s.run.padded && b != '=') || (standard && s.run.urlSafe) || (urlSafe && s.run.standard) {
+		s.flushRun()
+		if !ok {
+			return
+		}
+	}
+	if s.run.chars == 0 {
+		s.run.start = s.offset
+	}
+	s.run.chars += 1
+	s.run.size += 1
+	s.run.trailing = 0
+	s.run.standard = s.run.standard || standard
+	s.run.urlSafe = s.run.urlSafe || urlSafe
+	s.run.hasDigit = s.run.hasDigit || (b >= '0' && b <= '9')
+	s.run.hasUpper = s.run.hasUpper || (b >= 'A' && b <= 'Z')
+	s.run.hasLower = s.run.hasLower || (b >= 'a' && b <= 'z')
+	if b == '=' {
+		s.run.padded = true
+		s.run.hex.valid = false
+		return
+	}
+	s.run.base64.add(value, 6)
+	if s.run.hex.valid {
+		if hexValue, ok := hexValue(b); ok {
+			s.run.hex.add(hexValue, 4)
+		} else {
+			s.run.hex.valid = false
+		}
+	}
+	if s.run.base32.valid {
+		if base32Value, ok := base32Value(b); ok {
+			s.run.base32.add(base32Value, 5)
+		} else {
+			s.run.base32.valid = false
+		}
+	}
+}
+
+// End the current alphabet run, keeping it as a blob if it is long enough.
+func (s *Scanner) flushRun() {
+	defer s.resetRun()
+	if s.run.chars < s.options.MinLength || s.run.chars == 0 {
+		return
+	}
+	// Prefer the smallest alphabet the run fits, as hex and base32 text is also valid base64.
+	encoding, dec := EncodingBase64, &s.run.base64
+	plausible := s.run.hasDigit && s.run.hasUpper && s.run.hasLower
+	if s.run.hex.valid {
+		encoding, dec = EncodingHex, &s.run.hex
+		plausible = s.run.hasDigit && (s.run.hasUpper || s.run.hasLower)
+	} else if s.run.base32.valid {
+		encoding, dec = EncodingBase32, &s.run.base32
+		plausible = s.run.hasDigit && s.run.hasUpper
+	}
+	if !plausible {
+		return
+	}
+	// Trailing line breaks aren't part of the blob.
+	s.keep(Blob{
+		Offset:         s.run.start,
+		Size:           s.run.size - s.run.trailing,
+		Encoding:       encoding,
+		DecodedLength:  dec.length,
+		DecodedEntropy: entropy.CountsValue(dec.counts),
+	})
+}
+
+func (s *Scanner) resetRun() {
+	s.run = alphabetRun{}
+	s.run.hex.reset()
+	s.run.base32.reset()
+	s.run.base64.reset()
+}
+
+func (s *Scanner) appendAscii85(b byte) {
+	if !s.a85.active {
+		if s.previous == '<' && b == '~' {
+			s.a85 = ascii85Run{active: true, start: s.offset - 1}
+			s.a85.dec.reset()
+		}
+		return
+	}
+	switch {
+	case b == '~':
+		// Wait for the closing '>'.
+	case b == '>' && s.previous == '~':
+		s.flushAscii85()
+	case b == ' ' || b == '\t' || b == '\n' || b == '\r':
+	case b == 'z' && s.a85.nchars == 0:
+		s.a85.chars += 1
+		for i := 0; i < 4; i++ {
+			s.a85.dec.add(0, 8)
+		}
+	case b >= '!' && b <= 'u':
+		s.a85.chars += 1
+		s.a85.group[s.a85.nchars] = uint32(b - '!')
+		s.a85.nchars += 1
+		if s.a85.nchars == 5 {
+			s.decodeAscii85Group(4)
+		}
+	default:
+		s.a85.active = false
+	}
+}
+
+// Decode the current ascii85 group, producing up to outputBytes bytes.
+func (s *Scanner) decodeAscii85Group(outputBytes int) {
+	var value uint32
+	for i := 0; i < 5; i++ {
+		value = value*85 + s.a85.group[i]
+	}
+	for i := 0; i < outputBytes; i++ {
+		s.a85.dec.add(uint((value>>(24-8*i))&0xff), 8)
+	}
+	s.a85.nchars = 0
+}
+
+// End the ascii85 blob at the closing delimiter, keeping it if it is long enough.
+func (s *Scanner) flushAscii85() {
+	s.a85.active = false
+	// A partial final group is padded with 'u' and produces one less byte than it has characters.
+	if s.a85.nchars > 1 {
+		partial := s.a85.nchars
+		for i := partial; i < 5; i++ {
+			s.a85.group[i] = 'u' - '!'
+		}
+		s.decodeAscii85Group(partial - 1)
+	}
+	if s.a85.chars < s.options.MinLength {
+		return
+	}
+	s.keep(Blob{
+		Offset:         s.a85.start,
+		Size:           s.offset + 1 - s.a85.start,
+		Encoding:       EncodingAscii85,
+		DecodedLength:  s.a85.dec.length,
+		DecodedEntropy: entropy.CountsValue(s.a85.dec.counts),
+	})
+}
+
+// Keep the blob if there is space for it or it beats the lowest ranked blob.
+func (s *Scanner) keep(blob Blob) {
+	if s.options.MaxBlobs <= 0 {
+		return
+	}
+	if len(s.blobs) < s.options.MaxBlobs {
+		heap.Push(&s.blobs, blob)
+		return
+	}
+	if ranksBelow(s.blobs[0], blob) {
+		s.blobs[0] = blob
+		heap.Fix(&s.blobs, 0)
+	}
+}
+
+// Calculates the Shannon's Entropy for the provided counts of decoded bytes.
+func hexValue(b byte) (uint, bool) {
+	switch {
+	case b >= '0' && b <= '9':
+		return uint(b - '0'), true
+	case b >= 'a' && b <= 'f':
+		return uint(b-'a') + 10, true
+	case b >= 'A' && b <= 'F':
+		return uint(b-'A') + 10, true
+	}
+	return 0, false
+}
+
+func base32Value(b byte) (uint, bool) {
+	switch {
+	case b >= 'A' && b <= 'Z':
+		return uint(b - 'A'), true
+	case b >= '2' && b <= '7':
+		return uint(b-'2') + 26, true
+	}
+	return 0, false
+}
+
+// Value of a base64 character, accepting both the standard and url safe alphabets.
+// Padding is accepted with a value of zero.
+func base64Value(b byte) (uint, bool) {
+	switch {
+	case b >= 'A' && b <= 'Z':
+		return uint(b - 'A'), true
+	case b >= 'a' && b <= 'z':
+		return uint(b-'a') + 26, true
+	case b >= '0' && b <= '9':
+		return uint(b-'0') + 52, true
+	case b == '+' || b == '-':
+		return 62, true
+	case b == '/' || b == '_':
+		return 63, true
+	case b == '=':
+		return 0, true
+	}
+	return 0, false
+}
+
+// True if blob a ranks below blob b.
+func ranksBelow(a, b Blob) bool {
+	if a.DecodedEntropy != b.DecodedEntropy {
+		return a.DecodedEntropy < b.DecodedEntropy
+	}
+	if a.DecodedLength != b.DecodedLength {
+		return a.DecodedLength < b.DecodedLength
+	}
+	return a.Offset > b.Offset
+}
+
+// Min-heap of blobs so the lowest ranked blob can be replaced cheaply.
+type blobHeap []Blob
+
+func (h blobHeap) Len() int           { return len(h) }
+func (h blobHeap) Less(i, j int) bool { return ranksBelow(h[i], h[j]) }
+func (h blobHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *blobHeap) Push(x any) {
+	*h = append(*h, x.(Blob))
+}
+
+func (h *blobHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
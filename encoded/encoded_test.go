@@ -0,0 +1,128 @@
+package encoded
+
+import (
+	"encoding/ascii85"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/entropy"
+)
+
+// Deterministic pseudo random bytes standing in for an encrypted payload.
+func randomBytes(length int) []byte {
+	buf := make([]byte, length)
+	rand.New(rand.NewSource(1)).Read(buf)
+	return buf
+}
+
+func ascii85Encode(raw []byte) string {
+	buf := make([]byte, ascii85.MaxEncodedLen(len(raw)))
+	n := ascii85.Encode(buf, raw)
+	return "<~" + string(buf[:n]) + "~>"
+}
+
+func TestScannerEncodings(t *testing.T) {
+	raw := randomBytes(3000)
+	text := []byte(strings.Repeat("The quick brown fox jumps over the lazy dog. ", 20))
+	tables := []struct {
+		encoding Encoding
+		encoded  string
+		raw      []byte
+	}{
+		{EncodingHex, hex.EncodeToString(raw), raw},
+		{EncodingBase32, base32.StdEncoding.EncodeToString(raw[:2999]), raw[:2999]},
+		{EncodingBase64, base64.StdEncoding.EncodeToString(raw[:2998]), raw[:2998]},
+		{EncodingBase64, base64.URLEncoding.EncodeToString(raw), raw},
+		{EncodingBase64, base64.StdEncoding.EncodeToString(text), text},
+		{EncodingAscii85, ascii85Encode(raw[:2997]), raw[:2997]},
+	}
+	for _, table := range tables {
+		prefix := "\x00\x01 data: "
+		input := []byte(prefix + table.encoded + "\x00")
+
+		// Results must not depend on how the bytes are split across appends.
+		for _, sliceSize := range []int{1, 7, 1000, len(input)} {
+			scanner := NewScanner(Options{MinLength: 64, MaxBlobs: 5})
+			for i := 0; i < len(input); i += sliceSize {
+				scanner.Append(input[i:min(i+sliceSize, len(input))])
+			}
+			blobs := scanner.Blobs()
+			if len(blobs) != 1 {
+				t.Fatalf("%v SliceSize %d - Expected one blob, got: %v", table.encoding, sliceSize, blobs)
+			}
+			expected := Blob{
+				Offset:         uint64(len(prefix)),
+				Size:           uint64(len(table.encoded)),
+				Encoding:       table.encoding,
+				DecodedLength:  uint64(len(table.raw)),
+				DecodedEntropy: entropy.New(table.raw).Value(),
+			}
+			if blobs[0] != expected {
+				t.Errorf("%v SliceSize %d - Unexpected Blob expected: %v, got: %v", table.encoding, sliceSize, expected, blobs[0])
+			}
+		}
+	}
+}
+
+func TestScannerLineBreaks(t *testing.T) {
+	raw := randomBytes(600)
+	encoded := base64.StdEncoding.EncodeToString(raw)
+	lines := []string{}
+	for i := 0; i < len(encoded); i += 64 {
+		lines = append(lines, encoded[i:min(i+64, len(encoded))])
+	}
+	pem := "-----BEGIN DATA-----\n" + strings.Join(lines, "\r\n") + "\r\n-----END DATA-----\n"
+
+	scanner := NewScanner(Options{MinLength: 64, MaxBlobs: 5})
+	scanner.Append([]byte(pem))
+	blobs := scanner.Blobs()
+	if len(blobs) != 1 {
+		t.Fatalf("Expected one blob, got: %v", blobs)
+	}
+	expected := Blob{
+		Offset:         21,
+		Size:           uint64(len(strings.Join(lines, "\r\n"))),
+		Encoding:       EncodingBase64,
+		DecodedLength:  600,
+		DecodedEntropy: entropy.New(raw).Value(),
+	}
+	if blobs[0] != expected {
+		t.Errorf("Unexpected Blob expected: %v, got: %v", expected, blobs[0])
+	}
+}
+
+func TestScannerKeepsHighestEntropy(t *testing.T) {
+	raw := randomBytes(300)
+	input := strings.Join([]string{
+		hex.EncodeToString([]byte(strings.Repeat("\x00\xff", 50))),
+		base64.StdEncoding.EncodeToString(raw),
+		hex.EncodeToString([]byte(strings.Repeat("\x00\x01\x02\xff", 50))),
+	}, " ")
+	scanner := NewScanner(Options{MinLength: 64, MaxBlobs: 2})
+	scanner.Append([]byte(input))
+	blobs := scanner.Blobs()
+	if len(blobs) != 2 {
+		t.Fatalf("Expected two blobs, got: %v", blobs)
+	}
+	if blobs[0].Encoding != EncodingBase64 || blobs[0].DecodedEntropy != entropy.New(raw).Value() {
+		t.Errorf("Expected the base64 blob to rank first, got: %v", blobs[0])
+	}
+	if blobs[1].Encoding != EncodingHex || blobs[1].DecodedEntropy != 2 {
+		t.Errorf("Expected the repeated hex blob to rank second, got: %v", blobs[1])
+	}
+}
+
+func TestScannerIgnoresShortRuns(t *testing.T) {
+	scanner := NewScanner(Options{MinLength: 64, MaxBlobs: 5})
+	scanner.Append([]byte("GetProcAddress LoadLibraryA kernel32 <~87cURD]i,\"Ebo80~>"))
+	// Long runs of a single character class aren't encoded data.
+	scanner.Append([]byte(" " + strings.Repeat("a", 100) + " " + strings.Repeat("0", 100) + " GetProcAddressLoadLibraryAVirtualAllocVirtualProtect"))
+	blobs := scanner.Blobs()
+	if len(blobs) != 0 {
+		t.Errorf("Expected no blobs, got: %v", blobs)
+	}
+}
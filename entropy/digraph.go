@@ -0,0 +1,130 @@
+/*
+Count transitions between consecutive bytes (digraphs) over given byte buffers.
+The 256x256 transition matrix fingerprints code, text encodings and compressed data.
+*/
+package entropy
+
+import "math"
+
+// Struct that buffers the transition counts of a binary, continually incrementing the counts as bytes are appended.
+// The matrix is indexed by from*256 + to.
+type DigraphBuffered struct {
+	counts      [256 * 256]uint64
+	total       uint64
+	previous    byte
+	hasPrevious bool
+}
+
+// Scalar features derived from the transition matrix, each is a ratio of all transitions.
+type DigraphStats struct {
+	// Transitions into a null byte.
+	NullTransitionRatio float64
+	// Transitions from a byte to the same byte.
+	RepeatRatio float64
+	// Transitions between two printable ASCII bytes.
+	PrintableRatio float64
+	// Distinct transitions seen out of the 65536 possible.
+	DistinctRatio float64
+}
+
+// Creates a new DigraphBuffered with no transitions counted.
+func NewDigraphBuffered() *DigraphBuffered {
+	return &DigraphBuffered{}
+}
+
+// Appends new data to the DigraphBuffered, counting the transitions including the one from the previous append.
+func (db *DigraphBuffered) AppendAndCount(buf []byte) {
+	if len(buf) == 0 {
+		return
+	}
+	previous := db.previous
+	start := 0
+	if !db.hasPrevious {
+		previous = buf[0]
+		start = 1
+	}
+	for _, b := range buf[start:] {
+		db.counts[int(previous)<<8|int(b)]++
+		previous = b
+	}
+	db.total += uint64(len(buf) - start)
+	db.previous = previous
+	db.hasPrevious = true
+}
+
+// Number of times the byte from was followed by the byte to.
+func (db *DigraphBuffered) Count(from byte, to byte) uint64 {
+	return db.counts[int(from)<<8|int(to)]
+}
+
+// Total number of transitions counted.
+func (db *DigraphBuffered) Total() uint64 {
+	return db.total
+}
+
+// Largest count of any single transition, the count represented by the top quantised level.
+func (db *DigraphBuffered) MaxCount() (maxCount uint64) {
+	for _, count := range db.counts {
+		maxCount = max(maxCount, count)
+	}
+	return maxCount
+}
+
+// Calculate the scalar features of the transition matrix.
+func (db *DigraphBuffered) Stats() DigraphStats {
+	var stats DigraphStats
+	if db.total == 0 {
+		return stats
+	}
+	var nulls, repeats, printable, distinct uint64
+	for idx, count := range db.counts {
+		if count == 0 {
+			continue
+		}
+		from, to := idx>>8, idx&0xff
+		distinct += 1
+		if to == 0 {
+			nulls += count
+		}
+		if from == to {
+			repeats += count
+		}
+		if isPrintable(from) && isPrintable(to) {
+			printable += count
+		}
+	}
+	total := float64(db.total)
+	stats.NullTransitionRatio = float64(nulls) / total
+	stats.RepeatRatio = float64(repeats) / total
+	stats.PrintableRatio = float64(printable) / total
+	stats.DistinctRatio = float64(distinct) / float64(len(db.counts))
+	return stats
+}
+
+// Log scale the transition counts and quantise them into 16 levels, packed two cells per byte (high nibble first).
+// Level 0 is only used for transitions that never occur, any other count is at least level 1.
+func (db *DigraphBuffered) Quantised() []byte {
+	packed := make([]byte, len(db.counts)/2)
+	maxCount := db.MaxCount()
+	if maxCount == 0 {
+		return packed
+	}
+	scale := math.Log1p(float64(maxCount))
+	for idx, count := range db.counts {
+		level := byte(0)
+		if count > 0 {
+			level = byte(max(1, math.Round(math.Log1p(float64(count))/scale*15)))
+		}
+		if idx%2 == 0 {
+			packed[idx/2] = level << 4
+		} else {
+			packed[idx/2] |= level
+		}
+	}
+	return packed
+}
+
+// Printable ASCII characters including common whitespace.
+func isPrintable(b int) bool {
+	return (b >= 0x20 && b < 0x7f) || b == '\t' || b == '\n' || b == '\r'
+}
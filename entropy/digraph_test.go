@@ -0,0 +1,93 @@
+package entropy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDigraphBufferedCounts(t *testing.T) {
+	input := []byte("aab\x00\x00a")
+	// Transitions must not depend on how the bytes are split across appends.
+	for sliceSize := 1; sliceSize <= len(input); sliceSize++ {
+		db := NewDigraphBuffered()
+		for i := 0; i < len(input); i += sliceSize {
+			db.AppendAndCount(input[i:min(i+sliceSize, len(input))])
+		}
+		tables := []struct {
+			from  byte
+			to    byte
+			count uint64
+		}{
+			{'a', 'a', 1},
+			{'a', 'b', 1},
+			{'b', 0, 1},
+			{0, 0, 1},
+			{0, 'a', 1},
+			{'b', 'a', 0},
+		}
+		for _, table := range tables {
+			if count := db.Count(table.from, table.to); count != table.count {
+				t.Errorf("SliceSize %d - Unexpected Count for %q -> %q, expected %v got: %v", sliceSize, table.from, table.to, table.count, count)
+			}
+		}
+		if db.Total() != 5 {
+			t.Errorf("SliceSize %d - Unexpected Total, expected 5 got: %v", sliceSize, db.Total())
+		}
+	}
+}
+
+func TestDigraphBufferedStats(t *testing.T) {
+	tables := []struct {
+		input  []byte
+		output DigraphStats
+	}{
+		{[]byte(""), DigraphStats{}},
+		{[]byte("a"), DigraphStats{}},
+		{[]byte("aab\x00\x00a"), DigraphStats{NullTransitionRatio: 0.4, RepeatRatio: 0.4, PrintableRatio: 0.4, DistinctRatio: 5.0 / 65536}},
+		{[]byte("abababab"), DigraphStats{PrintableRatio: 1, DistinctRatio: 2.0 / 65536}},
+	}
+	for _, table := range tables {
+		db := NewDigraphBuffered()
+		db.AppendAndCount(table.input)
+		stats := db.Stats()
+		if !reflect.DeepEqual(stats, table.output) {
+			t.Errorf("Unexpected Stats for: %q, expected %v got: %v", table.input, table.output, stats)
+		}
+	}
+}
+
+func TestDigraphBufferedQuantised(t *testing.T) {
+	db := NewDigraphBuffered()
+	// 'a' -> 'a' 255 times, 'a' -> 'b' once.
+	input := make([]byte, 257)
+	for i := range input {
+		input[i] = 'a'
+	}
+	input[256] = 'b'
+	db.AppendAndCount(input)
+
+	quantised := db.Quantised()
+	if len(quantised) != 32768 {
+		t.Fatalf("Unexpected Quantised length, got: %v", len(quantised))
+	}
+	if db.MaxCount() != 255 {
+		t.Errorf("Unexpected MaxCount, got: %v", db.MaxCount())
+	}
+	// 'a' -> 'a' at cell 0x6161 (odd, so the low nibble) is the maximum level.
+	if level := quantised[0x6161/2] & 0x0f; level != 15 {
+		t.Errorf("Unexpected level for 'a' -> 'a', got: %v", level)
+	}
+	// 'a' -> 'b' at cell 0x6162 (even, so the high nibble) is log scaled: round(log(2)/log(256)*15) = 2.
+	if level := quantised[0x6162/2] >> 4; level != 2 {
+		t.Errorf("Unexpected level for 'a' -> 'b', got: %v", level)
+	}
+	nonZero := 0
+	for _, b := range quantised {
+		if b != 0 {
+			nonZero++
+		}
+	}
+	if nonZero != 2 {
+		t.Errorf("Expected only two non zero cells, got: %v", nonZero)
+	}
+}
@@ -7,86 +7,231 @@ package entropy
 import (
 	"fmt"
 	"math"
+	"runtime"
+	"sync"
 )
 
 const BufferedMinBlockSize = 256
 
+// Bytes counted by each goroutine when an append is split across workers, smaller appends are counted on the calling
+// goroutine. Variables so tests can exercise the parallel path with small buffers.
+var (
+	parallelMinSize = 1 << 20
+	defaultWorkers  = runtime.GOMAXPROCS(0)
+)
+
 // Struct that buffers a Binaries Entropy and continually increments the counts calculating the Shannon's entropy
-// The chunkEntropies holds the Entropy of all the chunks of a fixed size.
+// The chunkEntropies of each resolution holds the Entropy of all the chunks of a fixed size.
 // The number of bytes in one chunk is calculated based on the total length of the file and the max_block_count which
 // is the maximum number of chunks provided in constructor.
+// Several resolutions (max_block_counts) can be calculated from the same bytes at once, the first is the primary
+// resolution returned by GetChunkEntropySizeAndCount.
+// An EntropyBuffered can also count a segment of the binary starting part way through it, segments are combined with
+// Merge (see entropy_buffered_state.go).
+// When the length isn't known up front the chunk size grows as bytes are appended instead, see NewStreaming.
 type EntropyBuffered struct {
-	contentLength       uint64
+	contentLength uint64
+	// Set when the content length isn't known.
+	streaming bool
+	// Offset of the first byte counted, zero unless counting a segment.
+	offset              uint64
 	actualContentLength uint64
 	totalCount          [256]int
+	resolutions         []*chunkResolution
+	// Maximum number of goroutines counting an append.
+	workers int
+}
+
+// Chunk entropies of a binary at one resolution.
+type chunkResolution struct {
 	// Chunk Entropy Constants
-	size  int
-	count int
+	maxCount int
+	size     int
+	count    int
 	// Chunk Entropy Tracking
-	chunkEntropies    []float64
-	currentChunkCount [256]int
-	chunkSizeSoFar    int
-	chunkCountIdx     int
+	chunkEntropies []float64
+	// Chunks that have only been partly counted, in order. This is the chunk being filled, and when counting a segment
+	// also the first chunk if the segment starts part way through it.
+	partials []partialChunk
+	// Counts of each calculated chunk when the content length isn't known, so adjacent chunks can be merged.
+	chunkCounts [][256]int
+}
+
+// Byte counts of a chunk that has only been partly counted.
+type partialChunk struct {
+	index int
+	size  int
+	count [256]int
+}
+
+// Chunk entropies calculated at one resolution.
+type Resolution struct {
+	// Maximum number of chunks requested.
+	MaxCount int
+	// Bytes in each chunk and the number of chunks.
+	Size  int
+	Count int
+	// Entropy of each chunk.
+	Entropies []float64
 }
 
 // Creates a new BufferedEntropy for a binary that is contentLength bytes long and can have at most max_block_count
 // entropy chunk blocks.
 func NewBuffered(contentLength uint64, max_block_count int) (entropyBuffered *EntropyBuffered) {
-	size, count := calcSizeAndCount(max_block_count, contentLength)
-	return &EntropyBuffered{
+	return NewBufferedWithMinBlockSize(contentLength, max_block_count, BufferedMinBlockSize)
+}
+
+// Creates a new BufferedEntropy like NewBuffered, with blocks of at least minBlockSize bytes rather than
+// BufferedMinBlockSize.
+func NewBufferedWithMinBlockSize(contentLength uint64, max_block_count int, minBlockSize int) (entropyBuffered *EntropyBuffered) {
+	return NewBufferedResolutions(contentLength, minBlockSize, max_block_count)
+}
+
+// Creates a new BufferedEntropy calculating the chunk entropies at each of the max_block_counts from the same bytes,
+// with blocks of at least minBlockSize bytes. The first count is the primary resolution.
+func NewBufferedResolutions(contentLength uint64, minBlockSize int, max_block_counts ...int) (entropyBuffered *EntropyBuffered) {
+	eb := &EntropyBuffered{
 		contentLength:       contentLength,
 		actualContentLength: 0,
-		size:                size,
-		count:               count,
-		chunkEntropies:      make([]float64, count),
-		chunkCountIdx:       0,
+		workers:             defaultWorkers,
 	}
+	for _, max_block_count := range max_block_counts {
+		size, count := calcSizeAndCount(max_block_count, minBlockSize, contentLength)
+		eb.resolutions = append(eb.resolutions, &chunkResolution{
+			maxCount:       max_block_count,
+			size:           size,
+			count:          count,
+			chunkEntropies: make([]float64, count),
+		})
+	}
+	return eb
+}
+
+// Set the maximum number of goroutines counting an append, by default the number of CPUs. Large appends are split at
+// block boundaries and counted in parallel, giving the same results as counting on one goroutine.
+func (eb *EntropyBuffered) SetWorkers(workers int) {
+	eb.workers = max(workers, 1)
 }
 
 // Appends new data to the BufferedEntropy adding to the chunked and total entropy counts.
 // If enough data for one or more chunks to be calculated is provided it calculates the entropy for the chunk(s).
 func (eb *EntropyBuffered) AppendAndCalculateBufferedValues(buf []byte) {
+	pieces := min(eb.workers, len(buf)/parallelMinSize)
+	// The chunk size of content of unknown length changes as it is appended, so it can't be split into segments.
+	if pieces < 2 || eb.streaming {
+		eb.appendSerial(buf)
+		return
+	}
+	// Split at the blocks of the primary resolution, each piece is counted as a segment and the segments merged in
+	// order. Every chunk entropy is calculated from the same counts as a serial append so the results are identical.
+	start := eb.offset + eb.actualContentLength
+	blockSize := uint64(max(eb.resolutions[0].size, 1))
+	step := (uint64(len(buf)) + uint64(pieces) - 1) / uint64(pieces)
+	segments := make([]*EntropyBuffered, 0, pieces)
+	var wg sync.WaitGroup
+	for from := uint64(0); from < uint64(len(buf)); {
+		// Round the end of the piece up to the next block boundary.
+		to := min((start+from+step+blockSize-1)/blockSize*blockSize-start, uint64(len(buf)))
+		segment := eb.emptySegment(start + from)
+		segments = append(segments, segment)
+		wg.Add(1)
+		go func(piece []byte) {
+			defer wg.Done()
+			segment.appendSerial(piece)
+		}(buf[from:to])
+		from = to
+	}
+	wg.Wait()
+	for _, segment := range segments {
+		eb.merge(segment)
+	}
+}
+
+// Create an EntropyBuffered with the same resolutions for the segment starting at offset.
+func (eb *EntropyBuffered) emptySegment(offset uint64) *EntropyBuffered {
+	segment := &EntropyBuffered{contentLength: eb.contentLength, offset: offset, workers: 1}
+	for _, resolution := range eb.resolutions {
+		segment.resolutions = append(segment.resolutions, &chunkResolution{
+			maxCount:       resolution.maxCount,
+			size:           resolution.size,
+			count:          resolution.count,
+			chunkEntropies: make([]float64, resolution.count),
+		})
+	}
+	return segment
+}
+
+// Count the bytes on the calling goroutine.
+func (eb *EntropyBuffered) appendSerial(buf []byte) {
 	for _, b := range buf {
 		// Increment who file entropy counter
 		eb.totalCount[b]++
-		eb.actualContentLength += 1
+	}
+	for _, resolution := range eb.resolutions {
+		if eb.streaming {
+			resolution.appendStreaming(buf)
+			continue
+		}
+		resolution.append(eb.offset+eb.actualContentLength, buf)
+	}
+	eb.actualContentLength += uint64(len(buf))
+}
 
-		// Increment chunk counter and length of chunk
-		eb.currentChunkCount[b]++
-		eb.chunkSizeSoFar += 1
+// Add the bytes at the offset to the chunk counts of the resolution, calculating the entropy of each chunk that is
+// filled.
+func (cr *chunkResolution) append(offset uint64, buf []byte) {
+	for len(buf) > 0 {
+		// Discard left over data that couldn't fit in any blocks.
+		// This occurs if the max_count and content length have a wide gap (refer to readme.md)
+		index := int(offset / uint64(cr.size))
+		if index >= cr.count {
+			return
+		}
+		// Increment chunk counter and length of chunk, up to the end of the chunk.
+		if len(cr.partials) == 0 || cr.partials[len(cr.partials)-1].index != index {
+			cr.partials = append(cr.partials, partialChunk{index: index})
+		}
+		partial := &cr.partials[len(cr.partials)-1]
+		n := min(len(buf), cr.size-int(offset%uint64(cr.size)))
+		for _, b := range buf[:n] {
+			partial.count[b]++
+		}
+		partial.size += n
+		offset += uint64(n)
+		buf = buf[n:]
 
 		// If chunk has hit the max chunk size calculate the entropy for the chunk and clear out chunk counters.
-		if eb.chunkSizeSoFar == eb.size {
-			eb.calcChunkValueAndClearCount(eb.chunkSizeSoFar)
-			eb.chunkSizeSoFar = 0
+		if partial.size == cr.size {
+			cr.calcChunkValueAndClearCount()
 		}
 	}
 }
 
 // Calculate and return the total Entropy of all bytes provided to the EntropyBuffer.
-// Expected to be called once whole file has been appended to the buffer.
+// Expected to be called once whole file has been appended to the buffer, or at the end of content of unknown length.
 func (eb *EntropyBuffered) TotalValue() (float64, error) {
+	if eb.streaming {
+		return calculateEntropy(eb.totalCount, eb.actualContentLength), nil
+	}
+	if eb.offset != 0 {
+		return 0, fmt.Errorf("expected bytes from the start, but got bytes from %d", eb.offset)
+	}
 	if eb.actualContentLength != eb.contentLength {
 		return 0, fmt.Errorf("expected %d bytes, but got %d bytes", eb.contentLength, eb.actualContentLength)
 	}
 	return calculateEntropy(eb.totalCount, eb.contentLength), nil
 }
 
-// Calculate the entropy for the current chunk and clear the current chunks counts.
-// If the max_count has been reached the remaining data is discarded.
-// This occurs if the max_count and content length have a wide gap (refer to readme.md)
-func (eb *EntropyBuffered) calcChunkValueAndClearCount(chunkLength int) {
-	// Discard left over data that couldn't fit in any blocks.
-	if eb.chunkCountIdx >= eb.count {
-		return
-	}
-	entropy := calculateEntropy(eb.currentChunkCount, uint64(chunkLength))
-	eb.chunkEntropies[eb.chunkCountIdx] = entropy
-	eb.chunkCountIdx += 1
+// Calculate the entropy of the bytes appended so far, for when the analysis stops before the whole binary is appended.
+func (eb *EntropyBuffered) PartialValue() float64 {
+	return calculateEntropy(eb.totalCount, eb.actualContentLength)
+}
 
-	for i := 0; i < 256; i++ {
-		eb.currentChunkCount[i] = 0
-	}
+// Calculate the entropy for the last partial chunk, which has been filled, and clear its counts.
+func (cr *chunkResolution) calcChunkValueAndClearCount() {
+	partial := &cr.partials[len(cr.partials)-1]
+	cr.chunkEntropies[partial.index] = calculateEntropy(partial.count, uint64(partial.size))
+	cr.partials = cr.partials[:len(cr.partials)-1]
 }
 
 // Calculates the Shannon's Entropy for the provided count and provided bytes.
@@ -105,15 +250,15 @@ func calculateEntropy(counts [256]int, bufferLength uint64) (answer float64) {
 }
 
 // Calculates the number of blocks to chunk a file of a provided length up to the maximum number of blocks.
-// And with a minimum size of 256bytes per block.
-func calcSizeAndCount(max_count int, contentLength uint64) (int, int) {
+// And with a minimum size of minBlockSize bytes per block.
+func calcSizeAndCount(max_count int, minBlockSize int, contentLength uint64) (int, int) {
 	size := 0
 	if max_count != 0 {
 		size = int(contentLength / uint64(max_count))
 	}
 	count := max_count
-	if size < BufferedMinBlockSize {
-		size = BufferedMinBlockSize
+	if size < minBlockSize {
+		size = minBlockSize
 		count = int(contentLength / uint64(size))
 	}
 	return size, count
@@ -122,5 +267,21 @@ func calcSizeAndCount(max_count int, contentLength uint64) (int, int) {
 // Get all the entropies for the file chunks, and provides the bytes in each chunk as well as the total count of
 // entropies.
 func (eb *EntropyBuffered) GetChunkEntropySizeAndCount() ([]float64, int, int) {
-	return eb.chunkEntropies, eb.size, eb.count
+	primary := eb.resolutions[0]
+	return primary.chunkEntropies, primary.size, primary.count
+}
+
+// Get the chunk entropies at every resolution, in the order of the max_block_counts the BufferedEntropy was created
+// with.
+func (eb *EntropyBuffered) Resolutions() []Resolution {
+	result := make([]Resolution, 0, len(eb.resolutions))
+	for _, resolution := range eb.resolutions {
+		result = append(result, Resolution{
+			MaxCount:  resolution.maxCount,
+			Size:      resolution.size,
+			Count:     resolution.count,
+			Entropies: resolution.chunkEntropies,
+		})
+	}
+	return result
 }
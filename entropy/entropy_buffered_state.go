@@ -0,0 +1,251 @@
+package entropy
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Start of an EntropyBuffered serialised with MarshalBinary, followed by the gob encoded state.
+const bufferedMagic = "AZENTBUF"
+
+const bufferedStateVersion = 1
+
+// Serialisable state of an EntropyBuffered, so counting can be checkpointed and resumed or segments counted elsewhere.
+type bufferedState struct {
+	Version       int               `json:"version"`
+	ContentLength uint64            `json:"content_length"`
+	Offset        uint64            `json:"offset"`
+	Length        uint64            `json:"length"`
+	Counts        [256]int          `json:"counts"`
+	Resolutions   []resolutionState `json:"resolutions"`
+}
+
+type resolutionState struct {
+	MaxCount  int       `json:"max_count"`
+	Size      int       `json:"size"`
+	Count     int       `json:"count"`
+	Entropies []float64 `json:"entropies"`
+	// Chunks only partly counted, with their counts so far.
+	Partials []partialState `json:"partials,omitempty"`
+}
+
+type partialState struct {
+	Index  int      `json:"index"`
+	Size   int      `json:"size"`
+	Counts [256]int `json:"counts"`
+}
+
+// Creates a new BufferedEntropy like NewBufferedResolutions that counts a segment of the binary starting at offset.
+// The chunks the segment starts or ends part way through are kept as counts until the segments either side are merged.
+func NewBufferedSegment(contentLength uint64, offset uint64, minBlockSize int, max_block_counts ...int) (entropyBuffered *EntropyBuffered) {
+	eb := NewBufferedResolutions(contentLength, minBlockSize, max_block_counts...)
+	eb.offset = offset
+	return eb
+}
+
+// Offset of the first byte counted and the number of bytes counted.
+func (eb *EntropyBuffered) Segment() (uint64, uint64) {
+	return eb.offset, eb.actualContentLength
+}
+
+// Merge the counts of the segment that immediately follows this one, as if its bytes had been appended.
+// Both must be counting the same binary at the same resolutions. The other EntropyBuffered is not changed.
+func (eb *EntropyBuffered) Merge(other *EntropyBuffered) error {
+	if eb.streaming || other.streaming {
+		return errStreaming
+	}
+	if other.contentLength != eb.contentLength {
+		return fmt.Errorf("cannot merge counts of %d bytes with counts of %d bytes", other.contentLength, eb.contentLength)
+	}
+	if other.offset != eb.offset+eb.actualContentLength {
+		return fmt.Errorf("cannot merge the segment at %d with the segment ending at %d", other.offset, eb.offset+eb.actualContentLength)
+	}
+	if len(other.resolutions) != len(eb.resolutions) {
+		return errors.New("cannot merge counts at different resolutions")
+	}
+	for i, resolution := range eb.resolutions {
+		if o := other.resolutions[i]; o.maxCount != resolution.maxCount || o.size != resolution.size || o.count != resolution.count {
+			return errors.New("cannot merge counts at different resolutions")
+		}
+	}
+
+	eb.merge(other)
+	return nil
+}
+
+// Merge the counts of the segment that immediately follows this one, which has been checked to be compatible.
+func (eb *EntropyBuffered) merge(other *EntropyBuffered) {
+	for b, count := range other.totalCount {
+		eb.totalCount[b] += count
+	}
+	for i, resolution := range eb.resolutions {
+		resolution.merge(other.resolutions[i], other.offset, other.actualContentLength)
+	}
+	eb.actualContentLength += other.actualContentLength
+}
+
+// Merge the chunks of the resolution counted for the length bytes from offset.
+func (cr *chunkResolution) merge(other *chunkResolution, offset uint64, length uint64) {
+	// Chunks entirely within the other segment have been calculated.
+	size := uint64(cr.size)
+	first := min(int((offset+size-1)/size), cr.count)
+	last := min(int((offset+length)/size), cr.count)
+	if first < last {
+		copy(cr.chunkEntropies[first:last], other.chunkEntropies[first:last])
+	}
+	for _, partial := range other.partials {
+		if len(cr.partials) > 0 && cr.partials[len(cr.partials)-1].index == partial.index {
+			// The chunk spans both segments.
+			joined := &cr.partials[len(cr.partials)-1]
+			for b, count := range partial.count {
+				joined.count[b] += count
+			}
+			joined.size += partial.size
+			if joined.size == cr.size {
+				cr.calcChunkValueAndClearCount()
+			}
+			continue
+		}
+		cr.partials = append(cr.partials, partial)
+	}
+}
+
+func (eb *EntropyBuffered) state() *bufferedState {
+	state := &bufferedState{
+		Version:       bufferedStateVersion,
+		ContentLength: eb.contentLength,
+		Offset:        eb.offset,
+		Length:        eb.actualContentLength,
+		Counts:        eb.totalCount,
+	}
+	for _, resolution := range eb.resolutions {
+		rs := resolutionState{
+			MaxCount:  resolution.maxCount,
+			Size:      resolution.size,
+			Count:     resolution.count,
+			Entropies: resolution.chunkEntropies,
+		}
+		for _, partial := range resolution.partials {
+			rs.Partials = append(rs.Partials, partialState{Index: partial.index, Size: partial.size, Counts: partial.count})
+		}
+		state.Resolutions = append(state.Resolutions, rs)
+	}
+	return state
+}
+
+// Check the state is consistent and create the EntropyBuffered it describes.
+func (state *bufferedState) restore() (*EntropyBuffered, error) {
+	if state.Version != bufferedStateVersion {
+		return nil, fmt.Errorf("unsupported entropy state version %d", state.Version)
+	}
+	if state.Offset > state.ContentLength || state.Length > state.ContentLength-state.Offset {
+		return nil, fmt.Errorf("entropy state counts %d bytes from %d of %d bytes", state.Length, state.Offset, state.ContentLength)
+	}
+	if countTotal(state.Counts) != state.Length {
+		return nil, errors.New("entropy state counts don't match its length")
+	}
+	if len(state.Resolutions) == 0 {
+		return nil, errors.New("entropy state has no resolutions")
+	}
+	eb := &EntropyBuffered{
+		contentLength:       state.ContentLength,
+		offset:              state.Offset,
+		actualContentLength: state.Length,
+		totalCount:          state.Counts,
+		workers:             defaultWorkers,
+	}
+	for i, rs := range state.Resolutions {
+		if rs.Size < 1 || rs.Count < 0 || uint64(rs.Size)*uint64(rs.Count) > state.ContentLength || len(rs.Entropies) != rs.Count {
+			return nil, fmt.Errorf("entropy state resolution %d has invalid chunks", i)
+		}
+		resolution := &chunkResolution{
+			maxCount:       rs.MaxCount,
+			size:           rs.Size,
+			count:          rs.Count,
+			chunkEntropies: rs.Entropies,
+		}
+		for _, partial := range rs.Partials {
+			valid := partial.Index >= 0 && partial.Index < rs.Count && partial.Size > 0 && partial.Size < rs.Size &&
+				countTotal(partial.Counts) == uint64(partial.Size)
+			if len(resolution.partials) > 0 {
+				valid = valid && partial.Index > resolution.partials[len(resolution.partials)-1].index
+			}
+			if !valid {
+				return nil, fmt.Errorf("entropy state resolution %d has an invalid partial chunk", i)
+			}
+			resolution.partials = append(resolution.partials, partialChunk{index: partial.Index, size: partial.Size, count: partial.Counts})
+		}
+		eb.resolutions = append(eb.resolutions, resolution)
+	}
+	return eb, nil
+}
+
+// Sum of the counts, negative counts make the sum invalid.
+func countTotal(counts [256]int) uint64 {
+	total := uint64(0)
+	for _, count := range counts {
+		if count < 0 {
+			return ^uint64(0)
+		}
+		total += uint64(count)
+	}
+	return total
+}
+
+// Serialise the counts as JSON.
+func (eb *EntropyBuffered) MarshalJSON() ([]byte, error) {
+	if eb.streaming {
+		return nil, errStreaming
+	}
+	return json.Marshal(eb.state())
+}
+
+// Load counts serialised with MarshalJSON.
+func (eb *EntropyBuffered) UnmarshalJSON(data []byte) error {
+	var state bufferedState
+	err := json.Unmarshal(data, &state)
+	if err != nil {
+		return err
+	}
+	restored, err := state.restore()
+	if err != nil {
+		return err
+	}
+	*eb = *restored
+	return nil
+}
+
+// Serialise the counts in a compact binary form.
+func (eb *EntropyBuffered) MarshalBinary() ([]byte, error) {
+	if eb.streaming {
+		return nil, errStreaming
+	}
+	var buf bytes.Buffer
+	buf.WriteString(bufferedMagic)
+	err := gob.NewEncoder(&buf).Encode(eb.state())
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Load counts serialised with MarshalBinary.
+func (eb *EntropyBuffered) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(bufferedMagic)) {
+		return errors.New("not a serialised entropy state")
+	}
+	var state bufferedState
+	err := gob.NewDecoder(bytes.NewReader(data[len(bufferedMagic):])).Decode(&state)
+	if err != nil {
+		return fmt.Errorf("entropy state: %w", err)
+	}
+	restored, err := state.restore()
+	if err != nil {
+		return err
+	}
+	*eb = *restored
+	return nil
+}
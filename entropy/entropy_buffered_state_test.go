@@ -0,0 +1,127 @@
+package entropy
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestEntropyBufferedMerge(t *testing.T) {
+	input := []byte(LargeBuffer)
+	length := uint64(len(input))
+	whole := NewBufferedResolutions(length, 16, 100, 7)
+	whole.AppendAndCalculateBufferedValues(input)
+	// Boundaries on and part way through chunks, and segments within a single chunk.
+	for _, splits := range [][]int{{1000}, {38}, {10, 20}, {500, 1500, 3000}, {0, 3876}, {3870}} {
+		offsets := append(append([]int{0}, splits...), len(input))
+		var merged *EntropyBuffered
+		for i := 0; i < len(offsets)-1; i++ {
+			segment := NewBufferedSegment(length, uint64(offsets[i]), 16, 100, 7)
+			segment.AppendAndCalculateBufferedValues(input[offsets[i]:offsets[i+1]])
+			if merged == nil {
+				merged = segment
+				continue
+			}
+			err := merged.Merge(segment)
+			if err != nil {
+				t.Fatalf("error %v", err)
+			}
+		}
+		// The same counts give identical entropies.
+		if !reflect.DeepEqual(merged.Resolutions(), whole.Resolutions()) || merged.Histogram() != whole.Histogram() {
+			t.Errorf("Splits %v - Expected merged segments to match, got: %+v", splits, merged.Resolutions())
+		}
+		tv, err := merged.TotalValue()
+		if err != nil || tv != 4.380428799939244 {
+			t.Errorf("Splits %v - Unexpected total, got: %v %v", splits, tv, err)
+		}
+	}
+
+	first := NewBufferedSegment(length, 0, 16, 100, 7)
+	first.AppendAndCalculateBufferedValues(input[:100])
+	if _, err := first.TotalValue(); err == nil {
+		t.Errorf("Expected an incomplete total to be reported")
+	}
+	for _, other := range []*EntropyBuffered{
+		NewBufferedSegment(length, 200, 16, 100, 7),
+		NewBufferedSegment(length, 100, 16, 100),
+		NewBufferedSegment(length+1, 100, 16, 100, 7),
+	} {
+		if err := first.Merge(other); err == nil {
+			t.Errorf("Expected merging %+v to be reported", other)
+		}
+	}
+	if offset, counted := first.Segment(); offset != 0 || counted != 100 {
+		t.Errorf("Expected failed merges to leave the counts, got: %v %v", offset, counted)
+	}
+}
+
+func TestEntropyBufferedMarshal(t *testing.T) {
+	input := []byte(LargeBuffer)
+	length := uint64(len(input))
+	whole := NewBufferedResolutions(length, 16, 100, 7)
+	whole.AppendAndCalculateBufferedValues(input)
+
+	marshallers := map[string]struct {
+		marshal   func(*EntropyBuffered) ([]byte, error)
+		unmarshal func(*EntropyBuffered, []byte) error
+	}{
+		"json":   {func(eb *EntropyBuffered) ([]byte, error) { return json.Marshal(eb) }, func(eb *EntropyBuffered, data []byte) error { return json.Unmarshal(data, eb) }},
+		"binary": {(*EntropyBuffered).MarshalBinary, (*EntropyBuffered).UnmarshalBinary},
+	}
+	for name, marshaller := range marshallers {
+		// Checkpoint part way through a chunk and resume from the checkpoint.
+		ent := NewBufferedResolutions(length, 16, 100, 7)
+		ent.AppendAndCalculateBufferedValues(input[:1234])
+		data, err := marshaller.marshal(ent)
+		if err != nil {
+			t.Fatalf("error %v", err)
+		}
+		var resumed EntropyBuffered
+		err = marshaller.unmarshal(&resumed, data)
+		if err != nil {
+			t.Fatalf("%v - error %v", name, err)
+		}
+		resumed.AppendAndCalculateBufferedValues(input[1234:])
+		if !reflect.DeepEqual(resumed.Resolutions(), whole.Resolutions()) {
+			t.Errorf("%v - Expected the resumed counts to match, got: %+v", name, resumed.Resolutions())
+		}
+		if tv, err := resumed.TotalValue(); err != nil || tv != 4.380428799939244 {
+			t.Errorf("%v - Unexpected total, got: %v %v", name, tv, err)
+		}
+
+		// Segments can be serialised and merged.
+		segment := NewBufferedSegment(length, 1234, 16, 100, 7)
+		segment.AppendAndCalculateBufferedValues(input[1234:])
+		data, err = marshaller.marshal(segment)
+		if err != nil {
+			t.Fatalf("error %v", err)
+		}
+		var loaded EntropyBuffered
+		err = marshaller.unmarshal(&loaded, data)
+		if err != nil {
+			t.Fatalf("%v - error %v", name, err)
+		}
+		err = ent.Merge(&loaded)
+		if err != nil || !reflect.DeepEqual(ent.Resolutions(), whole.Resolutions()) {
+			t.Errorf("%v - Expected the merged counts to match, got: %v", name, err)
+		}
+	}
+
+	var invalid EntropyBuffered
+	for _, data := range []string{
+		`{"version":2}`,
+		`{"version":1,"content_length":10,"offset":5,"length":6}`,
+		`{"version":1,"content_length":10,"length":1}`,
+		`{"version":1,"content_length":10}`,
+		`{"version":1,"content_length":10,"resolutions":[{"size":4,"count":3,"entropies":[0,0,0]}]}`,
+		`{"version":1,"content_length":10,"resolutions":[{"size":4,"count":2,"entropies":[0,0],"partials":[{"index":2,"size":1}]}]}`,
+	} {
+		if err := json.Unmarshal([]byte(data), &invalid); err == nil {
+			t.Errorf("Expected an error loading %v", data)
+		}
+	}
+	if err := invalid.UnmarshalBinary([]byte("AZENTBUF")); err == nil {
+		t.Errorf("Expected an error loading an empty state")
+	}
+}
@@ -69,6 +69,50 @@ func TestEntropyBufferedChunks(t *testing.T) {
 	}
 }
 
+func TestEntropyBufferedMinBlockSize(t *testing.T) {
+	input := []byte(LargeBuffer)
+	// Smaller blocks than the default minimum are allowed, up to the maximum count.
+	ent := NewBufferedWithMinBlockSize(uint64(len(input)), 100, 16)
+	ent.AppendAndCalculateBufferedValues(input)
+	_, size, count := ent.GetChunkEntropySizeAndCount()
+	if size != 38 || count != 100 {
+		t.Errorf("Unexpected size and count, got: %v %v", size, count)
+	}
+	// Larger minimums give fewer blocks.
+	ent = NewBufferedWithMinBlockSize(uint64(len(input)), 100, 1024)
+	ent.AppendAndCalculateBufferedValues(input)
+	_, size, count = ent.GetChunkEntropySizeAndCount()
+	if size != 1024 || count != 3 {
+		t.Errorf("Unexpected size and count, got: %v %v", size, count)
+	}
+}
+
+func TestEntropyBufferedResolutions(t *testing.T) {
+	input := []byte(LargeBuffer)
+	ent := NewBufferedResolutions(uint64(len(input)), BufferedMinBlockSize, 5, 1, 100)
+	for i := 0; i < len(input); i += 1000 {
+		ent.AppendAndCalculateBufferedValues(input[i:min(i+1000, len(input))])
+	}
+	resolutions := ent.Resolutions()
+	if len(resolutions) != 3 {
+		t.Fatalf("Unexpected resolutions, got: %+v", resolutions)
+	}
+	// Each resolution matches calculating it alone.
+	for _, resolution := range resolutions {
+		alone := NewBuffered(uint64(len(input)), resolution.MaxCount)
+		alone.AppendAndCalculateBufferedValues(input)
+		entropies, size, count := alone.GetChunkEntropySizeAndCount()
+		if resolution.Size != size || resolution.Count != count || !reflect.DeepEqual(resolution.Entropies, entropies) {
+			t.Errorf("Unexpected resolution %v, got: %+v", resolution.MaxCount, resolution)
+		}
+	}
+	// The first resolution is the primary.
+	_, size, count := ent.GetChunkEntropySizeAndCount()
+	if size != 775 || count != 5 {
+		t.Errorf("Unexpected primary resolution, got: %v %v", size, count)
+	}
+}
+
 // Test Entropy calculations still work when we append data in arbitrary byte slices.
 func TestEntropyBufferedMultipleAppends(t *testing.T) {
 	input := []byte(LargeBuffer)
@@ -113,6 +157,19 @@ func TestEntropyBufferedMultipleAppends(t *testing.T) {
 	}
 }
 
+// Test the tables give bit-identical results when appends are split across goroutines.
+func TestEntropyBufferedParallel(t *testing.T) {
+	defer func(size int, workers int) {
+		parallelMinSize, defaultWorkers = size, workers
+	}(parallelMinSize, defaultWorkers)
+	parallelMinSize, defaultWorkers = 7, 4
+	t.Run("Totals", TestEntropyBuffered)
+	t.Run("Chunks", TestEntropyBufferedChunks)
+	t.Run("MinBlockSize", TestEntropyBufferedMinBlockSize)
+	t.Run("Resolutions", TestEntropyBufferedResolutions)
+	t.Run("MultipleAppends", TestEntropyBufferedMultipleAppends)
+}
+
 func BenchmarkEntropyBuffered(b *testing.B) {
 	e := NewBuffered(uint64(len([]byte(LargeBuffer))), 100)
 	e.AppendAndCalculateBufferedValues([]byte(LargeBuffer))
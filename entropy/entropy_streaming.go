@@ -0,0 +1,76 @@
+package entropy
+
+import "errors"
+
+// Creates a new BufferedEntropy for content of unknown length, such as a decompressed stream or a network capture,
+// calculating the chunk entropies at each of the max_block_counts. Chunks start at minBlockSize bytes, and whenever a
+// resolution has more than its max_block_count chunks each pair of adjacent chunks is merged, doubling the chunk size.
+// The chunks are then the same as if the content had been split into chunks of the final size, which is the smallest
+// minBlockSize times a power of two giving at most max_block_count whole chunks. A max_block_count of 0 keeps chunks of
+// minBlockSize with no limit on their number. As with a known length, bytes after the last whole chunk aren't in any
+// chunk.
+// The counts of each chunk are kept so they can be merged, which takes about 2KiB per chunk.
+func NewStreaming(minBlockSize int, max_block_counts ...int) (entropyBuffered *EntropyBuffered) {
+	eb := &EntropyBuffered{streaming: true, workers: 1}
+	for _, max_block_count := range max_block_counts {
+		eb.resolutions = append(eb.resolutions, &chunkResolution{
+			maxCount:       max_block_count,
+			size:           max(minBlockSize, 1),
+			chunkEntropies: []float64{},
+		})
+	}
+	return eb
+}
+
+var errStreaming = errors.New("the counts of content of unknown length can't be merged or serialised")
+
+// Add the bytes to the chunk counts of the resolution of content of unknown length, merging adjacent chunks when there
+// are more than maxCount.
+func (cr *chunkResolution) appendStreaming(buf []byte) {
+	for len(buf) > 0 {
+		// The chunk being filled always follows the calculated chunks.
+		if len(cr.partials) == 0 {
+			cr.partials = append(cr.partials, partialChunk{index: cr.count})
+		}
+		partial := &cr.partials[0]
+		n := min(len(buf), cr.size-partial.size)
+		for _, b := range buf[:n] {
+			partial.count[b]++
+		}
+		partial.size += n
+		buf = buf[n:]
+
+		if partial.size == cr.size {
+			cr.chunkEntropies = append(cr.chunkEntropies, calculateEntropy(partial.count, uint64(partial.size)))
+			if cr.maxCount > 0 {
+				cr.chunkCounts = append(cr.chunkCounts, partial.count)
+			}
+			cr.count++
+			cr.partials = cr.partials[:0]
+			if cr.maxCount > 0 && cr.count > cr.maxCount {
+				cr.mergeAdjacent()
+			}
+		}
+	}
+}
+
+// Merge each pair of adjacent chunks, doubling the chunk size. An odd chunk left over becomes the start of the chunk
+// being filled.
+func (cr *chunkResolution) mergeAdjacent() {
+	merged := cr.count / 2
+	for i := range merged {
+		counts := cr.chunkCounts[2*i]
+		for b, count := range cr.chunkCounts[2*i+1] {
+			counts[b] += count
+		}
+		cr.chunkCounts[i] = counts
+		cr.chunkEntropies[i] = calculateEntropy(counts, uint64(2*cr.size))
+	}
+	if cr.count%2 == 1 {
+		cr.partials = append(cr.partials, partialChunk{index: merged, size: cr.size, count: cr.chunkCounts[cr.count-1]})
+	}
+	cr.size *= 2
+	cr.count = merged
+	cr.chunkCounts = cr.chunkCounts[:merged]
+	cr.chunkEntropies = cr.chunkEntropies[:merged]
+}
@@ -0,0 +1,76 @@
+package entropy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Entropy of each whole chunk of size bytes of the input.
+func chunkEntropies(input []byte, size int) []float64 {
+	entropies := []float64{}
+	for start := 0; start+size <= len(input); start += size {
+		var counts [256]int
+		for _, b := range input[start : start+size] {
+			counts[b]++
+		}
+		entropies = append(entropies, CountsValue(counts))
+	}
+	return entropies
+}
+
+func TestEntropyStreaming(t *testing.T) {
+	tables := []struct {
+		input        []byte
+		maxCount     int
+		outputSize   int
+		outputCount  int
+		outputResult float64
+	}{
+		{[]byte(""), 100, 256, 0, 0},
+		{[]byte("1223334444"), 1, 256, 0, 1.8464393446710154},
+		{[]byte(LargeBuffer), 100, 256, 15, 4.380428799939244},
+		{[]byte(LargeBuffer), 15, 256, 15, 4.380428799939244},
+		{[]byte(LargeBuffer), 14, 512, 7, 4.380428799939244},
+		{[]byte(LargeBuffer), 5, 1024, 3, 4.380428799939244},
+		{[]byte(LargeBuffer), 1, 2048, 1, 4.380428799939244},
+		// Fixed chunk size.
+		{[]byte(LargeBuffer), 0, 256, 15, 4.380428799939244},
+		{[]byte(strings.Repeat("AB", 153809)), 64, 8192, 37, 1},
+	}
+	for _, table := range tables {
+		// Appending in any pieces gives the same chunks.
+		for _, piece := range []int{1, 100, 1000, len(table.input) + 1} {
+			ent := NewStreaming(BufferedMinBlockSize, table.maxCount, 0)
+			for start := 0; start < len(table.input); start += piece {
+				ent.AppendAndCalculateBufferedValues(table.input[start:min(start+piece, len(table.input))])
+			}
+			tv, err := ent.TotalValue()
+			if err != nil || tv != table.outputResult {
+				t.Errorf("Max %v - Unexpected total, got: %v %v", table.maxCount, tv, err)
+			}
+			entropies, size, count := ent.GetChunkEntropySizeAndCount()
+			if size != table.outputSize || count != table.outputCount {
+				t.Errorf("Max %v, pieces of %v - Unexpected chunks, got: %v %v", table.maxCount, piece, size, count)
+				continue
+			}
+			// Merged chunks match chunks of the final size.
+			if expected := chunkEntropies(table.input, size); !reflect.DeepEqual(entropies, expected) {
+				t.Errorf("Max %v, pieces of %v - Unexpected entropies, got: %v expected: %v", table.maxCount, piece, entropies, expected)
+			}
+			// The other resolution keeps the minimum chunk size.
+			if fixed := ent.Resolutions()[1]; fixed.Size != BufferedMinBlockSize || fixed.Count != len(table.input)/BufferedMinBlockSize {
+				t.Errorf("Max %v - Unexpected fixed resolution, got: %v %v", table.maxCount, fixed.Size, fixed.Count)
+			}
+		}
+	}
+
+	ent := NewStreaming(16, 4)
+	ent.AppendAndCalculateBufferedValues([]byte(LargeBuffer))
+	if err := ent.Merge(NewStreaming(16, 4)); err == nil {
+		t.Errorf("Expected merging counts of unknown length to be reported")
+	}
+	if _, err := ent.MarshalBinary(); err == nil {
+		t.Errorf("Expected serialising counts of unknown length to be reported")
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Summarise the byte histogram of a binary.
+*/
+package entropy
+
+import "sort"
+
+// How often a single byte value occurs, as a ratio of all bytes.
+type ByteFrequency struct {
+	Byte  byte
+	Ratio float64
+}
+
+// Summary of a byte histogram.
+type HistogramStats struct {
+	// Ratio of all bytes for each byte value.
+	Normalised [256]float64
+	// Number of byte values that occur at least once.
+	DistinctBytes int
+	// The most frequent byte values, most frequent first.
+	MostFrequent []ByteFrequency
+	// Ratio of bytes that are printable ASCII characters (including common whitespace).
+	PrintableRatio float64
+	// Ratio of bytes that are null.
+	ZeroRatio float64
+	// Pearson's chi-square statistic of the counts against a uniform distribution of byte values.
+	ChiSquare float64
+}
+
+// Get a copy of the count of every byte value appended so far.
+func (eb *EntropyBuffered) Histogram() [256]int {
+	return eb.totalCount
+}
+
+// Summarise a byte histogram, reporting up to topN of the most frequent bytes.
+func CalculateHistogramStats(counts [256]int, topN int) HistogramStats {
+	var stats HistogramStats
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	if total == 0 {
+		return stats
+	}
+	printable := 0
+	present := []ByteFrequency{}
+	for i, count := range counts {
+		if count == 0 {
+			continue
+		}
+		ratio := float64(count) / float64(total)
+		stats.Normalised[i] = ratio
+		stats.DistinctBytes += 1
+		if isPrintable(i) {
+			printable += count
+		}
+		present = append(present, ByteFrequency{Byte: byte(i), Ratio: ratio})
+	}
+	// Stable sort keeps equally frequent bytes in byte order.
+	sort.SliceStable(present, func(i, j int) bool {
+		return present[i].Ratio > present[j].Ratio
+	})
+	stats.MostFrequent = present[:min(max(topN, 0), len(present))]
+	stats.PrintableRatio = float64(printable) / float64(total)
+	stats.ZeroRatio = stats.Normalised[0]
+	stats.ChiSquare = ChiSquare(counts)
+	return stats
+}
+
+// Pearson's chi-square statistic of a byte histogram against a uniform distribution of byte values.
+// Random data stays close to 255 (the degrees of freedom) however long it is, structured data grows with its length.
+func ChiSquare(counts [256]int) float64 {
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	if total == 0 {
+		return 0
+	}
+	expected := float64(total) / 256
+	chiSquare := 0.0
+	for _, count := range counts {
+		difference := float64(count) - expected
+		chiSquare += difference * difference / expected
+	}
+	return chiSquare
+}
@@ -0,0 +1,71 @@
+package entropy
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestEntropyBufferedHistogram(t *testing.T) {
+	input := []byte("1223334444")
+	eb := NewBuffered(uint64(len(input)), 800)
+	eb.AppendAndCalculateBufferedValues(input[:4])
+	eb.AppendAndCalculateBufferedValues(input[4:])
+	histogram := eb.Histogram()
+	var expected [256]int
+	expected['1'] = 1
+	expected['2'] = 2
+	expected['3'] = 3
+	expected['4'] = 4
+	if histogram != expected {
+		t.Errorf("Unexpected Histogram, got: %v", histogram)
+	}
+	// The histogram is a copy, changing it must not change the entropy.
+	histogram['1'] = 100
+	tv, err := eb.TotalValue()
+	if err != nil {
+		t.Errorf("error %v", err)
+	}
+	if tv != 1.8464393446710154 {
+		t.Errorf("Unexpected Entropy, got: %v", tv)
+	}
+}
+
+func TestCalculateHistogramStats(t *testing.T) {
+	var counts [256]int
+	counts[0] = 4
+	counts['a'] = 3
+	counts['b'] = 1
+	counts[0xff] = 1
+	counts['\n'] = 1
+	stats := CalculateHistogramStats(counts, 3)
+
+	if stats.DistinctBytes != 5 {
+		t.Errorf("Unexpected DistinctBytes, got: %v", stats.DistinctBytes)
+	}
+	if stats.ZeroRatio != 0.4 {
+		t.Errorf("Unexpected ZeroRatio, got: %v", stats.ZeroRatio)
+	}
+	if stats.PrintableRatio != 0.5 {
+		t.Errorf("Unexpected PrintableRatio, got: %v", stats.PrintableRatio)
+	}
+	if stats.Normalised['a'] != 0.3 || stats.Normalised['c'] != 0 {
+		t.Errorf("Unexpected Normalised, got: %v", stats.Normalised)
+	}
+	// Expected count of 10/256 for each byte.
+	if math.Abs(stats.ChiSquare-((4*4+3*3+1+1+1)*25.6-10)) > 1e-9 {
+		t.Errorf("Unexpected ChiSquare, got: %v", stats.ChiSquare)
+	}
+	expected := []ByteFrequency{{0, 0.4}, {'a', 0.3}, {'\n', 0.1}}
+	if !reflect.DeepEqual(stats.MostFrequent, expected) {
+		t.Errorf("Unexpected MostFrequent, expected %v got: %v", expected, stats.MostFrequent)
+	}
+}
+
+func TestCalculateHistogramStatsEmpty(t *testing.T) {
+	var counts [256]int
+	stats := CalculateHistogramStats(counts, 3)
+	if !reflect.DeepEqual(stats, HistogramStats{}) {
+		t.Errorf("Unexpected Stats for empty histogram, got: %v", stats)
+	}
+}
@@ -0,0 +1,203 @@
+/*
+Index the byte counts of a binary at a fine granularity so the entropy of any range can be calculated later without
+the content.
+*/
+package entropy
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Start of a serialised RangeIndex, followed by the format version.
+const rangeIndexMagic = "AZENTRNG"
+
+const rangeIndexVersion = 1
+
+// Struct that counts the bytes of each granule (a fixed size run of bytes) of a binary as bytes are appended.
+// The entropy of a range is calculated from the counts of the granules it covers, so ranges are measured to the nearest
+// granule boundaries.
+type RangeIndex struct {
+	length      uint64
+	granuleSize uint64
+	// Byte counts of each granule, the last granule may be partial.
+	granules [][256]uint32
+	// Counts of all the granules before each granule boundary, built for the first query after appending.
+	cumulative [][256]uint64
+}
+
+// Entropy of a range measured by a RangeIndex.
+type RangeEntropy struct {
+	// Range measured, the requested range moved to the nearest granule boundaries.
+	Start uint64
+	End   uint64
+	Value float64
+}
+
+// Creates a new RangeIndex for a binary that is contentLength bytes long split into at most maxGranules granules, of
+// at least minGranuleSize bytes. The counts of a granule take about as much space as a few hundred bytes of content, so
+// small granules make an index larger than the binary.
+func NewRangeIndex(contentLength uint64, maxGranules int, minGranuleSize int) *RangeIndex {
+	granuleSize := uint64(max(minGranuleSize, 1))
+	if maxGranules > 0 {
+		granuleSize = max(granuleSize, (contentLength+uint64(maxGranules)-1)/uint64(maxGranules))
+	}
+	return &RangeIndex{granuleSize: granuleSize}
+}
+
+// Appends new data to the RangeIndex, counting the bytes of each granule.
+func (ri *RangeIndex) AppendAndCount(buf []byte) {
+	ri.cumulative = nil
+	for len(buf) > 0 {
+		granule := ri.length / ri.granuleSize
+		if granule == uint64(len(ri.granules)) {
+			ri.granules = append(ri.granules, [256]uint32{})
+		}
+		n := min(uint64(len(buf)), ri.granuleSize-ri.length%ri.granuleSize)
+		counts := &ri.granules[granule]
+		for _, b := range buf[:n] {
+			counts[b]++
+		}
+		ri.length += n
+		buf = buf[n:]
+	}
+}
+
+// Number of bytes indexed.
+func (ri *RangeIndex) Len() uint64 {
+	return ri.length
+}
+
+// Number of bytes in each granule, ranges are measured to the nearest multiple of the granule size.
+func (ri *RangeIndex) GranuleSize() uint64 {
+	return ri.granuleSize
+}
+
+// Number of granules indexed.
+func (ri *RangeIndex) Granules() int {
+	return len(ri.granules)
+}
+
+// Calculate the entropy of the bytes from start (inclusive) to end (exclusive).
+// The range is moved to the nearest granule boundaries, so each end of the measured range is within one granule of the
+// requested range, and the entropy is exact when both ends are multiples of the granule size (or the end is the end of
+// the binary).
+func (ri *RangeIndex) RangeValue(start uint64, end uint64) (RangeEntropy, error) {
+	if start >= end || end > ri.length {
+		return RangeEntropy{}, fmt.Errorf("range %#x to %#x is not within the %d bytes indexed", start, end, ri.length)
+	}
+	if ri.cumulative == nil {
+		ri.cumulative = make([][256]uint64, len(ri.granules)+1)
+		for i, counts := range ri.granules {
+			for b, count := range counts {
+				ri.cumulative[i+1][b] = ri.cumulative[i][b] + uint64(count)
+			}
+		}
+	}
+	first, last := ri.nearestBoundary(start), ri.nearestBoundary(end)
+	// Ranges smaller than a granule are measured as the granule nearest to them.
+	if first == last {
+		if last < len(ri.granules) {
+			last++
+		} else {
+			first--
+		}
+	}
+	var counts [256]int
+	for b := range counts {
+		counts[b] = int(ri.cumulative[last][b] - ri.cumulative[first][b])
+	}
+	result := RangeEntropy{Start: ri.boundary(first), End: ri.boundary(last)}
+	result.Value = calculateEntropy(counts, result.End-result.Start)
+	return result, nil
+}
+
+// Offset of the granule boundary, the last boundary is the end of the binary.
+func (ri *RangeIndex) boundary(i int) uint64 {
+	return min(uint64(i)*ri.granuleSize, ri.length)
+}
+
+// Granule boundary nearest to the offset.
+func (ri *RangeIndex) nearestBoundary(offset uint64) int {
+	if offset == ri.length {
+		return len(ri.granules)
+	}
+	i := int((offset + ri.granuleSize/2) / ri.granuleSize)
+	return min(i, len(ri.granules))
+}
+
+// Serialise the index, the granule counts are varint encoded and compressed with zlib.
+func (ri *RangeIndex) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(rangeIndexMagic)
+	buf.WriteByte(rangeIndexVersion)
+	buf.Write(binary.AppendUvarint(nil, ri.length))
+	buf.Write(binary.AppendUvarint(nil, ri.granuleSize))
+	writer := zlib.NewWriter(&buf)
+	varint := make([]byte, 0, binary.MaxVarintLen32)
+	for _, counts := range ri.granules {
+		for _, count := range counts {
+			_, err := writer.Write(binary.AppendUvarint(varint[:0], uint64(count)))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	err := writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Load an index serialised with MarshalBinary.
+func UnmarshalRangeIndex(data []byte) (*RangeIndex, error) {
+	if !bytes.HasPrefix(data, []byte(rangeIndexMagic)) || len(data) <= len(rangeIndexMagic) {
+		return nil, errors.New("not a range index")
+	}
+	if version := data[len(rangeIndexMagic)]; version != rangeIndexVersion {
+		return nil, fmt.Errorf("unsupported range index version %d", version)
+	}
+	reader := bytes.NewReader(data[len(rangeIndexMagic)+1:])
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, fmt.Errorf("range index header: %w", err)
+	}
+	granuleSize, err := binary.ReadUvarint(reader)
+	if err != nil || granuleSize == 0 {
+		return nil, errors.New("range index header: invalid granule size")
+	}
+	ri := &RangeIndex{length: length, granuleSize: granuleSize}
+	granules := (length + granuleSize - 1) / granuleSize
+	zreader, err := zlib.NewReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("range index counts: %w", err)
+	}
+	counts := bufio.NewReader(zreader)
+	// Granules are added as they are read rather than allocated from the header, which may be corrupt.
+	for i := uint64(0); i < granules; i++ {
+		var granule [256]uint32
+		total := uint64(0)
+		for b := range granule {
+			count, err := binary.ReadUvarint(counts)
+			if err != nil {
+				return nil, fmt.Errorf("range index counts: %w", err)
+			}
+			granule[b] = uint32(count)
+			total += count
+		}
+		if total != min(granuleSize, length-i*granuleSize) {
+			return nil, fmt.Errorf("range index counts: granule %d has %d bytes", i, total)
+		}
+		ri.granules = append(ri.granules, granule)
+	}
+	if _, err := counts.ReadByte(); err != io.EOF {
+		return nil, errors.New("range index counts: unexpected data after the last granule")
+	}
+	return ri, nil
+}
@@ -0,0 +1,86 @@
+package entropy
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestRangeValue(t *testing.T) {
+	input := []byte(LargeBuffer)
+	index := NewRangeIndex(uint64(len(input)), 100, 1)
+	for i := 0; i < len(input); i += 1000 {
+		index.AppendAndCount(input[i:min(i+1000, len(input))])
+	}
+	if index.GranuleSize() != 39 || index.Len() != uint64(len(input)) {
+		t.Fatalf("Unexpected index, got: %v %v", index.GranuleSize(), index.Len())
+	}
+	tables := []struct {
+		start uint64
+		end   uint64
+		// Range measured.
+		outputStart uint64
+		outputEnd   uint64
+	}{
+		{0, uint64(len(input)), 0, uint64(len(input))}, // whole binary
+		{39, 390, 39, 390}, // aligned
+		{50, 400, 39, 390}, // nearest boundaries
+		{60, 420, 78, 429}, // nearest boundaries
+		{3870, uint64(len(input)), 3861, uint64(len(input))},
+		{41, 45, 39, 78}, // smaller than a granule
+		{uint64(len(input)) - 2, uint64(len(input)), 3861, uint64(len(input))}, // smaller than the last granule
+	}
+	for _, table := range tables {
+		result, err := index.RangeValue(table.start, table.end)
+		if err != nil {
+			t.Fatalf("error %v", err)
+		}
+		if result.Start != table.outputStart || result.End != table.outputEnd {
+			t.Errorf("Unexpected range for %v to %v, got: %+v", table.start, table.end, result)
+		}
+		expected := New(input[result.Start:result.End]).Value()
+		if math.Abs(result.Value-expected) > 1e-12 {
+			t.Errorf("Unexpected entropy for %v to %v, expected %v got: %v", table.start, table.end, expected, result.Value)
+		}
+	}
+	for _, invalid := range [][2]uint64{{10, 10}, {20, 10}, {0, uint64(len(input)) + 1}} {
+		_, err := index.RangeValue(invalid[0], invalid[1])
+		if err == nil {
+			t.Errorf("Expected an error for %v", invalid)
+		}
+	}
+}
+
+func TestRangeIndexMarshal(t *testing.T) {
+	input := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(input[50000:])
+	index := NewRangeIndex(uint64(len(input)), 4096, 256)
+	index.AppendAndCount(input)
+	data, err := index.MarshalBinary()
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	// Far smaller than a count per byte value per granule.
+	if len(data) > 60000 {
+		t.Errorf("Expected a compact index, got %v bytes", len(data))
+	}
+	loaded, err := UnmarshalRangeIndex(data)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if !reflect.DeepEqual(loaded.granules, index.granules) || loaded.Len() != index.Len() || loaded.GranuleSize() != index.GranuleSize() {
+		t.Errorf("Expected the loaded index to match")
+	}
+	result, err := loaded.RangeValue(0x4000, 0x9200)
+	if err != nil || result.Value != 0 {
+		t.Errorf("Unexpected entropy of the null bytes, got: %+v %v", result, err)
+	}
+
+	for _, invalid := range [][]byte{nil, []byte("AZENTRNG"), []byte("AZENTRNG\x02"), data[:len(data)-5]} {
+		_, err = UnmarshalRangeIndex(invalid)
+		if err == nil {
+			t.Errorf("Expected an error loading %q", invalid)
+		}
+	}
+}
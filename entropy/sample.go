@@ -0,0 +1,94 @@
+/*
+Estimate the entropy of a binary from windows sampled from it, for binaries too large to read every byte of.
+*/
+package entropy
+
+import (
+	"math/rand"
+	"slices"
+)
+
+// Number of times the windows are resampled to estimate the confidence interval.
+const bootstrapResamples = 200
+
+// Estimate of the entropy of a binary from sampled windows.
+type SampleEstimate struct {
+	// Entropy of all the sampled bytes.
+	Value float64
+	// Confidence interval of the entropy of the binary.
+	Low  float64
+	High float64
+}
+
+// Offsets of count windows of windowSize bytes, evenly spaced from the start of a binary that is contentLength bytes
+// long. Each window is at the start of an equal share of the binary.
+func EvenWindows(contentLength uint64, windowSize uint64, count int) []uint64 {
+	offsets := make([]uint64, 0, count)
+	if count <= 0 || windowSize > contentLength {
+		return offsets
+	}
+	stride := contentLength / uint64(count)
+	for i := range count {
+		offsets = append(offsets, min(uint64(i)*stride, contentLength-windowSize))
+	}
+	return offsets
+}
+
+// Offsets of count windows of windowSize bytes at random positions in a binary that is contentLength bytes long.
+// Each window is placed at random within an equal share of the binary, so windows cover the whole binary and don't
+// overlap when they fit within their share.
+func RandomWindows(contentLength uint64, windowSize uint64, count int, rng *rand.Rand) []uint64 {
+	offsets := EvenWindows(contentLength, windowSize, count)
+	stride := contentLength / uint64(max(count, 1))
+	for i, offset := range offsets {
+		if stride > windowSize {
+			offsets[i] = min(offset+uint64(rng.Int63n(int64(stride-windowSize+1))), contentLength-windowSize)
+		}
+	}
+	return offsets
+}
+
+// Estimate the entropy of a binary from the byte counts of windows sampled from it, with a confidence interval at the
+// confidence level (e.g. 0.95). The interval is found by resampling the windows with replacement, so it reflects how
+// much the content varies between windows.
+func EstimateEntropy(windows [][256]int, confidence float64, rng *rand.Rand) SampleEstimate {
+	var counts [256]int
+	length := uint64(0)
+	for _, window := range windows {
+		for b, count := range window {
+			counts[b] += count
+			length += uint64(count)
+		}
+	}
+	estimate := SampleEstimate{Value: calculateEntropy(counts, length)}
+	estimate.Low, estimate.High = estimate.Value, estimate.Value
+	if len(windows) < 2 {
+		return estimate
+	}
+	values := make([]float64, 0, bootstrapResamples)
+	for range bootstrapResamples {
+		var resampled [256]int
+		length := uint64(0)
+		for range windows {
+			for b, count := range windows[rng.Intn(len(windows))] {
+				resampled[b] += count
+				length += uint64(count)
+			}
+		}
+		values = append(values, calculateEntropy(resampled, length))
+	}
+	slices.Sort(values)
+	tail := (1 - confidence) / 2
+	estimate.Low = values[int(tail*float64(len(values)-1))]
+	estimate.High = values[int((1-tail)*float64(len(values)-1)+0.5)]
+	return estimate
+}
+
+// Calculate the entropy of the byte counts of a window, such as a window of a sample.
+func CountsValue(counts [256]int) float64 {
+	length := uint64(0)
+	for _, count := range counts {
+		length += uint64(count)
+	}
+	return calculateEntropy(counts, length)
+}
@@ -0,0 +1,60 @@
+package entropy
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestSampleWindows(t *testing.T) {
+	even := EvenWindows(1000, 10, 4)
+	if !reflect.DeepEqual(even, []uint64{0, 250, 500, 750}) {
+		t.Errorf("Unexpected even windows, got: %v", even)
+	}
+	if windows := EvenWindows(5, 10, 4); len(windows) != 0 {
+		t.Errorf("Expected no windows larger than the binary, got: %v", windows)
+	}
+	random := RandomWindows(1000, 10, 4, rand.New(rand.NewSource(1)))
+	for i, offset := range random {
+		// Each window is within its share of the binary.
+		if offset < uint64(i)*250 || offset+10 > uint64(i+1)*250 {
+			t.Errorf("Unexpected random window %v, got: %v", i, random)
+		}
+	}
+	if reflect.DeepEqual(random, even) {
+		t.Errorf("Expected random windows to differ from even windows")
+	}
+}
+
+func TestEstimateEntropy(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	// Windows that are all the same give an exact estimate.
+	var uniform [256]int
+	for b := range uniform {
+		uniform[b] = 4
+	}
+	estimate := EstimateEntropy([][256]int{uniform, uniform, uniform}, 0.95, rng)
+	if estimate.Value != 8 || estimate.Low != 8 || estimate.High != 8 {
+		t.Errorf("Unexpected estimate of identical windows, got: %+v", estimate)
+	}
+
+	// Half null windows and half random windows, the interval covers the entropy of the whole binary.
+	content := make([]byte, 256*1024)
+	rng.Read(content[len(content)/2:])
+	windows := [][256]int{}
+	for _, offset := range EvenWindows(uint64(len(content)), 1024, 32) {
+		var counts [256]int
+		for _, b := range content[offset : offset+1024] {
+			counts[b]++
+		}
+		windows = append(windows, counts)
+	}
+	estimate = EstimateEntropy(windows, 0.95, rng)
+	actual := New(content).Value()
+	if estimate.Low >= estimate.High || actual < estimate.Low || actual > estimate.High || estimate.Value < estimate.Low || estimate.Value > estimate.High {
+		t.Errorf("Expected the interval to cover %v, got: %+v", actual, estimate)
+	}
+	if CountsValue(windows[0]) != 0 || CountsValue(windows[31]) < 7.7 {
+		t.Errorf("Unexpected window entropies, got: %v %v", CountsValue(windows[0]), CountsValue(windows[31]))
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Fuzzy signatures of the shape of an entropy profile, so variants of a file with different hashes can be matched.
+*/
+package entropy
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Number of points the block entropies are resampled to, every signature is this many characters long.
+const SignatureLength = 64
+
+// Number of levels each point is quantised to, one hex digit per point.
+const signatureLevels = 16
+
+const signatureDigits = "0123456789abcdef"
+
+// Derive a signature from block entropies, such as those from GetChunkEntropySizeAndCount.
+// The blocks are resampled to SignatureLength points by averaging and each point is quantised to a hex digit, with 0
+// for no entropy and f for the highest. Profiles without blocks have an empty signature.
+func Signature(blocks []float64) string {
+	if len(blocks) == 0 {
+		return ""
+	}
+	var signature strings.Builder
+	for i := range SignatureLength {
+		// Points stretch blocks when there are fewer blocks than points.
+		start := i * len(blocks) / SignatureLength
+		end := max((i+1)*len(blocks)/SignatureLength, start+1)
+		sum := 0.0
+		for _, value := range blocks[start:end] {
+			sum += value
+		}
+		level := int(sum / float64(end-start) / 8 * signatureLevels)
+		signature.WriteByte(signatureDigits[min(max(level, 0), signatureLevels-1)])
+	}
+	return signature.String()
+}
+
+// Decode a signature into the level of each point.
+func SignatureLevels(signature string) ([]int, error) {
+	if len(signature) != SignatureLength {
+		return nil, fmt.Errorf("expected a signature of %d characters, got %d", SignatureLength, len(signature))
+	}
+	levels := make([]int, SignatureLength)
+	for i := range signature {
+		levels[i] = strings.IndexByte(signatureDigits, signature[i])
+		if levels[i] < 0 {
+			return nil, fmt.Errorf("invalid character %q in signature", signature[i])
+		}
+	}
+	return levels, nil
+}
+
+// Distance between the shapes of two profiles from their signatures, the mean difference between their levels scaled
+// from 0 for the same shape to 1 for a profile with no entropy compared with one of the highest entropy.
+func SignatureDistance(a string, b string) (float64, error) {
+	levelsA, err := SignatureLevels(a)
+	if err != nil {
+		return 0, err
+	}
+	levelsB, err := SignatureLevels(b)
+	if err != nil {
+		return 0, err
+	}
+	total := 0.0
+	for i := range levelsA {
+		total += math.Abs(float64(levelsA[i] - levelsB[i]))
+	}
+	return total / SignatureLength / (signatureLevels - 1), nil
+}
@@ -0,0 +1,54 @@
+package entropy
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestSignature(t *testing.T) {
+	blocks := make([]float64, 128)
+	for i := range blocks {
+		blocks[i] = 8 * float64(i) / 128
+	}
+	// Pairs of blocks are averaged into each point, rising a level every four points.
+	expected := "0000111122223333444455556666777788889999aaaabbbbccccddddeeeeffff"
+	if signature := Signature(blocks); signature != expected {
+		t.Errorf("Unexpected signature, got: %v", signature)
+	}
+	if Signature(nil) != "" {
+		t.Errorf("Expected no signature without blocks")
+	}
+	// Fewer blocks than points are stretched.
+	if signature := Signature([]float64{0, 8}); signature != strings.Repeat("0", 32)+strings.Repeat("f", 32) {
+		t.Errorf("Unexpected stretched signature, got: %v", signature)
+	}
+}
+
+func TestSignatureDistance(t *testing.T) {
+	low, high := strings.Repeat("0", SignatureLength), strings.Repeat("f", SignatureLength)
+	for _, test := range []struct {
+		a, b     string
+		expected float64
+	}{
+		{low, low, 0},
+		{low, high, 1},
+		{low, strings.Repeat("0", 32) + strings.Repeat("f", 32), 0.5},
+	} {
+		distance, err := SignatureDistance(test.a, test.b)
+		if err != nil {
+			t.Fatalf("error %v", err)
+		}
+		if math.Abs(distance-test.expected) > 1e-9 {
+			t.Errorf("Unexpected distance between %v and %v, got: %v", test.a, test.b, distance)
+		}
+	}
+	_, err := SignatureDistance(low, "0f")
+	if err == nil {
+		t.Errorf("Expected an error for a short signature")
+	}
+	_, err = SignatureDistance(low, strings.Repeat("z", SignatureLength))
+	if err == nil {
+		t.Errorf("Expected an error for an invalid signature")
+	}
+}
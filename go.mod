@@ -4,7 +4,10 @@ go 1.25.0
 
 toolchain go1.25.1
 
-require github.com/AustralianCyberSecurityCentre/azul-bedrock/v10 v10.0.2
+require (
+	github.com/AustralianCyberSecurityCentre/azul-bedrock/v10 v10.0.2
+	github.com/go-viper/mapstructure/v2 v2.4.0
+)
 
 require (
 	github.com/Azure/azure-sdk-for-go/sdk/azcore v1.19.0 // indirect
@@ -12,7 +15,6 @@ require (
 	github.com/Azure/azure-sdk-for-go/sdk/storage/azblob v1.6.2 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/fatih/structs v1.1.0 // indirect
-	github.com/go-viper/mapstructure/v2 v2.4.0 // indirect
 	github.com/goccy/go-json v0.10.5 // indirect
 	github.com/hamba/avro/v2 v2.30.0 // indirect
 	github.com/json-iterator/go v1.1.12 // indirect
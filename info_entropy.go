@@ -9,4 +9,184 @@ type EventInfoEntropy struct {
 	BlockSize  int       `json:"block_size"`
 	BlockCount int       `json:"block_count"`
 	Blocks     []float64 `json:"blocks"`
+	// Set when the analysis stopped before the end of the binary, the results only cover the bytes analysed.
+	Truncated *EventInfoTruncated `json:"truncated,omitempty"`
+	// Set when the binary was sampled rather than read in full, the overall entropy is then an estimate.
+	Sampling *EventInfoSampling `json:"sampling,omitempty"`
+	// Set when only the ranges were analysed, the overall entropy is then of the bytes of the ranges.
+	RangesOnly bool `json:"ranges_only,omitempty"`
+	// Head, tail and ranges of interest analysed on their own.
+	Ranges []EventInfoRange `json:"ranges,omitempty"`
+	// Block entropies at other resolutions.
+	Resolutions []EventInfoResolution `json:"resolutions,omitempty"`
+	// Fuzzy signature of the shape of the blocks, see entropy.Signature.
+	Signature string `json:"signature,omitempty"`
+	// Verdict of the classifier.
+	Classification *EventInfoClassification `json:"classification,omitempty"`
+	// How unusual the binary is for its type, when a baseline model is loaded.
+	Anomaly *EventInfoAnomaly `json:"anomaly,omitempty"`
+	// Nearest profiles in the local similarity index.
+	Neighbours []EventInfoNeighbour `json:"neighbours,omitempty"`
+	Strings    []EventInfoString    `json:"strings,omitempty"`
+	Encoded    []EventInfoEncoded   `json:"encoded,omitempty"`
+	Xor        []EventInfoXor       `json:"xor,omitempty"`
+	Digraph    *EventInfoDigraph    `json:"digraph,omitempty"`
+	Histogram  *EventInfoHistogram  `json:"histogram,omitempty"`
+	// Granularity of the range index attached to the binary.
+	RangeIndex *EventInfoRangeIndex `json:"range_index,omitempty"`
+	// Executable format and sections, when the structure of the binary is known.
+	Format   string             `json:"format,omitempty"`
+	Sections []EventInfoSection `json:"sections,omitempty"`
+}
+
+// Why the analysis stopped before the end of the binary.
+type EventInfoTruncated struct {
+	// Bytes from the start of the binary that were analysed, only blocks entirely within them are reported.
+	AnalysedBytes uint64 `json:"analysed_bytes"`
+	Reason        string `json:"reason"`
+}
+
+// Entropy and statistics of a range of the binary.
+type EventInfoRange struct {
+	// head, tail or the name of the feature of another plugin the range is from.
+	Label          string  `json:"label"`
+	Offset         uint64  `json:"offset"`
+	Size           uint64  `json:"size"`
+	Entropy        float64 `json:"entropy"`
+	DistinctBytes  int     `json:"distinct_bytes"`
+	PrintableRatio float64 `json:"printable_ratio"`
+	ZeroRatio      float64 `json:"zero_ratio"`
+	ChiSquare      float64 `json:"chi_square"`
+}
+
+// Windows sampled from a binary too large to read in full.
+type EventInfoSampling struct {
+	// Windows are evenly spaced, or at random within equal shares of the binary.
+	Mode         string `json:"mode"`
+	Windows      int    `json:"windows"`
+	WindowSize   uint64 `json:"window_size"`
+	SampledBytes uint64 `json:"sampled_bytes"`
+	// Confidence interval of the overall entropy, from resampling the windows.
+	Confidence  float64 `json:"confidence"`
+	OverallLow  float64 `json:"overall_low"`
+	OverallHigh float64 `json:"overall_high"`
+	// Entropy of each window, a sparse profile of the binary.
+	Blocks []EventInfoSampledBlock `json:"blocks"`
+}
+
+// Entropy of a window sampled from the binary.
+type EventInfoSampledBlock struct {
+	Offset  uint64  `json:"offset"`
+	Entropy float64 `json:"entropy"`
+}
+
+// Block entropies at another resolution than the blocks.
+type EventInfoResolution struct {
+	// Maximum number of blocks requested, small binaries have fewer blocks of the minimum size.
+	MaxBlocks  int       `json:"max_blocks"`
+	BlockSize  int       `json:"block_size"`
+	BlockCount int       `json:"block_count"`
+	Blocks     []float64 `json:"blocks"`
+}
+
+// Range index attached to the binary, see entropy.RangeIndex.
+type EventInfoRangeIndex struct {
+	// Ranges are measured to the nearest multiple of the granule size.
+	GranuleSize uint64 `json:"granule_size"`
+	Granules    int    `json:"granules"`
+}
+
+// Class of the binary predicted by the classifier.
+type EventInfoClassification struct {
+	Class       string  `json:"class"`
+	Probability float64 `json:"probability"`
+	// Probability of every class the model knows.
+	Probabilities map[string]float64 `json:"probabilities"`
+}
+
+// Score of the binary against the baseline of its type.
+type EventInfoAnomaly struct {
+	// Declared or detected type the binary was scored against.
+	Type string `json:"type"`
+	// Largest absolute z-score of the metrics.
+	Score float64 `json:"score"`
+	// Number of standard deviations each metric is from the mean of the type.
+	ZScores map[string]float64 `json:"z_scores"`
+}
+
+// Binary in the local similarity index with a profile like this one.
+type EventInfoNeighbour struct {
+	Sha256 string `json:"sha256"`
+	// Distance between the signatures, from 0 for the same shape to 1.
+	Distance float64 `json:"distance"`
+}
+
+// High entropy string that may be a key or token.
+type EventInfoString struct {
+	Offset            uint64  `json:"offset"`
+	Size              uint64  `json:"size"`
+	Value             string  `json:"value"`
+	Encoding          string  `json:"encoding"`
+	Charset           string  `json:"charset"`
+	Entropy           float64 `json:"entropy"`
+	NormalisedEntropy float64 `json:"normalised_entropy"`
+}
+
+// Region of the file encoded with a restricted alphabet such as base64.
+type EventInfoEncoded struct {
+	Offset         uint64  `json:"offset"`
+	Size           uint64  `json:"size"`
+	Encoding       string  `json:"encoding"`
+	DecodedLength  uint64  `json:"decoded_length"`
+	DecodedEntropy float64 `json:"decoded_entropy"`
+}
+
+// XOR key recovered from the binary.
+type EventInfoXor struct {
+	Offset uint64 `json:"offset"`
+	// Hex encoded key aligned to the start of the binary.
+	Key            string  `json:"key"`
+	KeyLength      int     `json:"key_length"`
+	Magic          string  `json:"magic,omitempty"`
+	Count          int     `json:"count"`
+	Entropy        float64 `json:"entropy,omitempty"`
+	DecodedEntropy float64 `json:"decoded_entropy,omitempty"`
+}
+
+// Byte transition (digraph) matrix.
+type EventInfoDigraph struct {
+	// 256x256 matrix indexed by from*256 + to, of log scaled transition counts quantised to 16 levels.
+	// Packed two cells per byte (high nibble first), zlib compressed and base64 encoded.
+	Matrix string `json:"matrix"`
+	// Transition count represented by the top level.
+	MaxCount            uint64  `json:"max_count"`
+	Total               uint64  `json:"total"`
+	NullTransitionRatio float64 `json:"null_transition_ratio"`
+	RepeatRatio         float64 `json:"repeat_ratio"`
+	PrintableRatio      float64 `json:"printable_ratio"`
+	DistinctRatio       float64 `json:"distinct_ratio"`
+}
+
+// Byte histogram of the whole binary.
+type EventInfoHistogram struct {
+	// Ratio of all bytes for each of the 256 byte values.
+	Normalised     []float64                `json:"normalised"`
+	DistinctBytes  int                      `json:"distinct_bytes"`
+	MostFrequent   []EventInfoByteFrequency `json:"most_frequent"`
+	PrintableRatio float64                  `json:"printable_ratio"`
+	ZeroRatio      float64                  `json:"zero_ratio"`
+	// Pearson's chi-square statistic against a uniform distribution of byte values.
+	ChiSquare float64 `json:"chi_square"`
+}
+
+type EventInfoByteFrequency struct {
+	Byte  byte    `json:"byte"`
+	Ratio float64 `json:"ratio"`
+}
+
+// Section of an executable with content in the binary.
+type EventInfoSection struct {
+	Name   string `json:"name"`
+	Offset uint64 `json:"offset"`
+	Size   uint64 `json:"size"`
 }
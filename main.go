@@ -2,22 +2,32 @@
 package main
 
 import (
+	"bytes"
+	"compress/zlib"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 
 	"github.com/AustralianCyberSecurityCentre/azul-bedrock/v10/gosrc/events"
 	"github.com/AustralianCyberSecurityCentre/azul-bedrock/v10/gosrc/plugin"
+	"github.com/AustralianCyberSecurityCentre/azul-bedrock/v10/gosrc/settings"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/baseline"
 	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/entropy"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/render"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/similarity"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/stdio"
 )
 
-// Maximum number of blocks for calculating entropy, no reason why 800 could be changed in the future.
-const Blocks = 800
-
-// 10MB
-var maxBufferSize = uint64(10 * 1024 * 1024)
-
 type EntropyPlugin struct {
+	// Plugin specific settings, defaults are used if not set.
+	settings *EntropySettings
+	// Local similarity index binaries are added to, nil if disabled.
+	index *similarity.Index
+	// Baselines of each file type binaries are scored against, nil if disabled.
+	baseline *baseline.Model
 }
 
 func (ep *EntropyPlugin) GetName() string {
@@ -25,7 +35,7 @@ func (ep *EntropyPlugin) GetName() string {
 }
 
 func (ep *EntropyPlugin) GetVersion() string {
-	return "2025.05.16"
+	return "2026.10.18"
 }
 
 func (ep *EntropyPlugin) GetDescription() string {
@@ -35,56 +45,187 @@ func (ep *EntropyPlugin) GetDescription() string {
 func (ep *EntropyPlugin) GetFeatures() []events.PluginEntityFeature {
 	return []events.PluginEntityFeature{
 		{Name: "entropy", Type: "float", Description: "Overall entropy calculated for the binary"},
+		{Name: "head_entropy", Type: "float", Description: "Entropy of the first bytes of the binary"},
+		{Name: "tail_entropy", Type: "float", Description: "Entropy of the last bytes of the binary"},
+		{Name: "interest_entropy", Type: "float", Description: "Entropy of a range found by another plugin, labelled with the name of its feature"},
+		{Name: "entropy_sampled", Type: "string", Description: "Windows sampled to estimate the entropy of a binary too large to read in full"},
+		{Name: "entropy_truncated", Type: "integer", Description: "Bytes analysed before the time budget ran out, the other results only cover these bytes"},
+		{Name: "high_entropy_string", Type: "string", Description: "Printable string with high entropy that may be a key or token, labelled with its charset"},
+		{Name: "encoded_blob", Type: "string", Description: "Encoding of a hex, base32, base64 or ascii85 encoded region of the binary"},
+		{Name: "encoded_high_entropy_blob", Type: "string", Description: "Encoding of an encoded region whose decoded bytes have high entropy, likely an encrypted or compressed payload"},
+		{Name: "xor_key", Type: "string", Description: "Hex encoded XOR key recovered from the binary, labelled with the format it decodes to if known"},
+		{Name: "xor_encoded_format", Type: "string", Description: "File format found encoded with a single byte XOR key"},
+		{Name: "digraph_null_transition_ratio", Type: "float", Description: "Ratio of byte transitions into a null byte"},
+		{Name: "digraph_repeat_ratio", Type: "float", Description: "Ratio of byte transitions to the same byte"},
+		{Name: "digraph_printable_ratio", Type: "float", Description: "Ratio of byte transitions between two printable characters"},
+		{Name: "digraph_distinct_ratio", Type: "float", Description: "Ratio of the 65536 possible byte transitions that occur"},
+		{Name: "entropy_anomaly", Type: "float", Description: "Largest z-score of the entropy metrics against the baseline of the file type, labelled with the type"},
+		{Name: "entropy_class", Type: "string", Description: "Class of the binary predicted from its entropy, such as packed, encrypted or benign"},
+		{Name: "entropy_class_probability", Type: "float", Description: "Probability of the predicted class, labelled with the class"},
+		{Name: "entropy_signature", Type: "string", Description: "Fuzzy signature of the shape of the entropy profile, one hex digit per point"},
 	}
 }
 
+// Time left after the time budget for the truncated results to be published before the runner aborts the job.
+const runTimeoutMargin = 60
+
+// Runner settings that fit the entropy settings, so the runner doesn't abort a job the time budget would have
+// truncated or drop values of the features that are limited by the entropy settings.
 func (ep *EntropyPlugin) GetDefaultSettings() *plugin.PluginSettings {
-	return plugin.NewDefaultPluginSettings()
+	pluginSettings := plugin.NewDefaultPluginSettings()
+	config := ep.getSettings()
+	if budget := int(config.TimeBudget.Seconds()); budget > 0 && pluginSettings.PluginRunTimeout > 0 {
+		pluginSettings.WithPluginRunTimeout(max(pluginSettings.PluginRunTimeout, budget+runTimeoutMargin))
+	}
+	pluginSettings.WithMaxValuesPerFeature(max(pluginSettings.MaxValuesPerFeature, config.StringsMaxCandidates, config.EncodedMaxBlobs, config.XorMaxCandidates))
+	return pluginSettings
 }
 
-func (ep *EntropyPlugin) Execute(context context.Context, job *plugin.Job, inputUtils *plugin.PluginInputUtils) *plugin.PluginError {
-	bufferedEntropy := entropy.NewBuffered(job.GetSourceEvent().Entity.Size, Blocks)
+// Get the plugin specific settings, falling back to the defaults.
+func (ep *EntropyPlugin) getSettings() *EntropySettings {
+	if ep.settings == nil {
+		return NewDefaultEntropySettings()
+	}
+	return ep.settings
+}
 
-	endOfFile := false
-	var rawChunk []byte
-	var err error
-	var pluginErr *plugin.PluginError
-	startChunk := uint64(0)
-	// Calculate entropy
-	for !endOfFile {
-		rawChunk, endOfFile, pluginErr = job.GetContentChunk(startChunk, startChunk+maxBufferSize)
+func (ep *EntropyPlugin) Execute(context context.Context, job *plugin.Job, inputUtils *plugin.PluginInputUtils) *plugin.PluginError {
+	entity := job.GetSourceEvent().Entity
+	interest := interestRanges(entity.Features, ep.getSettings().interestFeatures())
+	result, pluginErr := analyse(context, ep.getSettings(), entity.Size, job, interest)
+	if pluginErr != nil {
+		return pluginErr
+	}
+	if ep.index != nil {
+		ep.updateIndex(entity.Sha256, &result.Info)
+	}
+	if ep.baseline != nil {
+		ep.scoreAnomaly(entity.FileFormat, result)
+	}
+	// Rendering the profile is skipped unless debug logging is on.
+	if event := settings.Logger.Debug(); event.Enabled() {
+		event.Str("sha256", entity.Sha256).Float64("entropy", result.Info.Overall).
+			Str("profile", render.Sparkline(profileFromInfo(&result.Info, entity.Size, ep.getSettings().bands()), 80)).Msg("entropy profile")
+	}
+	settings.Logger.Debug().Str("sha256", entity.Sha256).Int("chunks", result.Metrics.Chunks).
+		Dur("fetch", result.Metrics.Fetch).Dur("analysis", result.Metrics.Analysis).Dur("wait", result.Metrics.Wait).
+		Dur("overlap", result.Metrics.Overlap()).Dur("elapsed", result.Metrics.Elapsed).Msg("fetch timing")
+	encodedEntropyInfo, err := json.Marshal(&map[string]any{"entropy": result.Info})
+	if err != nil {
+		return plugin.NewPluginError(plugin.ErrorException, "Failed to marshal info", fmt.Sprintf("could not marshal produced entropy info %v", result.Info)).WithCausalError(err)
+	}
+	job.AddInfo(encodedEntropyInfo)
+	for _, feature := range result.Features {
+		pluginErr = job.AddFeatureWithExtra(feature.Name, feature.Value, &plugin.AddFeatureOptions{
+			Label:  feature.Label,
+			Offset: feature.Offset,
+			Size:   feature.Size,
+		})
 		if pluginErr != nil {
 			return pluginErr
 		}
-		bufferedEntropy.AppendAndCalculateBufferedValues(rawChunk)
-		startChunk += uint64(len(rawChunk))
 	}
+	for _, stream := range result.Streams {
+		err = job.AddAugmentedBytes(stream.Data, stream.Label)
+		if err != nil {
+			return plugin.NewPluginError(plugin.ErrorException, "Failed to add stream", fmt.Sprintf("could not attach the %s stream", stream.Name)).WithCausalError(err)
+		}
+	}
+	return nil
+}
 
-	entChunks, entSize, entCount := bufferedEntropy.GetChunkEntropySizeAndCount()
-	overall, err := bufferedEntropy.TotalValue()
+// Find the nearest profiles to the binary in the similarity index, then add the binary to the index.
+// Failing to update the index is logged rather than failing the job, the rest of the analysis is still published.
+func (ep *EntropyPlugin) updateIndex(sha256 string, info *EventInfoEntropy) {
+	signature := entropy.Signature(info.Blocks)
+	if signature == "" {
+		return
+	}
+	// One more in case the binary was already added.
+	neighbours, err := ep.index.Query(signature, ep.getSettings().IndexNeighbours+1)
 	if err != nil {
-		return plugin.NewPluginError(plugin.ErrorException, "TotalValue error", "TotalValue error").WithCausalError(err)
+		settings.Logger.Warn().Err(err).Str("sha256", sha256).Msg("could not query the similarity index")
+		return
 	}
-
-	entropyInfo := EventInfoEntropy{
-		Overall:    overall,
-		Blocks:     entChunks,
-		BlockSize:  entSize,
-		BlockCount: entCount,
+	for _, neighbour := range neighbours {
+		if neighbour.Name != sha256 && len(info.Neighbours) < ep.getSettings().IndexNeighbours {
+			info.Neighbours = append(info.Neighbours, EventInfoNeighbour{Sha256: neighbour.Name, Distance: neighbour.Distance})
+		}
 	}
-	encodedEntropyInfo, err := json.Marshal(&map[string]any{"entropy": entropyInfo})
+	err = ep.index.Add(sha256, signature)
 	if err != nil {
-		return plugin.NewPluginError(plugin.ErrorException, "Failed to marshal info", fmt.Sprintf("could not marshal produced entropy info %v", entropyInfo)).WithCausalError(err)
+		settings.Logger.Warn().Err(err).Str("sha256", sha256).Msg("could not add to the similarity index")
 	}
-	job.AddInfo(encodedEntropyInfo)
-	pluginErr = job.AddFeature("entropy", overall)
-	if pluginErr != nil {
-		return pluginErr
+}
+
+// Compress a quantised matrix with zlib and base64 encode it for the info.
+func compressMatrix(matrix []byte) (string, error) {
+	var buf bytes.Buffer
+	writer := zlib.NewWriter(&buf)
+	_, err := writer.Write(matrix)
+	if err != nil {
+		return "", err
 	}
-	return nil
+	err = writer.Close()
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
 }
 
 func main() {
-	pr := plugin.NewPluginRunner(&EntropyPlugin{})
+	subcommands := map[string]func([]string, *EntropySettings, io.Reader, io.Writer, io.Writer) int{
+		cliCommand:        runCli,
+		compareCommand:    runCompare,
+		indexCommand:      runIndex,
+		baselineCommand:   runBaseline,
+		classifierCommand: runClassifier,
+		rangeCommand:      runRange,
+	}
+	if run, ok := subcommands[firstArg(os.Args)]; ok {
+		// Settings are printed to os.Stdout as they are parsed, which points at stderr so stdout only has the results.
+		config, err := ParseEntropySettings()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		os.Exit(run(os.Args[2:], config, os.Stdin, stdio.Stdout, os.Stderr))
+	}
+	// Otherwise the plugin is run, which prints its settings to stdout as usual.
+	stdio.Restore()
+	config, err := ParseEntropySettings()
+	if err != nil {
+		settings.Logger.Fatal().Err(err).Msg("invalid entropy settings")
+	}
+	entropyPlugin := &EntropyPlugin{settings: config}
+	if config.IndexPath != "" {
+		index, err := similarity.Open(config.IndexPath)
+		if err == nil {
+			err = index.SetMaxEntries(config.IndexMaxEntries)
+		}
+		if err != nil {
+			settings.Logger.Fatal().Err(err).Msg("could not open the similarity index")
+		}
+		if repaired := index.Repaired(); repaired != nil {
+			settings.Logger.Warn().Err(repaired).Msg("dropped the partial last line of the similarity index")
+		}
+		entropyPlugin.index = index
+	}
+	if config.BaselinePath != "" {
+		model, err := baseline.Load(config.BaselinePath)
+		if err != nil {
+			settings.Logger.Fatal().Err(err).Msg("could not load the baseline model")
+		}
+		entropyPlugin.baseline = model
+	}
+	pr := plugin.NewPluginRunner(entropyPlugin)
 	pr.Run()
 }
+
+// Subcommand the binary was run with, empty when run as a plugin.
+func firstArg(args []string) string {
+	if len(args) < 2 {
+		return ""
+	}
+	return args[1]
+}
@@ -1,9 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"encoding/base64"
+	"encoding/binary"
+	"math/rand"
+	"strings"
 	"testing"
 
 	"github.com/AustralianCyberSecurityCentre/azul-bedrock/v10/gosrc/plugin"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/baseline"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/entropy"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/similarity"
 )
 
 func TestGeneratedBinary(t *testing.T) {
@@ -59,8 +69,9 @@ func TestSimpleExe(t *testing.T) {
 
 func TestSimpleExeDifferentBufferSize(t *testing.T) {
 	// Lower buffer size to 1kb (that was multiple chunks are requested but nothing should change)
-	maxBufferSize = uint64(1 * 1024)
-	pr := plugin.NewPluginRunner(&EntropyPlugin{})
+	settings := NewDefaultEntropySettings()
+	settings.FetchChunkSize = 1024
+	pr := plugin.NewPluginRunner(&EntropyPlugin{settings: settings})
 
 	result := pr.RunTest(t, &plugin.RunTestOptions{
 		DownloadSha256: "702e31ed1537c279459a255460f12f0f2863f973e121cd9194957f4f3e7b0994", // ~27kB
@@ -81,3 +92,607 @@ func TestSimpleExeDifferentBufferSize(t *testing.T) {
 		},
 	})
 }
+
+func TestHighEntropyStrings(t *testing.T) {
+	settings := NewDefaultEntropySettings()
+	settings.StringsEnabled = true
+	pr := plugin.NewPluginRunner(&EntropyPlugin{settings: settings})
+
+	binary := []byte(strings.Repeat("\x00", 300) + "9f86d081884c7d659a2feaa0c55ad015" + strings.Repeat("\x00", 300))
+
+	result := pr.RunTest(t, &plugin.RunTestOptions{
+		ContentFileBytes:            binary,
+		DisableUncartingContentFile: true,
+	}, "Hex key surrounded by nulls.")
+	result.AssertJobResultEqual(t, &plugin.TestJobResult{
+		Status: "completed",
+		Events: []plugin.TestJobEvent{
+			{
+				Features: map[string][]plugin.TestBinaryEntityFeature{
+					"entropy": {
+						{
+							Value: "0.47339943599062273",
+						},
+					},
+					"high_entropy_string": {
+						{
+							Value:  "9f86d081884c7d659a2feaa0c55ad015",
+							Label:  "hex",
+							Offset: 300,
+							Size:   32,
+						},
+					},
+				},
+				Info: "{\"entropy\":{\"overall\":0.47339943599062273,\"block_size\":256,\"block_count\":2,\"blocks\":[0,0.9986043845889443],\"strings\":[{\"offset\":300,\"size\":32,\"value\":\"9f86d081884c7d659a2feaa0c55ad015\",\"encoding\":\"ascii\",\"charset\":\"hex\",\"entropy\":3.640319531114783,\"normalised_entropy\":0.9100798827786958}]}}",
+			},
+		},
+	})
+}
+
+func TestEncodedBlob(t *testing.T) {
+	settings := NewDefaultEntropySettings()
+	settings.EncodedEnabled = true
+	pr := plugin.NewPluginRunner(&EntropyPlugin{settings: settings})
+
+	payload := make([]byte, 600)
+	rand.New(rand.NewSource(1)).Read(payload)
+	binary := []byte(strings.Repeat("\x00", 100) + base64.StdEncoding.EncodeToString(payload) + strings.Repeat("\x00", 100))
+
+	result := pr.RunTest(t, &plugin.RunTestOptions{
+		ContentFileBytes:            binary,
+		DisableUncartingContentFile: true,
+	}, "Base64 encoded random payload surrounded by nulls.")
+	result.AssertJobResultEqual(t, &plugin.TestJobResult{
+		Status: "completed",
+		Events: []plugin.TestJobEvent{
+			{
+				Features: map[string][]plugin.TestBinaryEntityFeature{
+					"encoded_blob": {
+						{
+							Value:  "base64",
+							Size:   800,
+							Offset: 100,
+						},
+					},
+					"encoded_high_entropy_blob": {
+						{
+							Value:  "base64",
+							Size:   800,
+							Offset: 100,
+						},
+					},
+					"entropy": {
+						{
+							Value: "5.470358437992659",
+						},
+					},
+				},
+				Info: "{\"entropy\":{\"overall\":5.470358437992659,\"block_size\":256,\"block_count\":3,\"blocks\":[4.323141225929148,5.819426530525536,5.784684917284986],\"encoded\":[{\"offset\":100,\"size\":800,\"encoding\":\"base64\",\"decoded_length\":600,\"decoded_entropy\":7.6174827044826126}]}}",
+			},
+		},
+	})
+}
+
+func TestXorEncodedPe(t *testing.T) {
+	settings := NewDefaultEntropySettings()
+	settings.XorEnabled = true
+	pr := plugin.NewPluginRunner(&EntropyPlugin{settings: settings})
+
+	// Minimal DOS header and stub encoded with a single byte key.
+	pe := make([]byte, 1024)
+	copy(pe, "MZ")
+	copy(pe[0x4e:], "This program cannot be run in DOS mode.")
+	binary := make([]byte, 256)
+	for _, b := range pe {
+		binary = append(binary, b^0x5a)
+	}
+
+	result := pr.RunTest(t, &plugin.RunTestOptions{
+		ContentFileBytes:            binary,
+		DisableUncartingContentFile: true,
+	}, "DOS stub encoded with single byte XOR key 0x5a.")
+	result.AssertJobResultEqual(t, &plugin.TestJobResult{
+		Status: "completed",
+		Events: []plugin.TestJobEvent{
+			{
+				Features: map[string][]plugin.TestBinaryEntityFeature{
+					"entropy": {
+						{
+							Value: "1.0448526529855282",
+						},
+					},
+					"xor_encoded_format": {
+						{
+							Value:  "pe",
+							Offset: 256,
+						},
+					},
+					"xor_key": {
+						{
+							Value:  "5a",
+							Label:  "pe",
+							Offset: 256,
+						},
+					},
+				},
+				Info: "{\"entropy\":{\"overall\":1.0448526529855282,\"block_size\":256,\"block_count\":5,\"blocks\":[0,1.3163174917169371,0,0,0],\"xor\":[{\"offset\":256,\"key\":\"5a\",\"key_length\":1,\"magic\":\"pe\",\"count\":1}]}}",
+			},
+		},
+	})
+}
+
+// Build a minimal little endian ELF64 with a .text section of the given bytes and a section name table.
+func buildElf(t *testing.T, text []byte) []byte {
+	names := []byte("\x00.text\x00.shstrtab\x00")
+	textOffset := uint64(64)
+	namesOffset := textOffset + uint64(len(text))
+	headersOffset := namesOffset + uint64(len(names))
+	header := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     headersOffset,
+		Ehsize:    64,
+		Shentsize: 64,
+		Shnum:     3,
+		Shstrndx:  2,
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	sectionHeaders := []elf.Section64{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_PROGBITS), Off: textOffset, Size: uint64(len(text))},
+		{Name: 7, Type: uint32(elf.SHT_STRTAB), Off: namesOffset, Size: uint64(len(names))},
+	}
+	var buf bytes.Buffer
+	for _, part := range []any{header, text, names, sectionHeaders} {
+		err := binary.Write(&buf, binary.LittleEndian, part)
+		if err != nil {
+			t.Fatalf("error building elf %v", err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestDigraph(t *testing.T) {
+	settings := NewDefaultEntropySettings()
+	settings.DigraphEnabled = true
+	pr := plugin.NewPluginRunner(&EntropyPlugin{settings: settings})
+
+	result := pr.RunTest(t, &plugin.RunTestOptions{
+		ContentFileBytes:            bytes.Repeat([]byte("ab\x00"), 100),
+		DisableUncartingContentFile: true,
+	}, "Repeated printable and null bytes.")
+	result.AssertJobResultEqual(t, &plugin.TestJobResult{
+		Status: "completed",
+		Events: []plugin.TestJobEvent{
+			{
+				Features: map[string][]plugin.TestBinaryEntityFeature{
+					"digraph_distinct_ratio": {
+						{
+							Value: "0.0000457763671875",
+						},
+					},
+					"digraph_null_transition_ratio": {
+						{
+							Value: "0.33444816053511706",
+						},
+					},
+					"digraph_printable_ratio": {
+						{
+							Value: "0.33444816053511706",
+						},
+					},
+					"digraph_repeat_ratio": {
+						{
+							Value: "0",
+						},
+					},
+					"entropy": {
+						{
+							Value: "1.584962500721156",
+						},
+					},
+				},
+				Info: "{\"entropy\":{\"overall\":1.584962500721156,\"block_size\":256,\"block_count\":1,\"blocks\":[1.5849405154383214],\"digraph\":{\"matrix\":\"eJzszCEBADAMA8E5mH+XkzAU1oKygvsjQTnDboYkSZIkSZIkSZIkSZIkSZIkSVLXy1h5BwAAAAAAAAAAAAAAAAAAAAAAAAClPwBwZAHw\",\"max_count\":100,\"total\":299,\"null_transition_ratio\":0.33444816053511706,\"repeat_ratio\":0,\"printable_ratio\":0.33444816053511706,\"distinct_ratio\":0.0000457763671875}}}",
+			},
+		},
+	})
+}
+
+func TestHistogram(t *testing.T) {
+	settings := NewDefaultEntropySettings()
+	settings.HistogramEnabled = true
+	settings.HistogramTopBytes = 2
+	pr := plugin.NewPluginRunner(&EntropyPlugin{settings: settings})
+
+	result := pr.RunTest(t, &plugin.RunTestOptions{
+		ContentFileBytes:            bytes.Repeat([]byte("aab\x00"), 100),
+		DisableUncartingContentFile: true,
+	}, "Repeated printable and null bytes.")
+	result.AssertJobResultEqual(t, &plugin.TestJobResult{
+		Status: "completed",
+		Events: []plugin.TestJobEvent{
+			{
+				Features: map[string][]plugin.TestBinaryEntityFeature{
+					"entropy": {
+						{
+							Value: "1.5",
+						},
+					},
+				},
+				Info: "{\"entropy\":{\"overall\":1.5,\"block_size\":256,\"block_count\":1,\"blocks\":[1.5],\"histogram\":{\"normalised\":[0.25,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0.5,0.25,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0,0],\"distinct_bytes\":3,\"most_frequent\":[{\"byte\":97,\"ratio\":0.5},{\"byte\":0,\"ratio\":0.25}],\"printable_ratio\":0.75,\"zero_ratio\":0.25,\"chi_square\":38000}}}",
+			},
+		},
+	})
+}
+
+func TestEntropyGraph(t *testing.T) {
+	settings := NewDefaultEntropySettings()
+	settings.GraphEnabled = true
+	settings.GraphWidth = 100
+	settings.GraphHeight = 50
+	pr := plugin.NewPluginRunner(&EntropyPlugin{settings: settings})
+
+	content := append(bytes.Repeat([]byte{0}, 1024), bytes.Repeat([]byte("abcdefgh"), 128)...)
+	result := pr.RunTest(t, &plugin.RunTestOptions{
+		ContentFileBytes:            content,
+		DisableUncartingContentFile: true,
+	}, "Null padding followed by text.")
+	result.AssertJobResultEqual(t, &plugin.TestJobResult{
+		Status: "completed",
+		Events: []plugin.TestJobEvent{
+			{
+				Features: map[string][]plugin.TestBinaryEntityFeature{
+					"entropy": {
+						{
+							Value: "2.5",
+						},
+					},
+				},
+				Info: "{\"entropy\":{\"overall\":2.5,\"block_size\":256,\"block_count\":8,\"blocks\":[0,0,0,0,3,3,3,3]}}",
+				AugmentedStreams: []plugin.ResultStream{
+					{
+						Label:  "safe_png",
+						Sha256: "2044717504a9a8fdad1967aedd5eb2d0ee63b087ecbcec2af2f45b098999b425",
+						Size:   366,
+					},
+				},
+			},
+		},
+	})
+}
+
+func TestHilbertMap(t *testing.T) {
+	settings := NewDefaultEntropySettings()
+	settings.HilbertEnabled = true
+	settings.HilbertMode = "class"
+	settings.HilbertSize = 64
+	pr := plugin.NewPluginRunner(&EntropyPlugin{settings: settings})
+
+	content := append(bytes.Repeat([]byte{0}, 1024), bytes.Repeat([]byte("abcdefgh"), 128)...)
+	result := pr.RunTest(t, &plugin.RunTestOptions{
+		ContentFileBytes:            content,
+		DisableUncartingContentFile: true,
+	}, "Null padding followed by text.")
+	result.AssertJobResultEqual(t, &plugin.TestJobResult{
+		Status: "completed",
+		Events: []plugin.TestJobEvent{
+			{
+				Features: map[string][]plugin.TestBinaryEntityFeature{
+					"entropy": {
+						{
+							Value: "2.5",
+						},
+					},
+				},
+				Info: "{\"entropy\":{\"overall\":2.5,\"block_size\":256,\"block_count\":8,\"blocks\":[0,0,0,0,3,3,3,3]}}",
+				AugmentedStreams: []plugin.ResultStream{
+					{
+						Label:  "safe_png",
+						Sha256: "9ff14b1c0c59cea546469e30531f72b18b97405babda3671ffc5a7ba3405dd98",
+						Size:   181,
+					},
+				},
+			},
+		},
+	})
+}
+
+func TestCharts(t *testing.T) {
+	settings := NewDefaultEntropySettings()
+	settings.ChartsEnabled = true
+	settings.ChartWidth = 200
+	settings.ChartHeight = 100
+	pr := plugin.NewPluginRunner(&EntropyPlugin{settings: settings})
+
+	content := append(bytes.Repeat([]byte{0}, 1024), bytes.Repeat([]byte("abcdefgh"), 128)...)
+	result := pr.RunTest(t, &plugin.RunTestOptions{
+		ContentFileBytes:            content,
+		DisableUncartingContentFile: true,
+	}, "Null padding followed by text.")
+	result.AssertJobResultEqual(t, &plugin.TestJobResult{
+		Status: "completed",
+		Events: []plugin.TestJobEvent{
+			{
+				Features: map[string][]plugin.TestBinaryEntityFeature{
+					"entropy": {
+						{
+							Value: "2.5",
+						},
+					},
+				},
+				Info: "{\"entropy\":{\"overall\":2.5,\"block_size\":256,\"block_count\":8,\"blocks\":[0,0,0,0,3,3,3,3]}}",
+				AugmentedStreams: []plugin.ResultStream{
+					{
+						Label:  "report",
+						Sha256: "1f5142486b3ccbbbf2fc8021a36ce529850feba495e38b8598ec575938c3be85",
+						Size:   2620,
+					},
+					{
+						Label:  "report",
+						Sha256: "ac2f294d54c60a1dc254124e6aa9a534b3525aae7b1b7359e31c372817f9d659",
+						Size:   1966,
+					},
+				},
+			},
+		},
+	})
+}
+
+func TestElfSections(t *testing.T) {
+	settings := NewDefaultEntropySettings()
+	settings.SectionsEnabled = true
+	pr := plugin.NewPluginRunner(&EntropyPlugin{settings: settings})
+	// Only keep the ELF header in memory so the section headers at the end are downloaded.
+	defaultHeadSize := contentHeadSize
+	contentHeadSize = 64
+	defer func() { contentHeadSize = defaultHeadSize }()
+
+	text := make([]byte, 512)
+	for i := range text {
+		text[i] = byte(i)
+	}
+	result := pr.RunTest(t, &plugin.RunTestOptions{
+		ContentFileBytes:            buildElf(t, text),
+		DisableUncartingContentFile: true,
+	}, "Minimal ELF with a .text section.")
+	result.AssertJobResultEqual(t, &plugin.TestJobResult{
+		Status: "completed",
+		Events: []plugin.TestJobEvent{
+			{
+				Features: map[string][]plugin.TestBinaryEntityFeature{
+					"entropy": {
+						{
+							Value: "6.440060666527105",
+						},
+					},
+				},
+				Info: "{\"entropy\":{\"overall\":6.440060666527105,\"block_size\":256,\"block_count\":3,\"blocks\":[6.775448006491229,8,3.043950684641839],\"format\":\"elf\",\"sections\":[{\"name\":\".text\",\"offset\":64,\"size\":512},{\"name\":\".shstrtab\",\"offset\":576,\"size\":17}]}}",
+			},
+		},
+	})
+}
+
+func TestEntropySignature(t *testing.T) {
+	settings := NewDefaultEntropySettings()
+	settings.SignatureEnabled = true
+	pr := plugin.NewPluginRunner(&EntropyPlugin{settings: settings})
+
+	content := append(bytes.Repeat([]byte{0}, 1024), bytes.Repeat([]byte("abcdefgh"), 128)...)
+	result := pr.RunTest(t, &plugin.RunTestOptions{
+		ContentFileBytes:            content,
+		DisableUncartingContentFile: true,
+	}, "Null padding followed by text.")
+	result.AssertJobResultEqual(t, &plugin.TestJobResult{
+		Status: "completed",
+		Events: []plugin.TestJobEvent{
+			{
+				Features: map[string][]plugin.TestBinaryEntityFeature{
+					"entropy": {
+						{
+							Value: "2.5",
+						},
+					},
+					"entropy_signature": {
+						{
+							Value: "0000000000000000000000000000000066666666666666666666666666666666",
+						},
+					},
+				},
+				Info: "{\"entropy\":{\"overall\":2.5,\"block_size\":256,\"block_count\":8,\"blocks\":[0,0,0,0,3,3,3,3],\"signature\":\"0000000000000000000000000000000066666666666666666666666666666666\"}}",
+			},
+		},
+	})
+}
+
+func TestSimilarityIndex(t *testing.T) {
+	index := similarity.New()
+	err := index.Add("known", strings.Repeat("0", entropy.SignatureLength))
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	pr := plugin.NewPluginRunner(&EntropyPlugin{settings: NewDefaultEntropySettings(), index: index})
+	result := pr.RunTest(t, &plugin.RunTestOptions{
+		ContentFileBytes:            bytes.Repeat([]byte("a"), 1024),
+		DisableUncartingContentFile: true,
+	}, "Binary with the same shape as one in the index.")
+	result.AssertJobResultEqual(t, &plugin.TestJobResult{
+		Status: "completed",
+		Events: []plugin.TestJobEvent{
+			{
+				Features: map[string][]plugin.TestBinaryEntityFeature{
+					"entropy": {
+						{
+							Value: "0",
+						},
+					},
+				},
+				Info: "{\"entropy\":{\"overall\":0,\"block_size\":256,\"block_count\":4,\"blocks\":[0,0,0,0],\"neighbours\":[{\"sha256\":\"known\",\"distance\":0}]}}",
+			},
+		},
+	})
+	if index.Len() != 2 {
+		t.Errorf("Expected the binary to be added to the index, got %v entries", index.Len())
+	}
+}
+
+func TestAnomalyScore(t *testing.T) {
+	model := baseline.NewModel()
+	for _, overall := range []float64{3.9, 4.0, 4.1} {
+		model.Add("text/plain", baseline.Metrics{"overall": overall})
+	}
+	pr := plugin.NewPluginRunner(&EntropyPlugin{settings: NewDefaultEntropySettings(), baseline: model})
+	// Detected as text from the start of the content, with random bytes after that.
+	content := append(bytes.Repeat([]byte("text "), 200), make([]byte, 1024)...)
+	rand.New(rand.NewSource(1)).Read(content[1000:])
+	result := pr.RunTest(t, &plugin.RunTestOptions{
+		ContentFileBytes:            content,
+		DisableUncartingContentFile: true,
+	}, "Text followed by random bytes.")
+	result.AssertJobResultEqual(t, &plugin.TestJobResult{
+		Status: "completed",
+		Events: []plugin.TestJobEvent{
+			{
+				Features: map[string][]plugin.TestBinaryEntityFeature{
+					"entropy": {
+						{
+							Value: "5.843957020039579",
+						},
+					},
+					"entropy_anomaly": {
+						{
+							Value: "18.43957020039585",
+							Label: "text/plain",
+						},
+					},
+				},
+				Info: "{\"entropy\":{\"overall\":5.843957020039579,\"block_size\":256,\"block_count\":7,\"blocks\":[1.9195678452284752,1.923446737869055,1.923446737869055,2.5845430801977836,7.076886597686943,7.175009314400863,7.180263134588153],\"anomaly\":{\"type\":\"text/plain\",\"score\":18.43957020039585,\"z_scores\":{\"overall\":18.43957020039585}}}}",
+			},
+		},
+	})
+}
+
+func TestDefaultClassifier(t *testing.T) {
+	settings := NewDefaultEntropySettings()
+	settings.ClassifierEnabled = true
+	pr := plugin.NewPluginRunner(&EntropyPlugin{settings: settings})
+
+	content := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(content)
+	result := pr.RunTest(t, &plugin.RunTestOptions{
+		ContentFileBytes:            content,
+		DisableUncartingContentFile: true,
+	}, "Random bytes.")
+	result.AssertJobResultEqual(t, &plugin.TestJobResult{
+		Status: "completed",
+		Events: []plugin.TestJobEvent{
+			{
+				Features: map[string][]plugin.TestBinaryEntityFeature{
+					"entropy": {
+						{
+							Value: "7.955386112402645",
+						},
+					},
+					"entropy_class": {
+						{
+							Value: "encrypted",
+						},
+					},
+					"entropy_class_probability": {
+						{
+							Value: "0.9709514431833155",
+							Label: "encrypted",
+						},
+					},
+				},
+				Info: "{\"entropy\":{\"overall\":7.955386112402645,\"block_size\":256,\"block_count\":16,\"blocks\":[7.103272876992269,7.137218017366849,7.220359472504132,7.110984472504132,7.141844373011515,7.176686890740203,7.121846656297594,7.226257031114784,7.243406873011515,7.175653052824225,7.154130494213573,7.214715552824225,7.211275769538145,7.159537048843471,7.26738720694674,7.155401697179559],\"classification\":{\"class\":\"encrypted\",\"probability\":0.9709514431833155,\"probabilities\":{\"benign\":4.4859660097268677e-7,\"encrypted\":0.9709514431833155,\"packed\":0.029048108220083562}}}}",
+			},
+		},
+	})
+}
+
+func TestDefaultClassifierSizes(t *testing.T) {
+	settings := NewDefaultEntropySettings()
+	settings.ClassifierEnabled = true
+	random := rand.New(rand.NewSource(1))
+	// The features of random data don't depend on its length, so it is encrypted at every size.
+	for _, size := range []int{4 * 1024, 10 * 1024, 64 * 1024, 200 * 1024, 1024 * 1024, 4 * 1024 * 1024} {
+		content := make([]byte, size)
+		random.Read(content)
+		result, pluginErr := analyse(context.Background(), settings, uint64(size), &readerSource{reader: bytes.NewReader(content), size: uint64(size)}, nil)
+		if pluginErr != nil {
+			t.Fatalf("error %v", pluginErr)
+		}
+		if classification := result.Info.Classification; classification.Class != "encrypted" || classification.Probability < 0.8 {
+			t.Errorf("Size %v - Expected random bytes to be encrypted, got: %+v", size, classification)
+		}
+	}
+}
+
+func TestConfiguredBlocks(t *testing.T) {
+	settings := NewDefaultEntropySettings()
+	settings.Blocks = 4
+	settings.MinBlockSize = 100
+	settings.FetchChunkSize = 300
+	settings.DigraphEnabled = true
+	settings.DisabledFeatures = "digraph_null_transition_ratio,digraph_printable_ratio,digraph_distinct_ratio"
+	pr := plugin.NewPluginRunner(&EntropyPlugin{settings: settings})
+
+	content := append(bytes.Repeat([]byte{'a'}, 500), bytes.Repeat([]byte{'a', 'b'}, 250)...)
+	result := pr.RunTest(t, &plugin.RunTestOptions{
+		ContentFileBytes:            content,
+		DisableUncartingContentFile: true,
+	}, "Half repeated bytes, half alternating bytes.")
+	// Four blocks larger than the minimum, and the disabled digraph features are only in the info.
+	result.AssertJobResultEqual(t, &plugin.TestJobResult{
+		Status: "completed",
+		Events: []plugin.TestJobEvent{
+			{
+				Features: map[string][]plugin.TestBinaryEntityFeature{
+					"digraph_repeat_ratio": {
+						{
+							Value: "0.5005005005005005",
+						},
+					},
+					"entropy": {
+						{
+							Value: "0.8112781244591328",
+						},
+					},
+				},
+				Info: "{\"entropy\":{\"overall\":0.8112781244591328,\"block_size\":250,\"block_count\":4,\"blocks\":[0,0,1,1],\"digraph\":{\"matrix\":\"eJzsxjEJADAMBMAaKPXvqpIyvYBAIMvddAcAAAAAAAAAAAAAAGDY+9mOmwAAAAAAAAAAAAAAAAAAAAAAAABAQw0AmrcA7Q==\",\"max_count\":500,\"total\":999,\"null_transition_ratio\":0,\"repeat_ratio\":0.5005005005005005,\"printable_ratio\":1,\"distinct_ratio\":0.0000457763671875}}}",
+			},
+		},
+	})
+}
+
+func TestResolutions(t *testing.T) {
+	settings := NewDefaultEntropySettings()
+	settings.ResolutionBlocks = "2,16"
+	pr := plugin.NewPluginRunner(&EntropyPlugin{settings: settings})
+
+	content := append(bytes.Repeat([]byte{'a'}, 2048), bytes.Repeat([]byte{'a', 'b'}, 1024)...)
+	result := pr.RunTest(t, &plugin.RunTestOptions{
+		ContentFileBytes:            content,
+		DisableUncartingContentFile: true,
+	}, "Half repeated bytes, half alternating bytes.")
+	// A coarse overview of two blocks, and a finer view with the same blocks as there are no more than 16.
+	result.AssertJobResultEqual(t, &plugin.TestJobResult{
+		Status: "completed",
+		Events: []plugin.TestJobEvent{
+			{
+				Features: map[string][]plugin.TestBinaryEntityFeature{
+					"entropy": {
+						{
+							Value: "0.8112781244591328",
+						},
+					},
+				},
+				Info: "{\"entropy\":{\"overall\":0.8112781244591328,\"block_size\":256,\"block_count\":16,\"blocks\":[0,0,0,0,0,0,0,0,1,1,1,1,1,1,1,1],\"resolutions\":[{\"max_blocks\":2,\"block_size\":2048,\"block_count\":2,\"blocks\":[0,1]},{\"max_blocks\":16,\"block_size\":256,\"block_count\":16,\"blocks\":[0,0,0,0,0,0,0,0,1,1,1,1,1,1,1,1]}]}}",
+			},
+		},
+	})
+}
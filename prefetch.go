@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/AustralianCyberSecurityCentre/azul-bedrock/v10/gosrc/plugin"
+)
+
+// Chunk of content fetched ahead of the analysis.
+type fetchedChunk struct {
+	data      []byte
+	endOfFile bool
+	pluginErr *plugin.PluginError
+	// Time spent fetching the chunk.
+	duration time.Duration
+}
+
+// Fetches the content of a binary in chunks of chunkSize bytes, in order. Up to depth chunks are fetched on another
+// goroutine ahead of the chunk being analysed, so fetching the next chunk overlaps with analysing the current one.
+// With a depth of 0 each chunk is fetched when it is needed.
+type chunkFetcher struct {
+	source    ContentSource
+	chunkSize uint64
+	depth     int
+	// Start of the next chunk fetched when not prefetching.
+	next   uint64
+	chunks chan fetchedChunk
+	done   chan struct{}
+	stop   sync.Once
+}
+
+// Create a fetcher prefetching up to depth chunks, limited so the chunks held ahead of the analysis take no more than
+// maxBytes.
+func newChunkFetcher(source ContentSource, chunkSize uint64, depth int, maxBytes uint64) *chunkFetcher {
+	// The end of a chunk is inclusive, so each chunk is one byte more than the chunk size.
+	depth = int(min(uint64(max(depth, 0)), maxBytes/(chunkSize+1)))
+	f := &chunkFetcher{source: source, chunkSize: chunkSize, depth: depth, done: make(chan struct{})}
+	if f.depth > 0 {
+		// The fetching goroutine holds one chunk while waiting to send it.
+		f.chunks = make(chan fetchedChunk, f.depth-1)
+		go f.prefetch()
+	}
+	return f
+}
+
+// Fetch chunks until the end of the content, an error, or the fetcher is closed.
+func (f *chunkFetcher) prefetch() {
+	start := uint64(0)
+	for {
+		chunk := f.fetch(start)
+		select {
+		case f.chunks <- chunk:
+		case <-f.done:
+			return
+		}
+		if chunk.pluginErr != nil || chunk.endOfFile {
+			return
+		}
+		start += uint64(len(chunk.data))
+	}
+}
+
+func (f *chunkFetcher) fetch(start uint64) fetchedChunk {
+	started := time.Now()
+	data, endOfFile, pluginErr := f.source.GetContentChunk(start, start+f.chunkSize)
+	return fetchedChunk{data: data, endOfFile: endOfFile, pluginErr: pluginErr, duration: time.Since(started)}
+}
+
+// Get the next chunk, or the error of the context if it is done first. Nothing more should be read after the end of
+// the content or an error. Without prefetching a fetch that has started can't be interrupted.
+func (f *chunkFetcher) Next(ctx context.Context) (fetchedChunk, error) {
+	if err := ctx.Err(); err != nil {
+		return fetchedChunk{}, err
+	}
+	if f.depth == 0 {
+		chunk := f.fetch(f.next)
+		f.next += uint64(len(chunk.data))
+		return chunk, nil
+	}
+	select {
+	case chunk := <-f.chunks:
+		return chunk, nil
+	case <-ctx.Done():
+		return fetchedChunk{}, ctx.Err()
+	}
+}
+
+// Stop prefetching, for when the analysis ends before the end of the content.
+func (f *chunkFetcher) Close() {
+	f.stop.Do(func() { close(f.done) })
+}
+
+// Time spent fetching and analysing the content of a binary.
+type fetchMetrics struct {
+	Chunks int
+	// Total time fetching chunks, on the prefetching goroutine when prefetching.
+	Fetch time.Duration
+	// Total time analysing chunks.
+	Analysis time.Duration
+	// Time the analysis waited for the next chunk.
+	Wait time.Duration
+	// Time from the first fetch to the end of the analysis of the last chunk.
+	Elapsed time.Duration
+}
+
+// Time fetching and analysis ran at the same time, zero without prefetching.
+func (m fetchMetrics) Overlap() time.Duration {
+	return max(m.Fetch+m.Analysis-m.Elapsed, 0)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AustralianCyberSecurityCentre/azul-bedrock/v10/gosrc/plugin"
+)
+
+// Source that takes a fixed time to fetch each chunk, and fails from an offset.
+type slowSource struct {
+	readerSource
+	delay  time.Duration
+	failAt uint64
+}
+
+func (s *slowSource) GetContentChunk(startChunk uint64, endChunk uint64) ([]byte, bool, *plugin.PluginError) {
+	time.Sleep(s.delay)
+	if s.failAt != 0 && startChunk >= s.failAt {
+		return nil, false, plugin.NewPluginError(plugin.ErrorNetwork, "Failed to fetch content chunk", "connection reset")
+	}
+	return s.readerSource.GetContentChunk(startChunk, endChunk)
+}
+
+func newSlowSource(content []byte, delay time.Duration) *slowSource {
+	return &slowSource{readerSource: readerSource{reader: bytes.NewReader(content), size: uint64(len(content))}, delay: delay}
+}
+
+func TestChunkFetcher(t *testing.T) {
+	content := make([]byte, 10000)
+	rand.New(rand.NewSource(1)).Read(content)
+	for _, depth := range []int{0, 1, 3} {
+		fetcher := newChunkFetcher(newSlowSource(content, 0), 999, depth, 1<<20)
+		fetched := []byte{}
+		for chunks := 0; ; chunks++ {
+			chunk, err := fetcher.Next(context.Background())
+			if err != nil || chunk.pluginErr != nil || chunks > 10 {
+				t.Fatalf("Depth %d - Unexpected chunk %d: %v %v", depth, chunks, err, chunk.pluginErr)
+			}
+			fetched = append(fetched, chunk.data...)
+			if chunk.endOfFile {
+				break
+			}
+		}
+		fetcher.Close()
+		if !bytes.Equal(fetched, content) {
+			t.Errorf("Depth %d - Expected the chunks in order", depth)
+		}
+	}
+
+	// Chunks held ahead are limited by the memory cap.
+	if depth := newChunkFetcher(newSlowSource(content, 0), 999, 8, 3000).depth; depth != 3 {
+		t.Errorf("Expected the depth to be capped, got: %v", depth)
+	}
+	fetcher := newChunkFetcher(newSlowSource(content, 0), 999, 8, 500)
+	if chunk, err := fetcher.Next(context.Background()); fetcher.depth != 0 || err != nil || chunk.pluginErr != nil {
+		t.Errorf("Expected chunks larger than the cap to be fetched when needed, got: %v", fetcher.depth)
+	}
+
+	source := newSlowSource(content, 0)
+	source.failAt = 2000
+	fetcher = newChunkFetcher(source, 999, 2, 1<<20)
+	defer fetcher.Close()
+	fetcher.Next(context.Background())
+	fetcher.Next(context.Background())
+	if chunk, _ := fetcher.Next(context.Background()); chunk.pluginErr == nil {
+		t.Errorf("Expected the fetch error to be returned")
+	}
+
+	// A slow fetch is interrupted when the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	fetcher = newChunkFetcher(newSlowSource(content, time.Minute), 999, 2, 1<<20)
+	defer fetcher.Close()
+	if _, err := fetcher.Next(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected the context to interrupt the fetch, got: %v", err)
+	}
+}
+
+func TestAnalysisPrefetch(t *testing.T) {
+	content := make([]byte, 64*1024)
+	rand.New(rand.NewSource(1)).Read(content)
+	settings := NewDefaultEntropySettings()
+	settings.FetchChunkSize = 8 * 1024
+	serialSettings := *settings
+	serialSettings.PrefetchDepth = 0
+
+	serial, pluginErr := analyse(context.Background(), &serialSettings, uint64(len(content)), newSlowSource(content, 5*time.Millisecond), nil)
+	if pluginErr != nil {
+		t.Fatalf("error %v", pluginErr)
+	}
+	prefetched, pluginErr := analyse(context.Background(), settings, uint64(len(content)), newSlowSource(content, 5*time.Millisecond), nil)
+	if pluginErr != nil {
+		t.Fatalf("error %v", pluginErr)
+	}
+	if prefetched.Info.Overall != serial.Info.Overall || len(prefetched.Features) != len(serial.Features) {
+		t.Errorf("Expected prefetching to give the same results")
+	}
+	metrics := prefetched.Metrics
+	if metrics.Chunks != 8 || metrics.Fetch < 40*time.Millisecond || metrics.Elapsed < metrics.Fetch {
+		t.Errorf("Unexpected metrics, got: %+v", metrics)
+	}
+	// Without prefetching the analysis waits for every fetch.
+	if serial.Metrics.Overlap() != 0 || serial.Metrics.Wait < serial.Metrics.Fetch {
+		t.Errorf("Unexpected serial metrics, got: %+v", serial.Metrics)
+	}
+
+	source := newSlowSource(content, 0)
+	source.failAt = 16 * 1024
+	_, pluginErr = analyse(context.Background(), settings, uint64(len(content)), source, nil)
+	if pluginErr == nil || !strings.Contains(pluginErr.Error(), "connection reset") {
+		t.Errorf("Expected the fetch error to fail the analysis, got: %v", pluginErr)
+	}
+}
+
+func TestAnalysisTimeBudget(t *testing.T) {
+	content := make([]byte, 64*1024)
+	rand.New(rand.NewSource(1)).Read(content[32*1024:])
+	settings := NewDefaultEntropySettings()
+	settings.FetchChunkSize = 8 * 1024
+	settings.PrefetchDepth = 0
+	settings.TimeBudget = 50 * time.Millisecond
+	settings.ResolutionBlocks = "64,4096"
+	// Chunks take 20ms each, so the budget runs out after a few chunks.
+	result, pluginErr := analyse(context.Background(), settings, uint64(len(content)), newSlowSource(content, 20*time.Millisecond), nil)
+	if pluginErr != nil {
+		t.Fatalf("error %v", pluginErr)
+	}
+	truncated := result.Info.Truncated
+	if truncated == nil || truncated.AnalysedBytes == 0 || truncated.AnalysedBytes >= uint64(len(content)) || truncated.AnalysedBytes%(8*1024+1) != 0 {
+		t.Fatalf("Expected the results to be truncated, got: %+v", truncated)
+	}
+	// Only the null bytes were analysed, in whole blocks.
+	if result.Info.Overall != 0 || result.Info.BlockCount != int(truncated.AnalysedBytes)/result.Info.BlockSize || len(result.Info.Blocks) != result.Info.BlockCount {
+		t.Errorf("Unexpected truncated blocks, got: %v %v %v", result.Info.Overall, result.Info.BlockCount, len(result.Info.Blocks))
+	}
+	for _, resolution := range result.Info.Resolutions {
+		if resolution.BlockCount*resolution.BlockSize > int(truncated.AnalysedBytes) || len(resolution.Blocks) != resolution.BlockCount {
+			t.Errorf("Unexpected truncated resolution, got: %+v", resolution)
+		}
+	}
+	found := false
+	for _, feature := range result.Features {
+		found = found || (feature.Name == "entropy_truncated" && feature.Value == truncated.AnalysedBytes)
+	}
+	if !found {
+		t.Errorf("Expected the truncation to be a feature, got: %+v", result.Features)
+	}
+
+	// Cancelling the context fails the analysis rather than truncating it.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	_, pluginErr = analyse(ctx, settings, uint64(len(content)), newSlowSource(content, 20*time.Millisecond), nil)
+	if pluginErr == nil || !strings.Contains(pluginErr.Error(), "cancelled") {
+		t.Errorf("Expected the cancelled analysis to fail, got: %v", pluginErr)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/AustralianCyberSecurityCentre/azul-bedrock/v10/gosrc/events"
+	"github.com/AustralianCyberSecurityCentre/azul-bedrock/v10/gosrc/plugin"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/entropy"
+)
+
+// Range of a binary analysed on its own, such as its head and tail or a region found by another plugin.
+type byteRange struct {
+	Label  string
+	Offset uint64
+	Size   uint64
+}
+
+// Whether only the ranges of a binary of the given size are analysed rather than the whole binary.
+func (s *EntropySettings) rangesOnly(size uint64) bool {
+	return s.RangesOnlyThreshold > 0 && size > uint64(s.RangesOnlyThreshold)
+}
+
+// Head and tail of a binary of the given size, either is left out when its size is 0. The tail starts after the head
+// so they don't cover the same bytes, and is left out when the head covers the whole binary.
+func (s *EntropySettings) headTailRanges(size uint64) []byteRange {
+	ranges := []byteRange{}
+	head := min(uint64(s.HeadSize), size)
+	if head > 0 {
+		ranges = append(ranges, byteRange{Label: "head", Offset: 0, Size: head})
+	}
+	if tail := min(uint64(s.TailSize), size-head); tail > 0 {
+		ranges = append(ranges, byteRange{Label: "tail", Offset: size - tail, Size: tail})
+	}
+	return ranges
+}
+
+// Ranges of interest from the features of other plugins that have an offset and size, labelled with the feature name.
+func interestRanges(features []events.BinaryEntityFeature, names map[string]bool) []byteRange {
+	ranges := []byteRange{}
+	for _, feature := range features {
+		if names[feature.Name] && feature.Size > 0 {
+			ranges = append(ranges, byteRange{Label: feature.Name, Offset: feature.Offset, Size: feature.Size})
+		}
+	}
+	return ranges
+}
+
+// Fetch only the ranges of a binary and calculate the entropy and statistics of each, also returning the counts of all
+// the bytes fetched. Ranges are cut off at the end of the binary and at maxSize bytes, ranges starting after the end of
+// the binary are left out. On an error the ranges analysed before it are returned with it.
+func analyseRanges(ctx context.Context, reader io.ReaderAt, size uint64, ranges []byteRange, maxSize uint64) ([]EventInfoRange, [256]int, *plugin.PluginError) {
+	results := []EventInfoRange{}
+	var total [256]int
+	for _, r := range ranges {
+		if err := ctx.Err(); err != nil {
+			return results, total, cancelledError(err)
+		}
+		if r.Offset >= size {
+			continue
+		}
+		buf := make([]byte, min(r.Size, size-r.Offset, maxSize))
+		n, err := reader.ReadAt(buf, int64(r.Offset))
+		var downloadErr *plugin.PluginError
+		if errors.As(err, &downloadErr) {
+			return results, total, downloadErr
+		}
+		if err != nil && !(errors.Is(err, io.EOF) && n == len(buf)) {
+			return results, total, plugin.NewPluginError(plugin.ErrorException, "Failed to read range", fmt.Sprintf("could not read the %s range", r.Label)).WithCausalError(err)
+		}
+		var counts [256]int
+		for _, b := range buf {
+			counts[b]++
+			total[b]++
+		}
+		stats := entropy.CalculateHistogramStats(counts, 0)
+		results = append(results, EventInfoRange{
+			Label:          r.Label,
+			Offset:         r.Offset,
+			Size:           uint64(len(buf)),
+			Entropy:        entropy.CountsValue(counts),
+			DistinctBytes:  stats.DistinctBytes,
+			PrintableRatio: stats.PrintableRatio,
+			ZeroRatio:      stats.ZeroRatio,
+			ChiSquare:      stats.ChiSquare,
+		})
+	}
+	return results, total, nil
+}
+
+// Analyse the head, tail and ranges of interest of a binary into the result, adding a feature for each and returning
+// the counts of all the bytes of the ranges. On an error the ranges analysed before it are still added.
+func addRanges(ctx context.Context, result *analysisResult, config *EntropySettings, reader io.ReaderAt, size uint64, interest []byteRange) ([256]int, *plugin.PluginError) {
+	ranges, counts, pluginErr := analyseRanges(ctx, reader, size, append(config.headTailRanges(size), interest...), uint64(config.InterestMaxSize))
+	result.Info.Ranges = ranges
+	for _, r := range ranges {
+		switch r.Label {
+		case "head":
+			result.addFeature("head_entropy", r.Entropy, &plugin.AddFeatureOptions{Offset: r.Offset, Size: r.Size})
+		case "tail":
+			result.addFeature("tail_entropy", r.Entropy, &plugin.AddFeatureOptions{Offset: r.Offset, Size: r.Size})
+		default:
+			result.addFeature("interest_entropy", r.Entropy, &plugin.AddFeatureOptions{Label: r.Label, Offset: r.Offset, Size: r.Size})
+		}
+	}
+	return counts, pluginErr
+}
+
+// Analyse only the head, tail and ranges of interest of a binary too large to analyse in full.
+// The overall entropy is of the bytes of the ranges and isn't added as a feature. When the time budget runs out the
+// results are of the ranges analysed so far, marked as truncated.
+func analyseRangesOnly(ctx context.Context, config *EntropySettings, size uint64, source ContentSource, interest []byteRange) (*analysisResult, *plugin.PluginError) {
+	contentReader := newContentReader(source, size)
+	head, _, pluginErr := source.GetContentChunk(0, min(uint64(contentHeadSize), size)-1)
+	if pluginErr != nil {
+		return nil, pluginErr
+	}
+	contentReader.setHead(head)
+
+	result := &analysisResult{Size: size, disabledFeatures: config.disabledFeatures()}
+	result.Info = EventInfoEntropy{Blocks: []float64{}, RangesOnly: true}
+	// Overlapping ranges, such as the head and a range of interest within it, count the bytes they share for each.
+	budget, cancel := config.budgetContext(ctx)
+	defer cancel()
+	counts, pluginErr := addRanges(budget, result, config, contentReader, size, interest)
+	// The ranges are cancelled when the time budget runs out, which only truncates the results.
+	truncated := pluginErr != nil && pluginErr.GetInnerError() == plugin.ErrorTimeout && budget.Err() != nil && ctx.Err() == nil
+	if pluginErr != nil && !truncated {
+		return nil, pluginErr
+	}
+	result.Info.Overall = entropy.CountsValue(counts)
+	if truncated {
+		analysed := uint64(0)
+		for _, r := range result.Info.Ranges {
+			analysed += r.Size
+		}
+		result.truncate(config, analysed)
+	}
+	// As when reading in full, the sections aren't parsed once the time budget has run out.
+	if config.SectionsEnabled && !truncated {
+		pluginErr = sectionsInfo(&result.Info, contentReader)
+		if pluginErr != nil {
+			return nil, pluginErr
+		}
+	}
+	result.FileType = detectFileType(result.Info.Format, contentReader.head)
+	result.ChiSquare = entropy.ChiSquare(counts)
+	return result, nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AustralianCyberSecurityCentre/azul-bedrock/v10/gosrc/events"
+	"github.com/AustralianCyberSecurityCentre/azul-bedrock/v10/gosrc/plugin"
+)
+
+func TestInterestRanges(t *testing.T) {
+	features := []events.BinaryEntityFeature{
+		{Name: "pe_overlay", Value: "overlay", Offset: 100, Size: 50},
+		{Name: "pe_section", Value: ".text", Offset: 0x400, Size: 0x200},
+		{Name: "pe_overlay", Value: "empty", Offset: 200},
+	}
+	ranges := interestRanges(features, map[string]bool{"pe_overlay": true})
+	if len(ranges) != 1 || ranges[0] != (byteRange{Label: "pe_overlay", Offset: 100, Size: 50}) {
+		t.Errorf("Expected only the named features with a size, got: %+v", ranges)
+	}
+	if ranges := interestRanges(features, map[string]bool{}); len(ranges) != 0 {
+		t.Errorf("Expected no ranges without feature names, got: %+v", ranges)
+	}
+}
+
+func TestHeadTailRanges(t *testing.T) {
+	settings := NewDefaultEntropySettings()
+	settings.HeadSize = 4096
+	settings.TailSize = 4096
+	tables := []struct {
+		size   uint64
+		ranges []byteRange
+	}{
+		{0, []byteRange{}},
+		// The head covers the whole binary, so there is no tail.
+		{3000, []byteRange{{"head", 0, 3000}}},
+		// The tail starts after the head.
+		{6000, []byteRange{{"head", 0, 4096}, {"tail", 4096, 1904}}},
+		{100000, []byteRange{{"head", 0, 4096}, {"tail", 95904, 4096}}},
+	}
+	for _, table := range tables {
+		if ranges := settings.headTailRanges(table.size); !reflect.DeepEqual(ranges, table.ranges) {
+			t.Errorf("Size %v - Unexpected ranges, got: %+v", table.size, ranges)
+		}
+	}
+}
+
+func TestAnalysisRanges(t *testing.T) {
+	content := make([]byte, 64*1024)
+	rand.New(rand.NewSource(1)).Read(content[60*1024:])
+	settings := NewDefaultEntropySettings()
+	settings.HeadSize = 1024
+	settings.TailSize = 2048
+	settings.InterestMaxSize = 4096
+	interest := []byteRange{
+		{Label: "overlay", Offset: 62 * 1024, Size: 8 * 1024},
+		{Label: "large", Offset: 0, Size: 32 * 1024},
+		{Label: "after", Offset: 64 * 1024, Size: 10},
+	}
+	source := &readerSource{reader: bytes.NewReader(content), size: uint64(len(content))}
+	result, pluginErr := analyse(context.Background(), settings, uint64(len(content)), source, interest)
+	if pluginErr != nil {
+		t.Fatalf("error %v", pluginErr)
+	}
+	// Ranges are cut off at the end of the binary and the maximum size, those after the end are left out.
+	ranges := result.Info.Ranges
+	expected := []byteRange{{"head", 0, 1024}, {"tail", 62 * 1024, 2048}, {"overlay", 62 * 1024, 2048}, {"large", 0, 4096}}
+	if len(ranges) != len(expected) {
+		t.Fatalf("Unexpected ranges, got: %+v", ranges)
+	}
+	for i, r := range expected {
+		if ranges[i].Label != r.Label || ranges[i].Offset != r.Offset || ranges[i].Size != r.Size {
+			t.Errorf("Expected range %+v, got: %+v", r, ranges[i])
+		}
+	}
+	if ranges[0].Entropy != 0 || ranges[0].ZeroRatio != 1 || ranges[1].Entropy < 7.8 || ranges[1].DistinctBytes < 200 {
+		t.Errorf("Unexpected range statistics, got: %+v", ranges)
+	}
+	features := map[string]analysisFeature{}
+	for _, feature := range result.Features {
+		features[feature.Name+feature.Label] = feature
+	}
+	if feature, ok := features["interest_entropyoverlay"]; !ok || feature.Offset != 62*1024 || feature.Size != 2048 {
+		t.Errorf("Expected the range of interest to be a labelled feature, got: %+v", result.Features)
+	}
+	if _, ok := features["tail_entropy"]; !ok {
+		t.Errorf("Expected the tail to be a feature, got: %+v", result.Features)
+	}
+
+	// Disabling the head and tail leaves only the ranges of interest.
+	settings.HeadSize = 0
+	settings.TailSize = 0
+	result, _ = analyse(context.Background(), settings, uint64(len(content)), source, nil)
+	if len(result.Info.Ranges) != 0 {
+		t.Errorf("Expected no ranges, got: %+v", result.Info.Ranges)
+	}
+}
+
+// Content source recording the start of each chunk fetched.
+type recordingSource struct {
+	readerSource
+	lock   sync.Mutex
+	starts []uint64
+}
+
+func (s *recordingSource) GetContentChunk(startChunk uint64, endChunk uint64) ([]byte, bool, *plugin.PluginError) {
+	s.lock.Lock()
+	s.starts = append(s.starts, startChunk)
+	s.lock.Unlock()
+	return s.readerSource.GetContentChunk(startChunk, endChunk)
+}
+
+func TestTailFromChunks(t *testing.T) {
+	content := make([]byte, 64*1024)
+	rand.New(rand.NewSource(1)).Read(content)
+	settings := NewDefaultEntropySettings()
+	settings.FetchChunkSize = 8 * 1024
+	settings.TailSize = 12 * 1024
+	source := &recordingSource{readerSource: readerSource{reader: bytes.NewReader(content), size: uint64(len(content))}}
+	result, pluginErr := analyse(context.Background(), settings, uint64(len(content)), source, nil)
+	if pluginErr != nil {
+		t.Fatalf("error %v", pluginErr)
+	}
+	if ranges := result.Info.Ranges; len(ranges) != 1 || ranges[0].Offset != 52*1024 || ranges[0].Entropy < 7.9 {
+		t.Errorf("Unexpected tail, got: %+v", ranges)
+	}
+	// Only the chunks are fetched, the tail spanning two of them isn't fetched again.
+	if len(source.starts) != 8 {
+		t.Errorf("Expected only the chunks to be fetched, got: %v", source.starts)
+	}
+}
+
+func TestRangesOnly(t *testing.T) {
+	content := make([]byte, 64*1024)
+	rand.New(rand.NewSource(1)).Read(content[:4096])
+	settings := NewDefaultEntropySettings()
+	settings.RangesOnlyThreshold = 32 * 1024
+	settings.HeadSize = 4 * 1024
+	settings.TailSize = 4 * 1024
+	source := newSlowSource(content, 0)
+	result, pluginErr := analyse(context.Background(), settings, uint64(len(content)), source, []byteRange{{Label: "middle", Offset: 30 * 1024, Size: 4096}})
+	if pluginErr != nil {
+		t.Fatalf("error %v", pluginErr)
+	}
+	info := result.Info
+	if !info.RangesOnly || len(info.Ranges) != 3 || len(info.Blocks) != 0 || len(info.Resolutions) != 0 {
+		t.Fatalf("Expected only the ranges to be analysed, got: %+v", info)
+	}
+	// A third of the bytes of the ranges are random, the rest are null bytes.
+	if info.Overall < 3.5 || info.Overall > 3.6 || info.Ranges[0].Entropy < 7.9 || info.Ranges[2].Entropy != 0 {
+		t.Errorf("Unexpected entropy, got: %v %+v", info.Overall, info.Ranges)
+	}
+	for _, feature := range result.Features {
+		if feature.Name == "entropy" {
+			t.Errorf("Expected the overall entropy of the ranges not to be a feature")
+		}
+	}
+
+	// Binaries below the threshold are read in full.
+	result, pluginErr = analyse(context.Background(), settings, 32*1024, &readerSource{reader: bytes.NewReader(content[:32*1024]), size: 32 * 1024}, nil)
+	if pluginErr != nil || result.Info.RangesOnly || len(result.Info.Blocks) == 0 {
+		t.Errorf("Expected the binary to be read in full, got: %v", pluginErr)
+	}
+}
+
+func TestRangesOnlyTimeBudget(t *testing.T) {
+	content := make([]byte, 256*1024)
+	settings := NewDefaultEntropySettings()
+	settings.RangesOnlyThreshold = 32 * 1024
+	settings.TailSize = 4 * 1024
+	settings.TimeBudget = 50 * time.Millisecond
+	interest := []byteRange{}
+	for i := range 8 {
+		interest = append(interest, byteRange{Label: "interest", Offset: uint64(96+i*16) * 1024, Size: 1024})
+	}
+	// Ranges outside the head take 20ms each, so the budget runs out after a few ranges.
+	result, pluginErr := analyse(context.Background(), settings, uint64(len(content)), newSlowSource(content, 20*time.Millisecond), interest)
+	if pluginErr != nil {
+		t.Fatalf("error %v", pluginErr)
+	}
+	ranges, truncated := result.Info.Ranges, result.Info.Truncated
+	if truncated == nil || len(ranges) == 0 || len(ranges) >= 9 || ranges[0].Label != "tail" {
+		t.Fatalf("Expected the ranges analysed so far, got: %+v %+v", truncated, ranges)
+	}
+	if truncated.AnalysedBytes != 4*1024+uint64(len(ranges)-1)*1024 {
+		t.Errorf("Expected the bytes of the ranges analysed, got: %+v", truncated)
+	}
+	found := false
+	for _, feature := range result.Features {
+		found = found || (feature.Name == "entropy_truncated" && feature.Value == truncated.AnalysedBytes)
+	}
+	if !found {
+		t.Errorf("Expected the truncation to be a feature, got: %+v", result.Features)
+	}
+
+	// Cancelling the context fails the analysis rather than truncating it.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	_, pluginErr = analyse(ctx, settings, uint64(len(content)), newSlowSource(content, 20*time.Millisecond), interest)
+	if pluginErr == nil || !strings.Contains(pluginErr.Error(), "cancelled") {
+		t.Errorf("Expected the cancelled analysis to fail, got: %v", pluginErr)
+	}
+}
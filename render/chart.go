@@ -0,0 +1,96 @@
+package render
+
+import "fmt"
+
+// A labelled range of the file drawn under a chart.
+type Region struct {
+	Label string
+	// Offset of the first byte of the region and the number of bytes it covers.
+	Offset uint64
+	Size   uint64
+}
+
+// Entropy profile of a file with the regions and sections drawn with it.
+type Profile struct {
+	Blocks    []float64
+	BlockSize uint64
+	// Length of the file, the end of the offset axis.
+	Size uint64
+	// Runs of blocks classified by entropy, see ClassifyRegions.
+	Regions []Region
+	// Sections of the file, where its structure is known.
+	Sections []Region
+}
+
+// Size and shading of a rendered chart.
+type ChartOptions struct {
+	// Size of the whole chart in pixels, including axes and labels.
+	Width  int
+	Height int
+	// Entropy ranges shaded behind the line and used to colour regions, DefaultBands if empty.
+	Bands []Band
+}
+
+// Merge consecutive blocks in the same band into regions labelled with the band.
+func ClassifyRegions(blocks []float64, blockSize uint64, bands []Band) []Region {
+	if len(bands) == 0 {
+		bands = DefaultBands
+	}
+	result := []Region{}
+	for i, value := range blocks {
+		label := Classify(value, bands)
+		offset := uint64(i) * blockSize
+		last := len(result) - 1
+		if last >= 0 && result[last].Label == label {
+			result[last].Size += blockSize
+			continue
+		}
+		result = append(result, Region{Label: label, Offset: offset, Size: blockSize})
+	}
+	return result
+}
+
+// Label of the band containing the entropy value, empty if no band contains it.
+// The top band includes its maximum so an entropy of 8 is classified.
+func Classify(value float64, bands []Band) string {
+	if len(bands) == 0 {
+		bands = DefaultBands
+	}
+	for _, band := range bands {
+		if value >= band.Min && (value < band.Max || (band.Max >= maxEntropy && value <= band.Max)) {
+			return band.Label
+		}
+	}
+	return ""
+}
+
+// Colour of the band with the given label, grey for unclassified regions.
+func bandColour(bands []Band, label string) string {
+	for _, band := range bands {
+		if band.Label == label {
+			return hexColour(band.Colour.R, band.Colour.G, band.Colour.B)
+		}
+	}
+	return "#b0b0b0"
+}
+
+func hexColour(r, g, b byte) string {
+	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+}
+
+// Offsets to label on the offset axis, multiples of the smallest power of two that gives at most maxTicks labels.
+func offsetTicks(size uint64, maxTicks int) []uint64 {
+	step := uint64(1)
+	for size/step >= uint64(max(maxTicks, 1)) {
+		step *= 2
+	}
+	ticks := []uint64{}
+	for offset := uint64(0); offset <= size; offset += step {
+		ticks = append(ticks, offset)
+	}
+	return ticks
+}
+
+func formatOffset(offset uint64) string {
+	return fmt.Sprintf("0x%x", offset)
+}
@@ -0,0 +1,141 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testProfile = Profile{
+	Blocks:    []float64{0, 0.5, 5, 5.5, 8, 7.9},
+	BlockSize: 256,
+	Size:      1600,
+	Sections: []Region{
+		{Label: ".text", Offset: 0, Size: 1024},
+		{Label: "<data>", Offset: 1024, Size: 576},
+	},
+}
+
+func TestClassifyRegions(t *testing.T) {
+	regions := ClassifyRegions(testProfile.Blocks, testProfile.BlockSize, nil)
+	expected := []Region{
+		{Label: "padding", Offset: 0, Size: 512},
+		{Label: "code", Offset: 512, Size: 512},
+		{Label: "encrypted", Offset: 1024, Size: 512},
+	}
+	if !reflect.DeepEqual(regions, expected) {
+		t.Errorf("Unexpected regions, got: %v", regions)
+	}
+	if len(ClassifyRegions(nil, 256, nil)) != 0 {
+		t.Errorf("Expected no regions without blocks")
+	}
+}
+
+func TestOffsetTicks(t *testing.T) {
+	ticks := offsetTicks(1600, 4)
+	expected := []uint64{0, 512, 1024, 1536}
+	if !reflect.DeepEqual(ticks, expected) {
+		t.Errorf("Unexpected ticks, got: %v", ticks)
+	}
+	if !reflect.DeepEqual(offsetTicks(0, 4), []uint64{0}) {
+		t.Errorf("Unexpected ticks for empty file, got: %v", offsetTicks(0, 4))
+	}
+}
+
+func TestEntropySVG(t *testing.T) {
+	profile := testProfile
+	profile.Regions = ClassifyRegions(profile.Blocks, profile.BlockSize, nil)
+	svg := EntropySVG(profile, ChartOptions{Width: 400, Height: 200})
+
+	// Must be well formed so it can be embedded in HTML.
+	decoder := xml.NewDecoder(bytes.NewReader(svg))
+	texts := []string{}
+	inText := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Invalid SVG %v\n%s", err, svg)
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			inText = element.Name.Local == "text" || element.Name.Local == "title"
+		case xml.CharData:
+			if inText {
+				texts = append(texts, string(element))
+			}
+		case xml.EndElement:
+			inText = false
+		}
+	}
+	joined := strings.Join(texts, "|") + "|"
+	for _, expected := range []string{"|0x0|", "|0x200|", "|0x600|", ".text 0x0-0x400", "<data> 0x400-0x640", "encrypted 0x400-0x600"} {
+		if !strings.Contains(joined, expected) {
+			t.Errorf("Expected %q in SVG text, got: %v", expected, joined)
+		}
+	}
+	if !bytes.Contains(svg, []byte(`<polyline`)) {
+		t.Errorf("Expected the profile line in the SVG")
+	}
+}
+
+func TestEntropyVegaLite(t *testing.T) {
+	profile := testProfile
+	profile.Regions = ClassifyRegions(profile.Blocks, profile.BlockSize, nil)
+	encoded, err := EntropyVegaLite(profile, ChartOptions{Width: 400, Height: 200})
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	var spec struct {
+		Schema  string `json:"$schema"`
+		Vconcat []struct {
+			Layer []struct {
+				Data struct {
+					Values []map[string]any `json:"values"`
+				} `json:"data"`
+			} `json:"layer"`
+			Data struct {
+				Values []map[string]any `json:"values"`
+			} `json:"data"`
+		} `json:"vconcat"`
+	}
+	err = json.Unmarshal(encoded, &spec)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if spec.Schema != vegaLiteSchema {
+		t.Errorf("Unexpected schema, got: %v", spec.Schema)
+	}
+	// Profile, regions and sections.
+	if len(spec.Vconcat) != 3 {
+		t.Fatalf("Unexpected number of charts, got: %v", len(spec.Vconcat))
+	}
+	if len(spec.Vconcat[0].Layer) != 2 || len(spec.Vconcat[0].Layer[1].Data.Values) != len(profile.Blocks) {
+		t.Errorf("Unexpected profile layers, got: %v", spec.Vconcat[0].Layer)
+	}
+	if spec.Vconcat[0].Layer[1].Data.Values[2]["offset"] != float64(512) {
+		t.Errorf("Unexpected block offset, got: %v", spec.Vconcat[0].Layer[1].Data.Values[2])
+	}
+	if len(spec.Vconcat[1].Data.Values) != 3 || len(spec.Vconcat[2].Data.Values) != 2 {
+		t.Errorf("Unexpected strips, got: %v", spec.Vconcat[1:])
+	}
+	if spec.Vconcat[2].Data.Values[1]["end"] != float64(1600) {
+		t.Errorf("Unexpected section end, got: %v", spec.Vconcat[2].Data.Values[1])
+	}
+
+	// Strips are left out when there is nothing to draw.
+	encoded, err = EntropyVegaLite(Profile{Blocks: profile.Blocks, BlockSize: 256}, ChartOptions{Width: 400, Height: 200})
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	err = json.Unmarshal(encoded, &spec)
+	if err != nil || len(spec.Vconcat) != 1 {
+		t.Errorf("Expected only the profile chart, got: %v %v", err, len(spec.Vconcat))
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Render the entropy profile and byte layout of a file as images so they can be viewed without re-plotting the values.
+*/
+package render
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// Maximum entropy of a byte, the top of the graph.
+const maxEntropy = 8.0
+
+// A range of entropy shaded behind the graph to classify the blocks that fall in it.
+type Band struct {
+	// Entropy range covered by the band, from Min (inclusive) to Max (exclusive).
+	Min    float64
+	Max    float64
+	Colour color.RGBA
+	// Short description of the content expected in the band.
+	Label string
+}
+
+// Classification thresholds shaded by default, from sparse padding up to encrypted or random data.
+var DefaultBands = []Band{
+	{Min: 0, Max: 1, Colour: color.RGBA{0xe8, 0xe8, 0xe8, 0xff}, Label: "padding"},
+	{Min: 1, Max: 4.5, Colour: color.RGBA{0xd6, 0xe9, 0xf8, 0xff}, Label: "text"},
+	{Min: 4.5, Max: 6.5, Colour: color.RGBA{0xd9, 0xf2, 0xd0, 0xff}, Label: "code"},
+	{Min: 6.5, Max: 7.2, Colour: color.RGBA{0xfc, 0xe8, 0xc3, 0xff}, Label: "compressed"},
+	{Min: 7.2, Max: maxEntropy, Colour: color.RGBA{0xf8, 0xd0, 0xd0, 0xff}, Label: "encrypted"},
+}
+
+var (
+	graphBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	graphGrid       = color.RGBA{0xb0, 0xb0, 0xb0, 0xff}
+	graphLine       = color.RGBA{0x1f, 0x3a, 0x93, 0xff}
+)
+
+// Size and shading of a rendered graph.
+type GraphOptions struct {
+	// Size of the image in pixels.
+	Width  int
+	Height int
+	// Entropy ranges shaded behind the line, DefaultBands if empty.
+	Bands []Band
+}
+
+// Render the block entropies as a line plot over the classification bands and encode it as a PNG.
+// The x axis spans the blocks in file order and the y axis entropy from 0 to 8, with grid lines every bit.
+func EntropyGraph(blocks []float64, options GraphOptions) ([]byte, error) {
+	img := DrawEntropyGraph(blocks, options)
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	err := encoder.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Draw the entropy graph described by EntropyGraph without encoding it.
+func DrawEntropyGraph(blocks []float64, options GraphOptions) *image.RGBA {
+	width, height := max(options.Width, 2), max(options.Height, 2)
+	bands := options.Bands
+	if len(bands) == 0 {
+		bands = DefaultBands
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		// Shade each row with the band containing the entropy at the middle of the row.
+		rowColour := graphBackground
+		rowEntropy := (float64(height-y) - 0.5) / float64(height) * maxEntropy
+		for _, band := range bands {
+			if rowEntropy >= band.Min && rowEntropy < band.Max {
+				rowColour = band.Colour
+				break
+			}
+		}
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, rowColour)
+		}
+	}
+	for bit := 1; bit < maxEntropy; bit++ {
+		y := entropyToY(float64(bit), height)
+		for x := 0; x < width; x += 4 {
+			img.SetRGBA(x, y, graphGrid)
+			img.SetRGBA(x+1, y, graphGrid)
+		}
+	}
+
+	switch len(blocks) {
+	case 0:
+	case 1:
+		y := entropyToY(blocks[0], height)
+		drawLine(img, 0, y, width-1, y, graphLine)
+	default:
+		previousX, previousY := 0, entropyToY(blocks[0], height)
+		for i := 1; i < len(blocks); i++ {
+			x := i * (width - 1) / (len(blocks) - 1)
+			y := entropyToY(blocks[i], height)
+			drawLine(img, previousX, previousY, x, y, graphLine)
+			previousX, previousY = x, y
+		}
+	}
+	return img
+}
+
+// Row of the image for an entropy value, clamped to the image.
+func entropyToY(value float64, height int) int {
+	value = min(max(value, 0), maxEntropy)
+	return int((maxEntropy - value) / maxEntropy * float64(height-1))
+}
+
+// Draw a line between two points (inclusive) with Bresenham's algorithm.
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, colour color.RGBA) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	stepX, stepY := 1, 1
+	if x0 > x1 {
+		stepX = -1
+	}
+	if y0 > y1 {
+		stepY = -1
+	}
+	err := dx + dy
+	for {
+		img.SetRGBA(x0, y0, colour)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		doubled := 2 * err
+		if doubled >= dy {
+			err += dy
+			x0 += stepX
+		}
+		if doubled <= dx {
+			err += dx
+			y0 += stepY
+		}
+	}
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
@@ -0,0 +1,53 @@
+package render
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+)
+
+func TestEntropyGraph(t *testing.T) {
+	encoded, err := EntropyGraph([]float64{0, 8, 4}, GraphOptions{Width: 101, Height: 81})
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("error decoding graph %v", err)
+	}
+	if img.Bounds().Dx() != 101 || img.Bounds().Dy() != 81 {
+		t.Errorf("Unexpected size, got: %v", img.Bounds())
+	}
+	// The line starts at the bottom left, peaks in the middle at the top and ends half way up the right.
+	for _, point := range [][2]int{{0, 80}, {50, 0}, {100, 40}} {
+		if img.At(point[0], point[1]) != graphLine {
+			t.Errorf("Expected line at %v, got: %v", point, img.At(point[0], point[1]))
+		}
+	}
+}
+
+func TestDrawEntropyGraphBands(t *testing.T) {
+	img := DrawEntropyGraph(nil, GraphOptions{Width: 10, Height: 80})
+	// Each row covers a tenth of a bit, sample rows clear of the grid lines.
+	expected := map[int]Band{
+		75: DefaultBands[0],
+		50: DefaultBands[1],
+		25: DefaultBands[2],
+		11: DefaultBands[3],
+		2:  DefaultBands[4],
+	}
+	for y, band := range expected {
+		if img.RGBAAt(3, y) != band.Colour {
+			t.Errorf("Expected %v band at row %v, got: %v", band.Label, y, img.RGBAAt(3, y))
+		}
+	}
+}
+
+func TestDrawEntropyGraphSingleBlock(t *testing.T) {
+	img := DrawEntropyGraph([]float64{8}, GraphOptions{Width: 10, Height: 10})
+	for x := 0; x < 10; x++ {
+		if img.RGBAAt(x, 0) != graphLine {
+			t.Errorf("Expected line at %v, got: %v", x, img.RGBAAt(x, 0))
+		}
+	}
+}
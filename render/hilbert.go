@@ -0,0 +1,223 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+)
+
+type HilbertMode string
+
+const (
+	// Colour each cell by the entropy of the bytes it covers.
+	HilbertModeEntropy HilbertMode = "entropy"
+	// Colour each cell by the mix of byte classes (null, control, printable, high and 0xff) it covers.
+	HilbertModeClass HilbertMode = "class"
+)
+
+// Fewest bytes a cell covers in entropy mode, fewer bytes can't show a meaningful entropy.
+const hilbertMinEntropyCellBytes = 32
+
+// Colours of each byte class, matching the scheme used by binvis.
+var (
+	classNull      = color.RGBA{0x00, 0x00, 0x00, 0xff}
+	classFF        = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	classPrintable = color.RGBA{0x37, 0x7e, 0xb8, 0xff}
+	classControl   = color.RGBA{0x4d, 0xaf, 0x4a, 0xff}
+	classHigh      = color.RGBA{0xe4, 0x1a, 0x1c, 0xff}
+)
+
+// Size and colouring of a rendered Hilbert curve map.
+type HilbertOptions struct {
+	// Width and height of the image in pixels, rounded down to a power of two.
+	Size int
+	Mode HilbertMode
+}
+
+// HilbertMap lays out a file along a Hilbert curve from bytes appended in order, so bytes close together in the file
+// stay close together in the image and 2D structure is visible.
+// Each cell covers an equal run of bytes and only the colour of each cell is kept, so memory is bounded by the image
+// size rather than the file size.
+type HilbertMap struct {
+	mode HilbertMode
+	// Number of cells along each side of the curve and pixels along each side of a cell.
+	side      int
+	cellScale int
+	// Bytes covered by each cell.
+	cellBytes uint64
+	// Colour of each completed cell in curve order.
+	cells []color.RGBA
+	// Counts of the bytes in the cell being filled.
+	counts [256]uint64
+	filled uint64
+}
+
+// Create a new HilbertMap for a file of the given length.
+// The curve is shrunk for small files so every cell covers enough bytes to be coloured.
+func NewHilbertMap(contentLength uint64, options HilbertOptions) (*HilbertMap, error) {
+	minCellBytes := uint64(1)
+	switch options.Mode {
+	case HilbertModeEntropy:
+		minCellBytes = hilbertMinEntropyCellBytes
+	case HilbertModeClass:
+	default:
+		return nil, fmt.Errorf("unknown hilbert mode %q", options.Mode)
+	}
+	if options.Size < 1 {
+		return nil, fmt.Errorf("hilbert map size must be positive, got %d", options.Size)
+	}
+	size := 1
+	for size*2 <= options.Size {
+		size *= 2
+	}
+	// Smallest curve that covers the file with cells of at least the minimum size.
+	side := 1
+	for side < size && uint64(side)*uint64(side)*minCellBytes < contentLength {
+		side *= 2
+	}
+	cellCount := uint64(side) * uint64(side)
+	cellBytes := max((contentLength+cellCount-1)/cellCount, minCellBytes)
+	return &HilbertMap{
+		mode:      options.Mode,
+		side:      side,
+		cellScale: size / side,
+		cellBytes: cellBytes,
+		cells:     make([]color.RGBA, 0, cellCount),
+	}, nil
+}
+
+// Append the next bytes of the file to the map, colouring each cell as it is filled.
+// Bytes that don't fit in the cells of the curve, only possible past the length the map was created with, are ignored.
+func (hm *HilbertMap) Append(buf []byte) {
+	for len(buf) > 0 && len(hm.cells) < cap(hm.cells) {
+		take := min(uint64(len(buf)), hm.cellBytes-hm.filled)
+		for _, b := range buf[:take] {
+			hm.counts[b]++
+		}
+		hm.filled += take
+		buf = buf[take:]
+		if hm.filled == hm.cellBytes {
+			hm.finishCell()
+		}
+	}
+}
+
+// Colour the cell being filled from its counts and start the next cell.
+func (hm *HilbertMap) finishCell() {
+	if hm.filled == 0 {
+		return
+	}
+	if hm.mode == HilbertModeEntropy {
+		hm.cells = append(hm.cells, entropyColour(hm.counts, hm.filled))
+	} else {
+		hm.cells = append(hm.cells, classColour(hm.counts, hm.filled))
+	}
+	hm.counts = [256]uint64{}
+	hm.filled = 0
+}
+
+// Number of bytes covered by each cell of the curve.
+func (hm *HilbertMap) CellBytes() uint64 {
+	return hm.cellBytes
+}
+
+// Draw the map, colouring a final partial cell. Cells past the end of the file are transparent.
+// Expected to be called once the whole file has been appended.
+func (hm *HilbertMap) Draw() *image.RGBA {
+	hm.finishCell()
+	imageSide := hm.side * hm.cellScale
+	img := image.NewRGBA(image.Rect(0, 0, imageSide, imageSide))
+	for d, colour := range hm.cells {
+		cellX, cellY := hilbertPoint(hm.side, d)
+		for y := 0; y < hm.cellScale; y++ {
+			for x := 0; x < hm.cellScale; x++ {
+				img.SetRGBA(cellX*hm.cellScale+x, cellY*hm.cellScale+y, colour)
+			}
+		}
+	}
+	return img
+}
+
+// Draw the map and encode it as a PNG.
+func (hm *HilbertMap) PNG() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	err := encoder.Encode(&buf, hm.Draw())
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Convert a distance along a Hilbert curve filling a side x side square (side a power of two) to its point.
+func hilbertPoint(side int, d int) (x int, y int) {
+	for s := 1; s < side; s *= 2 {
+		rx := 1 & (d / 2)
+		ry := 1 & (d ^ rx)
+		if ry == 0 {
+			if rx == 1 {
+				x, y = s-1-x, s-1-y
+			}
+			x, y = y, x
+		}
+		x += s * rx
+		y += s * ry
+		d /= 4
+	}
+	return x, y
+}
+
+// Colour for the entropy of the counted bytes, normalised against the most the number of bytes could reach.
+// Low entropy is black, mid entropy blue and high entropy pink, following binvis.
+func entropyColour(counts [256]uint64, length uint64) color.RGBA {
+	var ent float64
+	for _, count := range counts {
+		if count == 0 {
+			continue
+		}
+		px := float64(count) / float64(length)
+		ent -= px * math.Log2(px)
+	}
+	normalised := 0.0
+	if length > 1 {
+		normalised = ent / math.Log2(float64(min(length, 256)))
+	}
+	red := 0.0
+	if normalised > 0.5 {
+		red = math.Pow(max(4*(normalised-0.5)-4*(normalised-0.5)*(normalised-0.5), 0), 4)
+	}
+	return color.RGBA{byte(math.Round(255 * red)), 0, byte(math.Round(255 * normalised * normalised)), 0xff}
+}
+
+// Colour mixing the byte class colours in proportion to the counted bytes.
+func classColour(counts [256]uint64, length uint64) color.RGBA {
+	var r, g, b float64
+	for value, count := range counts {
+		if count == 0 {
+			continue
+		}
+		class := byteClass(byte(value))
+		weight := float64(count) / float64(length)
+		r += weight * float64(class.R)
+		g += weight * float64(class.G)
+		b += weight * float64(class.B)
+	}
+	return color.RGBA{byte(math.Round(r)), byte(math.Round(g)), byte(math.Round(b)), 0xff}
+}
+
+func byteClass(b byte) color.RGBA {
+	switch {
+	case b == 0x00:
+		return classNull
+	case b == 0xff:
+		return classFF
+	case b >= 0x20 && b < 0x7f:
+		return classPrintable
+	case b < 0x80:
+		return classControl
+	}
+	return classHigh
+}
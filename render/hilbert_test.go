@@ -0,0 +1,119 @@
+package render
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestHilbertPointAdjacent(t *testing.T) {
+	side := 16
+	seen := map[[2]int]bool{}
+	previousX, previousY := hilbertPoint(side, 0)
+	seen[[2]int{previousX, previousY}] = true
+	for d := 1; d < side*side; d++ {
+		x, y := hilbertPoint(side, d)
+		if abs(x-previousX)+abs(y-previousY) != 1 {
+			t.Fatalf("Point %v (%v, %v) is not adjacent to (%v, %v)", d, x, y, previousX, previousY)
+		}
+		if seen[[2]int{x, y}] {
+			t.Fatalf("Point %v (%v, %v) visited twice", d, x, y)
+		}
+		seen[[2]int{x, y}] = true
+		previousX, previousY = x, y
+	}
+}
+
+func TestHilbertMapClass(t *testing.T) {
+	hm, err := NewHilbertMap(4, HilbertOptions{Size: 3, Mode: HilbertModeClass})
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	hm.Append([]byte{0x00, 'A'})
+	hm.Append([]byte{0x01, 0x80})
+	img := hm.Draw()
+	if img.Bounds().Dx() != 2 || img.Bounds().Dy() != 2 {
+		t.Fatalf("Unexpected size, got: %v", img.Bounds())
+	}
+	expected := map[[2]int]color.RGBA{
+		{0, 0}: classNull,
+		{0, 1}: classPrintable,
+		{1, 1}: classControl,
+		{1, 0}: classHigh,
+	}
+	for point, colour := range expected {
+		if img.RGBAAt(point[0], point[1]) != colour {
+			t.Errorf("Expected %v at %v, got: %v", colour, point, img.RGBAAt(point[0], point[1]))
+		}
+	}
+}
+
+func TestHilbertMapEntropy(t *testing.T) {
+	hm, err := NewHilbertMap(64, HilbertOptions{Size: 8, Mode: HilbertModeEntropy})
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if hm.CellBytes() != 32 {
+		t.Errorf("Unexpected CellBytes, got: %v", hm.CellBytes())
+	}
+	buf := make([]byte, 64)
+	for i := 0; i < 32; i++ {
+		buf[i] = byte(i)
+	}
+	hm.Append(buf)
+	img := hm.Draw()
+	expected := map[[2]int]color.RGBA{
+		{0, 0}: {0xff, 0x00, 0xff, 0xff},
+		{3, 7}: {0x00, 0x00, 0x00, 0xff},
+		{4, 4}: {},
+	}
+	for point, colour := range expected {
+		if img.RGBAAt(point[0], point[1]) != colour {
+			t.Errorf("Expected %v at %v, got: %v", colour, point, img.RGBAAt(point[0], point[1]))
+		}
+	}
+}
+
+func TestHilbertMapPartialCell(t *testing.T) {
+	hm, err := NewHilbertMap(5, HilbertOptions{Size: 2, Mode: HilbertModeClass})
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	hm.Append([]byte{0x00, 0x00, 0xff, 0xff, 0xff})
+	img := hm.Draw()
+	// Two bytes per cell, the final cell only covers one byte.
+	expected := map[[2]int]color.RGBA{
+		{0, 0}: classNull,
+		{0, 1}: classFF,
+		{1, 1}: classFF,
+	}
+	for point, colour := range expected {
+		if img.RGBAAt(point[0], point[1]) != colour {
+			t.Errorf("Expected %v at %v, got: %v", colour, point, img.RGBAAt(point[0], point[1]))
+		}
+	}
+}
+
+func TestHilbertMapIgnoresExtraBytes(t *testing.T) {
+	hm, err := NewHilbertMap(4, HilbertOptions{Size: 2, Mode: HilbertModeClass})
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	hm.Append([]byte{0x00, 0x00, 0x00, 0x00, 0xff})
+	img := hm.Draw()
+	for _, point := range [][2]int{{0, 0}, {0, 1}, {1, 1}, {1, 0}} {
+		if img.RGBAAt(point[0], point[1]) != classNull {
+			t.Errorf("Expected null at %v, got: %v", point, img.RGBAAt(point[0], point[1]))
+		}
+	}
+}
+
+func TestNewHilbertMapInvalid(t *testing.T) {
+	_, err := NewHilbertMap(10, HilbertOptions{Size: 8, Mode: "unknown"})
+	if err == nil {
+		t.Errorf("Expected error for unknown mode")
+	}
+	_, err = NewHilbertMap(10, HilbertOptions{Size: 0, Mode: HilbertModeClass})
+	if err == nil {
+		t.Errorf("Expected error for zero size")
+	}
+}
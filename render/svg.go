@@ -0,0 +1,107 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+)
+
+// Space around the plot for the axis labels and region and section strips.
+const (
+	svgMarginLeft   = 40
+	svgMarginRight  = 10
+	svgMarginTop    = 10
+	svgStripHeight  = 10
+	svgStripGap     = 4
+	svgMarginBottom = svgStripGap + svgStripHeight + svgStripGap + svgStripHeight + 22
+)
+
+// Render the profile as an SVG line plot over the classification bands, with entropy and offset axis labels.
+// Regions are drawn as a strip under the plot coloured by band and sections as a labelled strip under that.
+func EntropySVG(profile Profile, options ChartOptions) []byte {
+	bands := options.Bands
+	if len(bands) == 0 {
+		bands = DefaultBands
+	}
+	width := float64(max(options.Width, svgMarginLeft+svgMarginRight+10))
+	height := float64(max(options.Height, svgMarginTop+svgMarginBottom+10))
+	plotWidth := width - svgMarginLeft - svgMarginRight
+	plotHeight := height - svgMarginTop - svgMarginBottom
+	axisSize := max(profile.Size, uint64(len(profile.Blocks))*profile.BlockSize, 1)
+	xOf := func(offset uint64) float64 {
+		return svgMarginLeft + float64(offset)/float64(axisSize)*plotWidth
+	}
+	yOf := func(value float64) float64 {
+		return svgMarginTop + (maxEntropy-min(max(value, 0), maxEntropy))/maxEntropy*plotHeight
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="sans-serif" font-size="10">`+"\n", width, height, width, height)
+	fmt.Fprintf(&buf, `<rect width="%.0f" height="%.0f" fill="#ffffff"/>`+"\n", width, height)
+	for _, band := range bands {
+		top, bottom := yOf(band.Max), yOf(band.Min)
+		fmt.Fprintf(&buf, `<rect x="%d" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s</title></rect>`+"\n",
+			svgMarginLeft, top, plotWidth, bottom-top, hexColour(band.Colour.R, band.Colour.G, band.Colour.B), escape(band.Label))
+	}
+	// Entropy axis with grid lines every bit.
+	for bit := 0; bit <= maxEntropy; bit++ {
+		y := yOf(float64(bit))
+		if bit > 0 && bit < maxEntropy {
+			fmt.Fprintf(&buf, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#b0b0b0" stroke-dasharray="2,2"/>`+"\n",
+				svgMarginLeft, y, svgMarginLeft+plotWidth, y)
+		}
+		fmt.Fprintf(&buf, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle">%d</text>`+"\n", svgMarginLeft-4, y, bit)
+	}
+	if len(profile.Blocks) > 0 {
+		buf.WriteString(`<polyline fill="none" stroke="#1f3a93" stroke-width="1.5" points="`)
+		for i, value := range profile.Blocks {
+			// Each block is plotted at its centre.
+			x := xOf(uint64(i)*profile.BlockSize + profile.BlockSize/2)
+			if i > 0 {
+				buf.WriteString(" ")
+			}
+			fmt.Fprintf(&buf, "%.1f,%.1f", x, yOf(value))
+		}
+		buf.WriteString(`"/>` + "\n")
+	}
+
+	regionTop := svgMarginTop + plotHeight + svgStripGap
+	for _, region := range profile.Regions {
+		fmt.Fprintf(&buf, `<rect x="%.1f" y="%.1f" width="%.1f" height="%d" fill="%s"><title>%s %s-%s</title></rect>`+"\n",
+			xOf(region.Offset), regionTop, xOf(region.Offset+region.Size)-xOf(region.Offset), svgStripHeight,
+			bandColour(bands, region.Label), escape(region.Label), formatOffset(region.Offset), formatOffset(region.Offset+region.Size))
+	}
+	sectionTop := regionTop + svgStripHeight + svgStripGap
+	for i, section := range profile.Sections {
+		x, sectionWidth := xOf(section.Offset), xOf(section.Offset+section.Size)-xOf(section.Offset)
+		fill := "#8da0cb"
+		if i%2 == 1 {
+			fill = "#a6b5d9"
+		}
+		fmt.Fprintf(&buf, `<rect x="%.1f" y="%.1f" width="%.1f" height="%d" fill="%s"><title>%s %s-%s</title></rect>`+"\n",
+			x, sectionTop, sectionWidth, svgStripHeight, fill, escape(section.Label), formatOffset(section.Offset), formatOffset(section.Offset+section.Size))
+		// Only label sections wide enough to hold the name.
+		if sectionWidth >= float64(6*len(section.Label)) {
+			fmt.Fprintf(&buf, `<text x="%.1f" y="%.1f" font-size="8" dominant-baseline="middle">%s</text>`+"\n",
+				x+2, sectionTop+svgStripHeight/2, escape(section.Label))
+		}
+	}
+
+	// Offset axis.
+	axisTop := sectionTop + svgStripHeight
+	fmt.Fprintf(&buf, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#000000"/>`+"\n", svgMarginLeft, axisTop, svgMarginLeft+plotWidth, axisTop)
+	for _, offset := range offsetTicks(axisSize, max(int(plotWidth/80), 2)) {
+		x := xOf(offset)
+		fmt.Fprintf(&buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#000000"/>`+"\n", x, axisTop, x, axisTop+4)
+		fmt.Fprintf(&buf, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`+"\n", x, axisTop+14, formatOffset(offset))
+	}
+	buf.WriteString("</svg>\n")
+	return buf.Bytes()
+}
+
+// Escape text placed in the SVG.
+func escape(value string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(value))
+	return buf.String()
+}
@@ -0,0 +1,186 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Eighths of a character cell, from empty to full.
+var barLevels = []rune{' ', '▁', '▂', '▃', '▄', '▅', '▆', '▇', '█'}
+
+// ANSI colours for the default band labels.
+var ansiBandColours = map[string]string{
+	"padding":    "\x1b[90m",
+	"text":       "\x1b[34m",
+	"code":       "\x1b[32m",
+	"compressed": "\x1b[33m",
+	"encrypted":  "\x1b[31m",
+}
+
+const ansiReset = "\x1b[0m"
+
+// Size and colouring of a terminal graph.
+type TerminalOptions struct {
+	// Number of columns the blocks are resampled to.
+	Width int
+	// Number of rows of the bar graph, a single row is a sparkline.
+	Height int
+	// Colour each column by the band of its entropy with ANSI escapes.
+	Colour bool
+	// Entropy ranges used to classify columns, DefaultBands if empty.
+	Bands []Band
+}
+
+// Render the profile as a bar graph of block characters for a terminal or log.
+// Graphs taller than one row have an entropy axis, and under the bars the regions and sections are labelled
+// along with markers for hex offsets.
+func TerminalGraph(profile Profile, options TerminalOptions) string {
+	bands := options.Bands
+	if len(bands) == 0 {
+		bands = DefaultBands
+	}
+	width, height := max(options.Width, 1), max(options.Height, 1)
+	axisSize := max(profile.Size, uint64(len(profile.Blocks))*profile.BlockSize, 1)
+	columns := resample(profile, width, axisSize)
+	gutter := ""
+	if height > 1 {
+		gutter = "  │"
+	}
+
+	var out strings.Builder
+	for row := height - 1; row >= 0; row-- {
+		if height > 1 {
+			switch row {
+			case height - 1:
+				gutter = "8 ┤"
+			case 0:
+				gutter = "0 ┤"
+			default:
+				gutter = "  │"
+			}
+		}
+		out.WriteString(gutter)
+		current := ""
+		for _, value := range columns {
+			cell := ' '
+			if value >= 0 {
+				// Eighths of the whole graph filled by the value, at least one eighth so zero entropy shows.
+				filled := max(int(value/maxEntropy*float64(height*8)+0.5), 1)
+				cell = barLevels[min(max(filled-row*8, 0), 8)]
+			}
+			if options.Colour {
+				colour := ""
+				if value >= 0 {
+					colour = ansiBandColours[Classify(value, bands)]
+				}
+				if colour != current {
+					if current != "" {
+						out.WriteString(ansiReset)
+					}
+					out.WriteString(colour)
+					current = colour
+				}
+			}
+			out.WriteRune(cell)
+		}
+		if current != "" {
+			out.WriteString(ansiReset)
+		}
+		out.WriteString("\n")
+	}
+	indent := strings.Repeat(" ", utf8.RuneCountInString(gutter))
+	columnOf := func(offset uint64) int {
+		return min(int(offset*uint64(width)/axisSize), width-1)
+	}
+	if len(profile.Regions) > 0 {
+		out.WriteString(indent + labelSpans(profile.Regions, width, columnOf) + "\n")
+	}
+	if len(profile.Sections) > 0 {
+		out.WriteString(indent + labelSpans(profile.Sections, width, columnOf) + "\n")
+	}
+	out.WriteString(indent + offsetAxis(axisSize, width, columnOf))
+	return out.String()
+}
+
+// Average entropy of the blocks centred in each column. Columns narrower than a block take the block under their
+// centre, and columns past the last block are -1.
+func resample(profile Profile, width int, axisSize uint64) []float64 {
+	sums := make([]float64, width)
+	counts := make([]int, width)
+	for i, value := range profile.Blocks {
+		centre := uint64(i)*profile.BlockSize + profile.BlockSize/2
+		column := min(int(centre*uint64(width)/axisSize), width-1)
+		sums[column] += value
+		counts[column] += 1
+	}
+	columns := make([]float64, width)
+	for i := range columns {
+		columns[i] = -1
+		if counts[i] > 0 {
+			columns[i] = sums[i] / float64(counts[i])
+			continue
+		}
+		if profile.BlockSize == 0 {
+			continue
+		}
+		centre := (2*uint64(i) + 1) * axisSize / uint64(2*width)
+		if block := centre / profile.BlockSize; block < uint64(len(profile.Blocks)) {
+			columns[i] = profile.Blocks[block]
+		}
+	}
+	return columns
+}
+
+// Label with each rune that isn't printable replaced by '?'. Section names come from the binary, so could otherwise
+// write control sequences to the terminal.
+func printableLabel(label string) string {
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsPrint(r) {
+			return '?'
+		}
+		return r
+	}, label)
+}
+
+// A line with a '|' at the start of each span followed by as much of its label as fits.
+func labelSpans(spans []Region, width int, columnOf func(uint64) int) string {
+	line := []rune(strings.Repeat(" ", width))
+	for i, span := range spans {
+		start := columnOf(span.Offset)
+		end := width
+		if i+1 < len(spans) {
+			end = max(columnOf(spans[i+1].Offset), start+1)
+		}
+		line[start] = '|'
+		label := []rune(printableLabel(span.Label))
+		for j := 0; j < len(label) && start+1+j < min(end, width); j++ {
+			line[start+1+j] = label[j]
+		}
+	}
+	return strings.TrimRight(string(line), " ")
+}
+
+// A line of hex offsets, each starting at its column, skipping offsets that would overlap the previous label.
+func offsetAxis(axisSize uint64, width int, columnOf func(uint64) int) string {
+	line := []rune(strings.Repeat(" ", width+10))
+	next := 0
+	for _, offset := range offsetTicks(axisSize, max(width/12, 2)) {
+		column := columnOf(offset)
+		label := []rune(fmt.Sprintf("^%s", formatOffset(offset)))
+		if column < next || column+len(label) > len(line) {
+			continue
+		}
+		copy(line[column:], label)
+		next = column + len(label) + 1
+	}
+	return strings.TrimRight(string(line), " ")
+}
+
+// Render the blocks as a single line of block characters without colour, for logs.
+func Sparkline(profile Profile, width int) string {
+	graph := TerminalGraph(Profile{Blocks: profile.Blocks, BlockSize: profile.BlockSize, Size: profile.Size}, TerminalOptions{Width: width, Height: 1})
+	line, _, _ := strings.Cut(graph, "\n")
+	return line
+}
@@ -0,0 +1,57 @@
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSparkline(t *testing.T) {
+	sparkline := Sparkline(testProfile, 12)
+	if sparkline != "▁▁▁▁▅▅▆▆████" {
+		t.Errorf("Unexpected sparkline, got: %q", sparkline)
+	}
+	// Columns past the last block are left blank.
+	sparkline = Sparkline(Profile{Blocks: []float64{8}, BlockSize: 256, Size: 512}, 4)
+	if sparkline != "██  " {
+		t.Errorf("Unexpected sparkline, got: %q", sparkline)
+	}
+}
+
+func TestTerminalGraph(t *testing.T) {
+	profile := testProfile
+	profile.Regions = ClassifyRegions(profile.Blocks, profile.BlockSize, nil)
+	graph := TerminalGraph(profile, TerminalOptions{Width: 24, Height: 2})
+	expected := strings.Join([]string{
+		"8 ┤        ▂▂▂▂▃▃▃████████ ",
+		"0 ┤▁▁▁▁▁▁▁▁███████████████ ",
+		"   |paddin|code   |encrypte",
+		"   |.text         |<data>",
+		"   ^0x0           ^0x400",
+	}, "\n")
+	if graph != expected {
+		t.Errorf("Unexpected graph, got:\n%v", graph)
+	}
+}
+
+func TestTerminalGraphColour(t *testing.T) {
+	graph := TerminalGraph(testProfile, TerminalOptions{Width: 12, Height: 1, Colour: true})
+	line, _, _ := strings.Cut(graph, "\n")
+	expected := "\x1b[90m▁▁▁▁\x1b[0m\x1b[32m▅▅▆▆\x1b[0m\x1b[31m████\x1b[0m"
+	if line != expected {
+		t.Errorf("Unexpected coloured sparkline, got: %q", line)
+	}
+}
+
+func TestTerminalGraphControlLabel(t *testing.T) {
+	profile := testProfile
+	profile.Sections = []Region{{Offset: 0, Size: 2048, Label: "\x1b[2J\x07.te\x00xt"}}
+	graph := TerminalGraph(profile, TerminalOptions{Width: 24, Height: 1})
+	lines := strings.Split(graph, "\n")
+	// Control characters from the binary are replaced rather than written to the terminal.
+	if expected := "|?[2J?.te?xt"; lines[1] != expected {
+		t.Errorf("Unexpected labels, got: %q", lines[1])
+	}
+	if strings.ContainsAny(graph, "\x1b\x07\x00") {
+		t.Errorf("Expected no control characters, got: %q", graph)
+	}
+}
@@ -0,0 +1,106 @@
+package render
+
+import "encoding/json"
+
+const vegaLiteSchema = "https://vega.github.io/schema/vega-lite/v5.json"
+
+// Build a Vega-Lite spec of the profile, the data is embedded so the spec can be dropped straight into a report.
+// The profile is plotted over the classification bands, with the regions and sections (when present) as strips
+// under it sharing the offset axis, which is labelled in hex.
+func EntropyVegaLite(profile Profile, options ChartOptions) ([]byte, error) {
+	bands := options.Bands
+	if len(bands) == 0 {
+		bands = DefaultBands
+	}
+	width := max(options.Width, 10)
+	height := max(options.Height, 10)
+	axisSize := max(profile.Size, uint64(len(profile.Blocks))*profile.BlockSize, 1)
+	offsetScale := map[string]any{"domain": []uint64{0, axisSize}}
+
+	bandValues := []map[string]any{}
+	labels := []string{}
+	colours := []string{}
+	for _, band := range bands {
+		bandValues = append(bandValues, map[string]any{"label": band.Label, "min": band.Min, "max": band.Max})
+		labels = append(labels, band.Label)
+		colours = append(colours, hexColour(band.Colour.R, band.Colour.G, band.Colour.B))
+	}
+	blockValues := []map[string]any{}
+	for i, value := range profile.Blocks {
+		blockValues = append(blockValues, map[string]any{"offset": uint64(i) * profile.BlockSize, "entropy": value})
+	}
+	colour := map[string]any{
+		"field": "label",
+		"type":  "nominal",
+		"title": "Class",
+		"scale": map[string]any{"domain": labels, "range": colours},
+	}
+	charts := []any{
+		map[string]any{
+			"width":  width,
+			"height": height,
+			"layer": []any{
+				map[string]any{
+					"data": map[string]any{"values": bandValues},
+					"mark": "rect",
+					"encoding": map[string]any{
+						"y":     map[string]any{"field": "min", "type": "quantitative", "scale": map[string]any{"domain": []float64{0, maxEntropy}}, "title": "Entropy"},
+						"y2":    map[string]any{"field": "max"},
+						"color": colour,
+					},
+				},
+				map[string]any{
+					"data": map[string]any{"values": blockValues},
+					"mark": map[string]any{"type": "line", "color": "#1f3a93", "interpolate": "step-after"},
+					"encoding": map[string]any{
+						"x": map[string]any{"field": "offset", "type": "quantitative", "scale": offsetScale, "axis": map[string]any{"format": "#x"}, "title": "Offset"},
+						"y": map[string]any{"field": "entropy", "type": "quantitative"},
+						"tooltip": []any{
+							map[string]any{"field": "offset", "type": "quantitative", "format": "#x"},
+							map[string]any{"field": "entropy", "type": "quantitative", "format": ".3f"},
+						},
+					},
+				},
+			},
+		},
+	}
+	if len(profile.Regions) > 0 {
+		charts = append(charts, regionStrip(profile.Regions, width, offsetScale, map[string]any{
+			"field": "label", "type": "nominal", "scale": colour["scale"], "legend": nil,
+		}))
+	}
+	if len(profile.Sections) > 0 {
+		charts = append(charts, regionStrip(profile.Sections, width, offsetScale, map[string]any{"value": "#8da0cb"}))
+	}
+	spec := map[string]any{
+		"$schema":     vegaLiteSchema,
+		"description": "Entropy profile",
+		"vconcat":     charts,
+		"resolve":     map[string]any{"scale": map[string]any{"x": "shared"}},
+	}
+	return json.Marshal(spec)
+}
+
+// A thin strip of labelled ranges sharing the offset axis of the profile.
+func regionStrip(regions []Region, width int, offsetScale map[string]any, colour map[string]any) map[string]any {
+	values := []map[string]any{}
+	for _, region := range regions {
+		values = append(values, map[string]any{"label": region.Label, "offset": region.Offset, "end": region.Offset + region.Size})
+	}
+	return map[string]any{
+		"width":  width,
+		"height": 12,
+		"data":   map[string]any{"values": values},
+		"mark":   map[string]any{"type": "rect", "stroke": "#ffffff", "strokeWidth": 0.5},
+		"encoding": map[string]any{
+			"x":     map[string]any{"field": "offset", "type": "quantitative", "scale": offsetScale, "axis": nil},
+			"x2":    map[string]any{"field": "end"},
+			"color": colour,
+			"tooltip": []any{
+				map[string]any{"field": "label", "type": "nominal"},
+				map[string]any{"field": "offset", "type": "quantitative", "format": "#x"},
+				map[string]any{"field": "end", "type": "quantitative", "format": "#x"},
+			},
+		},
+	}
+}
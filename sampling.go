@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	"github.com/AustralianCyberSecurityCentre/azul-bedrock/v10/gosrc/plugin"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/entropy"
+)
+
+// Confidence level of the interval of the sampled overall entropy.
+const samplingConfidence = 0.95
+
+// Whether a binary of the given size is sampled rather than read in full.
+func (s *EntropySettings) sampling(size uint64) bool {
+	sampled := uint64(s.SamplingWindows) * uint64(s.SamplingWindowSize)
+	return s.SamplingThreshold > 0 && size > uint64(s.SamplingThreshold) && sampled < size
+}
+
+// Estimate the entropy of a binary from windows fetched from across it, rather than reading every byte.
+// Only the overall entropy, the histogram of the sampled bytes, the entropy of each window, the sections and the
+// ranges are reported, the other analyses need the whole binary. When the time budget runs out the estimate is of the
+// windows fetched so far, marked as truncated.
+func analyseSampled(ctx context.Context, config *EntropySettings, size uint64, source ContentSource, interest []byteRange) (*analysisResult, *plugin.PluginError) {
+	windowSize := uint64(config.SamplingWindowSize)
+	// Seeded from the size so sampling the same binary gives the same results.
+	rng := rand.New(rand.NewSource(int64(size)))
+	offsets := entropy.EvenWindows(size, windowSize, config.SamplingWindows)
+	if config.SamplingMode == "random" {
+		offsets = entropy.RandomWindows(size, windowSize, config.SamplingWindows, rng)
+	}
+
+	contentReader := newContentReader(source, size)
+	head, _, pluginErr := source.GetContentChunk(0, min(uint64(contentHeadSize), size)-1)
+	if pluginErr != nil {
+		return nil, pluginErr
+	}
+	contentReader.setHead(head)
+
+	windows := make([][256]int, 0, len(offsets))
+	var counts [256]int
+	sampling := &EventInfoSampling{
+		Mode:       config.SamplingMode,
+		WindowSize: windowSize,
+		Confidence: samplingConfidence,
+		Blocks:     []EventInfoSampledBlock{},
+	}
+	budget, cancel := config.budgetContext(ctx)
+	defer cancel()
+	truncated := false
+	for _, offset := range offsets {
+		if err := ctx.Err(); err != nil {
+			return nil, cancelledError(err)
+		}
+		if budget.Err() != nil {
+			truncated = true
+			break
+		}
+		// Chunk ends are inclusive.
+		window, _, pluginErr := source.GetContentChunk(offset, offset+windowSize-1)
+		if pluginErr != nil {
+			return nil, pluginErr
+		}
+		var windowCounts [256]int
+		for _, b := range window {
+			windowCounts[b]++
+			counts[b]++
+		}
+		windows = append(windows, windowCounts)
+		sampling.SampledBytes += uint64(len(window))
+		sampling.Blocks = append(sampling.Blocks, EventInfoSampledBlock{Offset: offset, Entropy: entropy.CountsValue(windowCounts)})
+	}
+	// Fewer windows than planned are fetched when the time budget runs out.
+	sampling.Windows = len(windows)
+	estimate := entropy.EstimateEntropy(windows, samplingConfidence, rng)
+	sampling.OverallLow, sampling.OverallHigh = estimate.Low, estimate.High
+
+	result := &analysisResult{Size: size, disabledFeatures: config.disabledFeatures()}
+	result.Info = EventInfoEntropy{
+		Overall:  estimate.Value,
+		Blocks:   []float64{},
+		Sampling: sampling,
+	}
+	entropyInfo := &result.Info
+	result.addFeature("entropy", estimate.Value, nil)
+	result.addFeature("entropy_sampled", fmt.Sprintf("%d windows of %d bytes", sampling.Windows, windowSize), nil)
+	if truncated {
+		result.truncate(config, sampling.SampledBytes)
+	}
+	if config.HistogramEnabled {
+		entropyInfo.Histogram = histogramInfo(counts, config.HistogramTopBytes)
+	}
+	// As when reading in full, the sections and ranges aren't analysed once the time budget has run out.
+	if config.SectionsEnabled && !truncated {
+		err := sectionsInfo(entropyInfo, contentReader)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !truncated {
+		_, pluginErr = addRanges(ctx, result, config, contentReader, size, interest)
+		if pluginErr != nil {
+			return nil, pluginErr
+		}
+	}
+	result.FileType = detectFileType(entropyInfo.Format, contentReader.head)
+	result.ChiSquare = entropy.ChiSquare(counts)
+	return result, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestSampledAnalysis(t *testing.T) {
+	content := make([]byte, 1024*1024)
+	rand.New(rand.NewSource(1)).Read(content[len(content)/2:])
+	settings := NewDefaultEntropySettings()
+	settings.SamplingThreshold = 512 * 1024
+	settings.SamplingWindows = 64
+	settings.SamplingWindowSize = 1024
+	settings.HistogramEnabled = true
+	settings.HeadSize = 4 * 1024
+	settings.TailSize = 4 * 1024
+	for _, mode := range []string{"even", "random"} {
+		settings.SamplingMode = mode
+		source := newSlowSource(content, 0)
+		result, pluginErr := analyse(context.Background(), settings, uint64(len(content)), source, nil)
+		if pluginErr != nil {
+			t.Fatalf("error %v", pluginErr)
+		}
+		sampling := result.Info.Sampling
+		if sampling == nil || sampling.Mode != mode || sampling.Windows != 64 || sampling.SampledBytes != 64*1024 || len(sampling.Blocks) != 64 {
+			t.Fatalf("%v - Expected the binary to be sampled, got: %+v", mode, sampling)
+		}
+		// Half null bytes and half random bytes.
+		if sampling.OverallLow > 5 || sampling.OverallHigh < 5 || sampling.Blocks[0].Entropy != 0 || sampling.Blocks[63].Entropy < 7.7 {
+			t.Errorf("%v - Unexpected estimate, got: %v %+v", mode, result.Info.Overall, sampling)
+		}
+		if len(result.Info.Blocks) != 0 || result.Info.Histogram == nil || result.Info.Histogram.ZeroRatio < 0.5 {
+			t.Errorf("%v - Unexpected info, got: %+v", mode, result.Info)
+		}
+		names := []string{}
+		for _, feature := range result.Features {
+			names = append(names, feature.Name)
+		}
+		if len(names) != 4 || names[1] != "entropy_sampled" {
+			t.Errorf("%v - Unexpected features, got: %v", mode, names)
+		}
+		// The head and tail are read in full.
+		ranges := result.Info.Ranges
+		if len(ranges) != 2 || ranges[0].Entropy != 0 || ranges[1].Entropy < 7.9 {
+			t.Errorf("%v - Unexpected ranges, got: %+v", mode, ranges)
+		}
+		// Sampling the same binary again gives the same results.
+		again, _ := analyse(context.Background(), settings, uint64(len(content)), newSlowSource(content, 0), nil)
+		if again.Info.Overall != result.Info.Overall || again.Info.Sampling.OverallLow != sampling.OverallLow {
+			t.Errorf("%v - Expected sampling to be repeatable", mode)
+		}
+	}
+
+	// Binaries below the threshold, or smaller than the windows, are read in full.
+	for _, size := range []int{512 * 1024, 600 * 1024} {
+		if size > 512*1024 {
+			settings.SamplingWindows = 1000
+		}
+		result, pluginErr := analyse(context.Background(), settings, uint64(size), &readerSource{reader: bytes.NewReader(content[:size]), size: uint64(size)}, nil)
+		if pluginErr != nil || result.Info.Sampling != nil || len(result.Info.Blocks) == 0 {
+			t.Errorf("Expected %v bytes to be read in full, got: %v", size, pluginErr)
+		}
+	}
+}
+
+func TestSampledTimeBudget(t *testing.T) {
+	content := make([]byte, 1024*1024)
+	settings := NewDefaultEntropySettings()
+	settings.SamplingThreshold = 512 * 1024
+	settings.SamplingWindows = 64
+	settings.SamplingWindowSize = 1024
+	settings.HeadSize = 4 * 1024
+	settings.TimeBudget = 50 * time.Millisecond
+	// Windows take 20ms each, so the budget runs out after a few windows.
+	result, pluginErr := analyse(context.Background(), settings, uint64(len(content)), newSlowSource(content, 20*time.Millisecond), nil)
+	if pluginErr != nil {
+		t.Fatalf("error %v", pluginErr)
+	}
+	sampling, truncated := result.Info.Sampling, result.Info.Truncated
+	if truncated == nil || sampling.Windows == 0 || sampling.Windows >= 64 || truncated.AnalysedBytes != sampling.SampledBytes || len(sampling.Blocks) != sampling.Windows {
+		t.Fatalf("Expected the estimate to be of the windows fetched, got: %+v %+v", truncated, sampling)
+	}
+	if len(result.Info.Ranges) != 0 {
+		t.Errorf("Expected the ranges not to be analysed, got: %+v", result.Info.Ranges)
+	}
+	found := false
+	for _, feature := range result.Features {
+		found = found || (feature.Name == "entropy_truncated" && feature.Value == truncated.AnalysedBytes)
+	}
+	if !found {
+		t.Errorf("Expected the truncation to be a feature, got: %+v", result.Features)
+	}
+}
@@ -0,0 +1,258 @@
+/*
+Extract printable strings from a binary and report those with high entropy as possible secrets.
+Both ASCII and UTF-16LE strings are extracted, the entropy of each string is normalised against the
+alphabet it is drawn from (hex, base32, base64 or printable) so keys and tokens of different encodings rank equally.
+A string can't have more distinct characters than its length, so short random strings fall short of the maximum.
+*/
+package secrets
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/entropy"
+)
+
+type Charset string
+
+const (
+	CharsetHex       Charset = "hex"
+	CharsetBase32    Charset = "base32"
+	CharsetBase64    Charset = "base64"
+	CharsetPrintable Charset = "printable"
+)
+
+type Encoding string
+
+const (
+	EncodingAscii   Encoding = "ascii"
+	EncodingUtf16le Encoding = "utf16le"
+)
+
+// Size of the alphabet for each charset, used to normalise entropy.
+var charsetAlphabetSize = map[Charset]int{
+	CharsetHex:       16,
+	CharsetBase32:    32,
+	CharsetBase64:    64,
+	CharsetPrintable: 95,
+}
+
+// A string that has been identified as a possible secret.
+type Candidate struct {
+	// Offset of the first byte of the string in the file.
+	Offset uint64
+	// Number of bytes the string occupies in the file (twice the length for UTF-16LE).
+	Size     uint64
+	Value    string
+	Encoding Encoding
+	Charset  Charset
+	// Shannon's entropy of the characters in the string (bits per character).
+	Entropy float64
+	// Entropy relative to the maximum possible for the strings charset (0 to 1).
+	NormalisedEntropy float64
+}
+
+// Thresholds controlling which strings are reported.
+type Options struct {
+	// Minimum number of characters a string must have to be considered.
+	MinLength int
+	// Maximum number of characters kept for a string, longer strings are truncated.
+	MaxLength int
+	// Minimum normalised entropy (0 to 1) for a string to be reported.
+	MinEntropy float64
+	// Maximum number of candidates kept, the highest entropy candidates are kept.
+	MaxCandidates int
+}
+
+// A run of printable characters currently being extracted.
+type run struct {
+	start  uint64
+	length int
+	value  []byte
+}
+
+// Scanner extracts strings from bytes appended in order, keeping the top candidates seen so far.
+type Scanner struct {
+	options Options
+	offset  uint64
+	// Last byte seen, needed to pair UTF-16LE characters split across appends.
+	previous    byte
+	hasPrevious bool
+	ascii       run
+	// UTF-16LE runs for strings starting on even and odd offsets.
+	wide       [2]run
+	candidates candidateHeap
+}
+
+// Create a new Scanner that reports strings matching the provided options.
+func NewScanner(options Options) *Scanner {
+	return &Scanner{options: options}
+}
+
+// Append the next bytes of the file to the scanner, extracting any strings completed by the bytes.
+func (s *Scanner) Append(buf []byte) {
+	for _, b := range buf {
+		if isPrintable(b) {
+			s.ascii.add(s.offset, b, s.options.MaxLength)
+		} else {
+			s.flush(&s.ascii, EncodingAscii, 1)
+		}
+
+		// A UTF-16LE character is a printable byte followed by a null.
+		if s.hasPrevious {
+			wide := &s.wide[(s.offset-1)%2]
+			if isPrintable(s.previous) && b == 0 {
+				wide.add(s.offset-1, s.previous, s.options.MaxLength)
+			} else {
+				s.flush(wide, EncodingUtf16le, 2)
+			}
+		}
+		s.previous = b
+		s.hasPrevious = true
+		s.offset += 1
+	}
+}
+
+// Return the highest entropy candidates found, sorted from highest to lowest normalised entropy.
+// Expected to be called once the whole file has been appended.
+func (s *Scanner) Candidates() []Candidate {
+	s.flush(&s.ascii, EncodingAscii, 1)
+	s.flush(&s.wide[0], EncodingUtf16le, 2)
+	s.flush(&s.wide[1], EncodingUtf16le, 2)
+
+	result := make([]Candidate, len(s.candidates))
+	copy(result, s.candidates)
+	sort.SliceStable(result, func(i, j int) bool {
+		return ranksBelow(result[j], result[i])
+	})
+	return result
+}
+
+// Add a character to the run, only the first maxLength characters are kept.
+func (r *run) add(offset uint64, b byte, maxLength int) {
+	if r.length == 0 {
+		r.start = offset
+	}
+	r.length += 1
+	if maxLength <= 0 || len(r.value) < maxLength {
+		r.value = append(r.value, b)
+	}
+}
+
+// End the current run, keeping it as a candidate if it passes the thresholds.
+func (s *Scanner) flush(r *run, encoding Encoding, charWidth int) {
+	defer func() {
+		r.length = 0
+		r.value = r.value[:0]
+	}()
+	if r.length < s.options.MinLength || r.length == 0 {
+		return
+	}
+	candidate := Evaluate(r.value)
+	if candidate.NormalisedEntropy < s.options.MinEntropy {
+		return
+	}
+	candidate.Offset = r.start
+	candidate.Size = uint64(r.length * charWidth)
+	candidate.Encoding = encoding
+	s.keep(candidate)
+}
+
+// Keep the candidate if there is space for it or it beats the lowest ranked candidate.
+func (s *Scanner) keep(candidate Candidate) {
+	if s.options.MaxCandidates <= 0 {
+		return
+	}
+	if len(s.candidates) < s.options.MaxCandidates {
+		heap.Push(&s.candidates, candidate)
+		return
+	}
+	if ranksBelow(s.candidates[0], candidate) {
+		s.candidates[0] = candidate
+		heap.Fix(&s.candidates, 0)
+	}
+}
+
+// Classify the charset of a string and calculate its raw and normalised entropy.
+func Evaluate(value []byte) Candidate {
+	charset := Classify(value)
+	var counts [256]int
+	for _, b := range value {
+		counts[b]++
+	}
+	ent := entropy.CountsValue(counts)
+	// Normalised against the full alphabet rather than the length of the string, as almost any short string with
+	// varied characters, such as a sentence or an identifier, is close to the entropy its length allows.
+	normalised := ent / math.Log2(float64(charsetAlphabetSize[charset]))
+	return Candidate{
+		Value:             string(value),
+		Charset:           charset,
+		Entropy:           ent,
+		NormalisedEntropy: normalised,
+	}
+}
+
+// Find the smallest charset that contains every character of the string.
+func Classify(value []byte) Charset {
+	hex, base32, base64 := true, true, true
+	for _, b := range value {
+		isDigit := b >= '0' && b <= '9'
+		isUpper := b >= 'A' && b <= 'Z'
+		isLower := b >= 'a' && b <= 'z'
+		isPad := b == '='
+		if !(isDigit || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')) {
+			hex = false
+		}
+		if !(isUpper || (b >= '2' && b <= '7') || isPad) {
+			base32 = false
+		}
+		if !(isDigit || isUpper || isLower || isPad || b == '+' || b == '/' || b == '-' || b == '_') {
+			base64 = false
+		}
+	}
+	switch {
+	case hex:
+		return CharsetHex
+	case base32:
+		return CharsetBase32
+	case base64:
+		return CharsetBase64
+	}
+	return CharsetPrintable
+}
+
+// Printable ASCII characters, excluding control characters other than tab.
+func isPrintable(b byte) bool {
+	return (b >= 0x20 && b < 0x7f) || b == '\t'
+}
+
+// True if candidate a ranks below candidate b.
+func ranksBelow(a, b Candidate) bool {
+	if a.NormalisedEntropy != b.NormalisedEntropy {
+		return a.NormalisedEntropy < b.NormalisedEntropy
+	}
+	if len(a.Value) != len(b.Value) {
+		return len(a.Value) < len(b.Value)
+	}
+	return a.Offset > b.Offset
+}
+
+// Min-heap of candidates so the lowest ranked candidate can be replaced cheaply.
+type candidateHeap []Candidate
+
+func (h candidateHeap) Len() int           { return len(h) }
+func (h candidateHeap) Less(i, j int) bool { return ranksBelow(h[i], h[j]) }
+func (h candidateHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *candidateHeap) Push(x any) {
+	*h = append(*h, x.(Candidate))
+}
+
+func (h *candidateHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
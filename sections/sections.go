@@ -0,0 +1,130 @@
+/*
+Read the section table of executable formats (PE, ELF and Mach-O) so entropy can be related to the structure of a file.
+Only the headers are read, through an io.ReaderAt, so the whole file doesn't have to be held in memory.
+*/
+package sections
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+type Format string
+
+const (
+	FormatPE    Format = "pe"
+	FormatELF   Format = "elf"
+	FormatMachO Format = "macho"
+)
+
+// A section of an executable with content in the file.
+type Section struct {
+	Name string
+	// Offset of the section in the file.
+	Offset uint64
+	// Number of bytes the section occupies in the file.
+	Size uint64
+}
+
+// Detect the format of the file from its magic bytes and read its sections, sorted by offset.
+// Files of unknown formats have no sections and no error. Sections without content in the file (e.g. .bss) are skipped.
+func Parse(r io.ReaderAt) (Format, []Section, error) {
+	magic := make([]byte, 4)
+	n, err := r.ReadAt(magic, 0)
+	if n < len(magic) {
+		if err == io.EOF {
+			err = nil
+		}
+		return "", nil, err
+	}
+	var format Format
+	var result []Section
+	switch {
+	case bytes.HasPrefix(magic, []byte("MZ")):
+		format = FormatPE
+		result, err = parsePE(r)
+	case bytes.Equal(magic, []byte(elf.ELFMAG)):
+		format = FormatELF
+		result, err = parseELF(r)
+	case isMachO(magic):
+		format = FormatMachO
+		result, err = parseMachO(r)
+	default:
+		return "", nil, nil
+	}
+	if err != nil {
+		return format, nil, err
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Offset < result[j].Offset
+	})
+	return format, result, nil
+}
+
+func parsePE(r io.ReaderAt) ([]Section, error) {
+	file, err := pe.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	result := []Section{}
+	for _, section := range file.Sections {
+		if section.Offset == 0 || section.Size == 0 {
+			continue
+		}
+		result = append(result, Section{Name: section.Name, Offset: uint64(section.Offset), Size: uint64(section.Size)})
+	}
+	return result, nil
+}
+
+func parseELF(r io.ReaderAt) ([]Section, error) {
+	file, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	result := []Section{}
+	for _, section := range file.Sections {
+		if section.Type == elf.SHT_NULL || section.Type == elf.SHT_NOBITS || section.FileSize == 0 {
+			continue
+		}
+		result = append(result, Section{Name: section.Name, Offset: section.Offset, Size: section.FileSize})
+	}
+	return result, nil
+}
+
+func parseMachO(r io.ReaderAt) ([]Section, error) {
+	file, err := macho.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	result := []Section{}
+	for _, section := range file.Sections {
+		// Zero filled sections have no content in the file.
+		if section.Offset == 0 || section.Size == 0 {
+			continue
+		}
+		result = append(result, Section{
+			Name:   section.Seg + "," + section.Name,
+			Offset: uint64(section.Offset),
+			Size:   section.Size,
+		})
+	}
+	return result, nil
+}
+
+// Single architecture Mach-O magic in either byte order.
+func isMachO(magic []byte) bool {
+	switch binary.LittleEndian.Uint32(magic) {
+	case macho.Magic32, macho.Magic64:
+		return true
+	}
+	switch binary.BigEndian.Uint32(magic) {
+	case macho.Magic32, macho.Magic64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package sections
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseExecutable(t *testing.T) {
+	// The test binary is an executable in the native format of the platform.
+	path, err := os.Executable()
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	defer file.Close()
+	format, result, err := Parse(file)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if format == "" {
+		t.Fatalf("Expected a known format")
+	}
+	foundText := false
+	for i, section := range result {
+		if i > 0 && section.Offset < result[i-1].Offset {
+			t.Errorf("Sections not sorted by offset, got: %v", result)
+		}
+		if section.Size == 0 {
+			t.Errorf("Unexpected empty section %v", section)
+		}
+		foundText = foundText || strings.Contains(section.Name, "text")
+	}
+	if !foundText {
+		t.Errorf("Expected a text section, got: %v", result)
+	}
+}
+
+func TestParseUnknown(t *testing.T) {
+	for _, input := range [][]byte{{}, []byte("ab"), []byte("not an executable")} {
+		format, result, err := Parse(bytes.NewReader(input))
+		if format != "" || result != nil || err != nil {
+			t.Errorf("Expected no sections for %q, got: %v %v %v", input, format, result, err)
+		}
+	}
+}
+
+func TestParseTruncated(t *testing.T) {
+	format, _, err := Parse(bytes.NewReader([]byte("\x7fELF\x02\x01\x01")))
+	if format != FormatELF || err == nil {
+		t.Errorf("Expected an error for a truncated ELF, got: %v %v", format, err)
+	}
+}
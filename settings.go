@@ -0,0 +1,373 @@
+/*
+Settings specific to the entropy plugin, these can be overridden with environment variables in the same way as the
+standard plugin settings (e.g. PLUGIN_STRINGS_MIN_LENGTH=24).
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AustralianCyberSecurityCentre/azul-bedrock/v10/gosrc/settings"
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/render"
+	"github.com/go-viper/mapstructure/v2"
+)
+
+type EntropySettings struct {
+	// Maximum number of blocks the binary is split into for the block entropies.
+	Blocks int `koanf:"plugin_blocks"`
+	// Minimum number of bytes in a block, small binaries have fewer blocks rather than smaller ones.
+	MinBlockSize int `koanf:"plugin_min_block_size"`
+	// Comma separated maximum block counts of other resolutions of the block entropies, e.g. a coarse overview and a
+	// finer view to zoom into. None if empty.
+	ResolutionBlocks string `koanf:"plugin_resolution_blocks"`
+	// Number of bytes of content fetched at a time, e.g. 10Mi.
+	FetchChunkSize settings.HumanReadableBytes `koanf:"plugin_fetch_chunk_size"`
+	// Number of chunks fetched ahead of the chunk being analysed, 0 fetches each chunk when it is needed.
+	PrefetchDepth int `koanf:"plugin_prefetch_depth"`
+	// Maximum bytes of the chunks fetched ahead, which limits the prefetch depth for large fetch chunk sizes.
+	PrefetchMaxBytes settings.HumanReadableBytes `koanf:"plugin_prefetch_max_bytes"`
+	// Time the content of a binary is analysed for, the results of the bytes analysed when it runs out are published
+	// marked as truncated. No limit if 0.
+	TimeBudget time.Duration `koanf:"plugin_time_budget"`
+	// Bytes at the start and end of the binary analysed on their own, such as for triage rules. None if 0.
+	HeadSize settings.HumanReadableBytes `koanf:"plugin_head_size"`
+	TailSize settings.HumanReadableBytes `koanf:"plugin_tail_size"`
+	// Comma separated names of features of other plugins whose offset and size give ranges of interest analysed on
+	// their own. None if empty.
+	InterestFeatures string `koanf:"plugin_interest_features"`
+	// Maximum bytes analysed of each range, longer ranges are cut off.
+	InterestMaxSize settings.HumanReadableBytes `koanf:"plugin_interest_max_size"`
+	// Size above which only the head, tail and ranges of interest are analysed, never if 0.
+	RangesOnlyThreshold settings.HumanReadableBytes `koanf:"plugin_ranges_only_threshold"`
+	// Size above which binaries are sampled rather than read in full, never if 0.
+	SamplingThreshold settings.HumanReadableBytes `koanf:"plugin_sampling_threshold"`
+	// Number and size of the windows sampled from across the binary.
+	SamplingWindows    int                         `koanf:"plugin_sampling_windows"`
+	SamplingWindowSize settings.HumanReadableBytes `koanf:"plugin_sampling_window_size"`
+	// Place windows evenly spaced (even), or at random within equal shares of the binary (random).
+	SamplingMode string `koanf:"plugin_sampling_mode"`
+	// Maximum number of goroutines counting the block entropies of each fetched chunk, the number of CPUs if 0.
+	Workers int `koanf:"plugin_workers"`
+	// Upper entropy of each band blocks are classified into, from padding up to compressed. Blocks above the
+	// compressed band are encrypted.
+	RegionPaddingMax    float64 `koanf:"plugin_region_padding_max"`
+	RegionTextMax       float64 `koanf:"plugin_region_text_max"`
+	RegionCodeMax       float64 `koanf:"plugin_region_code_max"`
+	RegionCompressedMax float64 `koanf:"plugin_region_compressed_max"`
+	// Comma separated names of features that aren't published, the info is still published.
+	DisabledFeatures string `koanf:"plugin_disabled_features"`
+
+	// Extract strings with high entropy as possible keys and tokens.
+	StringsEnabled bool `koanf:"plugin_strings_enabled"`
+	// Minimum number of characters for a string to be considered.
+	StringsMinLength int `koanf:"plugin_strings_min_length"`
+	// Maximum number of characters kept for a string, longer strings are truncated.
+	StringsMaxLength int `koanf:"plugin_strings_max_length"`
+	// Minimum entropy relative to the strings charset (0 to 1) for a string to be reported.
+	StringsMinEntropy float64 `koanf:"plugin_strings_min_entropy"`
+	// Maximum number of strings reported, the highest entropy strings are kept.
+	StringsMaxCandidates int `koanf:"plugin_strings_max_candidates"`
+
+	// Detect hex, base32, base64 and ascii85 encoded blobs and measure the entropy of the decoded bytes.
+	EncodedEnabled bool `koanf:"plugin_encoded_enabled"`
+	// Minimum number of encoded characters for a blob to be reported.
+	EncodedMinLength int `koanf:"plugin_encoded_min_length"`
+	// Decoded entropy at or above which a blob is flagged as a likely encrypted or compressed payload.
+	EncodedHighEntropy float64 `koanf:"plugin_encoded_high_entropy"`
+	// Maximum number of blobs reported, the blobs with the highest decoded entropy are kept.
+	EncodedMaxBlobs int `koanf:"plugin_encoded_max_blobs"`
+
+	// Search for content encoded with a single byte or short repeating XOR key.
+	XorEnabled bool `koanf:"plugin_xor_enabled"`
+	// Number of bytes in each window analysed for a repeating key.
+	XorWindowSize int `koanf:"plugin_xor_window_size"`
+	// Only windows with entropy in this range are analysed for a repeating key.
+	XorMinEntropy float64 `koanf:"plugin_xor_min_entropy"`
+	XorMaxEntropy float64 `koanf:"plugin_xor_max_entropy"`
+	// Maximum number of windows analysed for a repeating key.
+	XorMaxWindows int `koanf:"plugin_xor_max_windows"`
+	// Longest repeating key length tested.
+	XorMaxKeyLength int `koanf:"plugin_xor_max_key_length"`
+	// Minimum drop in entropy from decoding a window for its key to be reported.
+	XorMinEntropyDrop float64 `koanf:"plugin_xor_min_entropy_drop"`
+	// Maximum number of keys reported.
+	XorMaxCandidates int `koanf:"plugin_xor_max_candidates"`
+
+	// Count byte transitions and publish the quantised transition matrix.
+	DigraphEnabled bool `koanf:"plugin_digraph_enabled"`
+
+	// Publish a fuzzy signature of the shape of the block entropies for similarity search.
+	SignatureEnabled bool `koanf:"plugin_signature_enabled"`
+	// File of the local similarity index each binary is added to and its nearest profiles are found in, no index if empty.
+	IndexPath string `koanf:"plugin_index_path"`
+	// Number of the nearest profiles in the index reported.
+	IndexNeighbours int `koanf:"plugin_index_neighbours"`
+	// Maximum number of profiles in the index, the oldest are evicted when more binaries are added. No limit if 0.
+	IndexMaxEntries int `koanf:"plugin_index_max_entries"`
+
+	// Baseline model of each file type the binary is scored against, trained with the baseline subcommand. No anomaly
+	// score is published if empty.
+	BaselinePath string `koanf:"plugin_baseline_path"`
+
+	// Classify the binary (e.g. as packed, encrypted or benign) from its entropy outputs.
+	ClassifierEnabled bool `koanf:"plugin_classifier_enabled"`
+	// Classifier model trained with the classifier subcommand, the embedded default model if empty.
+	ClassifierPath string `koanf:"plugin_classifier_path"`
+
+	// Index the byte counts at a fine granularity and attach the index to the binary, so the entropy of any range can
+	// be queried later without the content.
+	RangeIndexEnabled bool `koanf:"plugin_range_index_enabled"`
+	// Maximum number of granules the binary is split into for the index, ranges are measured to the nearest granule.
+	RangeIndexGranules int `koanf:"plugin_range_index_granules"`
+	// Minimum number of bytes in a granule, smaller granules are more precise but make a larger index.
+	RangeIndexMinGranuleSize int `koanf:"plugin_range_index_min_granule_size"`
+
+	// Publish the normalised byte histogram and statistics derived from it.
+	HistogramEnabled bool `koanf:"plugin_histogram_enabled"`
+	// Number of the most frequent bytes reported.
+	HistogramTopBytes int `koanf:"plugin_histogram_top_bytes"`
+
+	// Render the block entropies as a PNG graph attached to the binary.
+	GraphEnabled bool `koanf:"plugin_graph_enabled"`
+	// Size of the rendered graph in pixels.
+	GraphWidth  int `koanf:"plugin_graph_width"`
+	GraphHeight int `koanf:"plugin_graph_height"`
+
+	// Render the binary laid out on a Hilbert curve as a PNG attached to the binary.
+	HilbertEnabled bool `koanf:"plugin_hilbert_enabled"`
+	// Colour cells by local entropy ("entropy") or by the mix of byte classes ("class").
+	HilbertMode string `koanf:"plugin_hilbert_mode"`
+	// Width and height of the rendered map in pixels, rounded down to a power of two.
+	HilbertSize int `koanf:"plugin_hilbert_size"`
+
+	// Parse the sections of PE, ELF and Mach-O binaries and publish them in the info, they are also parsed when the
+	// classifier is enabled.
+	SectionsEnabled bool `koanf:"plugin_sections_enabled"`
+
+	// Render the block entropies, regions and sections as SVG and Vega-Lite charts attached to the binary.
+	ChartsEnabled bool `koanf:"plugin_charts_enabled"`
+	// Size of the rendered charts in pixels.
+	ChartWidth  int `koanf:"plugin_chart_width"`
+	ChartHeight int `koanf:"plugin_chart_height"`
+}
+
+var entropySettingsDefaults = EntropySettings{
+	Blocks:                   800,
+	MinBlockSize:             256,
+	ResolutionBlocks:         "",
+	FetchChunkSize:           10 * 1024 * 1024,
+	PrefetchDepth:            2,
+	PrefetchMaxBytes:         64 * 1024 * 1024,
+	TimeBudget:               0,
+	HeadSize:                 0,
+	TailSize:                 0,
+	InterestFeatures:         "",
+	InterestMaxSize:          1024 * 1024,
+	RangesOnlyThreshold:      0,
+	SamplingThreshold:        4 * 1024 * 1024 * 1024,
+	SamplingWindows:          1024,
+	SamplingWindowSize:       64 * 1024,
+	SamplingMode:             "even",
+	Workers:                  0,
+	RegionPaddingMax:         1,
+	RegionTextMax:            4.5,
+	RegionCodeMax:            6.5,
+	RegionCompressedMax:      7.2,
+	DisabledFeatures:         "",
+	StringsEnabled:           false,
+	StringsMinLength:         16,
+	StringsMaxLength:         256,
+	StringsMinEntropy:        0.85,
+	StringsMaxCandidates:     20,
+	EncodedEnabled:           false,
+	EncodedMinLength:         64,
+	EncodedHighEntropy:       7.2,
+	EncodedMaxBlobs:          20,
+	XorEnabled:               false,
+	XorWindowSize:            4096,
+	XorMinEntropy:            1.0,
+	XorMaxEntropy:            7.0,
+	XorMaxWindows:            64,
+	XorMaxKeyLength:          32,
+	XorMinEntropyDrop:        0.5,
+	XorMaxCandidates:         10,
+	DigraphEnabled:           false,
+	SignatureEnabled:         false,
+	IndexPath:                "",
+	IndexNeighbours:          10,
+	IndexMaxEntries:          100000,
+	BaselinePath:             "",
+	ClassifierEnabled:        false,
+	ClassifierPath:           "",
+	RangeIndexEnabled:        false,
+	RangeIndexGranules:       4096,
+	RangeIndexMinGranuleSize: 4096,
+	HistogramEnabled:         false,
+	HistogramTopBytes:        8,
+	GraphEnabled:             false,
+	GraphWidth:               800,
+	GraphHeight:              200,
+	HilbertEnabled:           false,
+	HilbertMode:              "entropy",
+	HilbertSize:              512,
+	SectionsEnabled:          false,
+	ChartsEnabled:            false,
+	ChartWidth:               800,
+	ChartHeight:              240,
+}
+
+// Get a copy of the default entropy settings.
+func NewDefaultEntropySettings() *EntropySettings {
+	copyOfDefaults := entropySettingsDefaults
+	return &copyOfDefaults
+}
+
+// Parse entropy settings with overrides from the environment, returning an error if any are invalid.
+func ParseEntropySettings() (*EntropySettings, error) {
+	parsed := settings.ParseSettings(entropySettingsDefaults, "", []mapstructure.DecodeHookFunc{
+		settings.HumanReadableBytesHookFunc(),
+		mapstructure.StringToTimeDurationHookFunc(),
+	})
+	err := parsed.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// Check every setting is in range, returning an error describing each invalid setting.
+func (s *EntropySettings) Validate() error {
+	var errs []error
+	atLeast := func(name string, value int, minimum int) {
+		if value < minimum {
+			errs = append(errs, fmt.Errorf("%s must be at least %d, got %d", name, minimum, value))
+		}
+	}
+	between := func(name string, value float64, minimum float64, maximum float64) {
+		if value < minimum || value > maximum {
+			errs = append(errs, fmt.Errorf("%s must be from %v to %v, got %v", name, minimum, maximum, value))
+		}
+	}
+	atLeast("PLUGIN_BLOCKS", s.Blocks, 1)
+	atLeast("PLUGIN_MIN_BLOCK_SIZE", s.MinBlockSize, 1)
+	_, err := s.resolutionBlocks()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if s.FetchChunkSize == 0 {
+		errs = append(errs, errors.New("PLUGIN_FETCH_CHUNK_SIZE must be at least 1 byte"))
+	}
+	atLeast("PLUGIN_PREFETCH_DEPTH", s.PrefetchDepth, 0)
+	if s.TimeBudget < 0 {
+		errs = append(errs, fmt.Errorf("PLUGIN_TIME_BUDGET must not be negative, got %v", s.TimeBudget))
+	}
+	if s.InterestMaxSize == 0 {
+		errs = append(errs, errors.New("PLUGIN_INTEREST_MAX_SIZE must be at least 1 byte"))
+	}
+	atLeast("PLUGIN_SAMPLING_WINDOWS", s.SamplingWindows, 1)
+	if s.SamplingWindowSize == 0 {
+		errs = append(errs, errors.New("PLUGIN_SAMPLING_WINDOW_SIZE must be at least 1 byte"))
+	}
+	if s.SamplingMode != "even" && s.SamplingMode != "random" {
+		errs = append(errs, fmt.Errorf("PLUGIN_SAMPLING_MODE must be even or random, got %q", s.SamplingMode))
+	}
+	atLeast("PLUGIN_WORKERS", s.Workers, 0)
+	thresholds := []float64{0, s.RegionPaddingMax, s.RegionTextMax, s.RegionCodeMax, s.RegionCompressedMax, 8}
+	for i := 1; i < len(thresholds); i++ {
+		if thresholds[i] <= thresholds[i-1] {
+			errs = append(errs, fmt.Errorf("PLUGIN_REGION_*_MAX must increase from padding to compressed between 0 and 8, got %v", thresholds[1:5]))
+			break
+		}
+	}
+	known := []string{}
+	for _, feature := range (&EntropyPlugin{}).GetFeatures() {
+		known = append(known, feature.Name)
+	}
+	for name := range s.disabledFeatures() {
+		if !slices.Contains(known, name) {
+			errs = append(errs, fmt.Errorf("PLUGIN_DISABLED_FEATURES has unknown feature %q", name))
+		}
+	}
+
+	atLeast("PLUGIN_STRINGS_MIN_LENGTH", s.StringsMinLength, 1)
+	atLeast("PLUGIN_STRINGS_MAX_LENGTH", s.StringsMaxLength, s.StringsMinLength)
+	between("PLUGIN_STRINGS_MIN_ENTROPY", s.StringsMinEntropy, 0, 1)
+	atLeast("PLUGIN_STRINGS_MAX_CANDIDATES", s.StringsMaxCandidates, 0)
+	atLeast("PLUGIN_ENCODED_MIN_LENGTH", s.EncodedMinLength, 1)
+	between("PLUGIN_ENCODED_HIGH_ENTROPY", s.EncodedHighEntropy, 0, 8)
+	atLeast("PLUGIN_ENCODED_MAX_BLOBS", s.EncodedMaxBlobs, 0)
+	atLeast("PLUGIN_XOR_WINDOW_SIZE", s.XorWindowSize, 1)
+	between("PLUGIN_XOR_MIN_ENTROPY", s.XorMinEntropy, 0, 8)
+	between("PLUGIN_XOR_MAX_ENTROPY", s.XorMaxEntropy, s.XorMinEntropy, 8)
+	atLeast("PLUGIN_XOR_MAX_WINDOWS", s.XorMaxWindows, 0)
+	atLeast("PLUGIN_XOR_MAX_KEY_LENGTH", s.XorMaxKeyLength, 1)
+	between("PLUGIN_XOR_MIN_ENTROPY_DROP", s.XorMinEntropyDrop, 0, 8)
+	atLeast("PLUGIN_XOR_MAX_CANDIDATES", s.XorMaxCandidates, 0)
+	atLeast("PLUGIN_INDEX_NEIGHBOURS", s.IndexNeighbours, 1)
+	atLeast("PLUGIN_INDEX_MAX_ENTRIES", s.IndexMaxEntries, 0)
+	atLeast("PLUGIN_RANGE_INDEX_GRANULES", s.RangeIndexGranules, 1)
+	atLeast("PLUGIN_RANGE_INDEX_MIN_GRANULE_SIZE", s.RangeIndexMinGranuleSize, 1)
+	atLeast("PLUGIN_HISTOGRAM_TOP_BYTES", s.HistogramTopBytes, 0)
+	atLeast("PLUGIN_GRAPH_WIDTH", s.GraphWidth, 1)
+	atLeast("PLUGIN_GRAPH_HEIGHT", s.GraphHeight, 1)
+	if mode := render.HilbertMode(s.HilbertMode); mode != render.HilbertModeEntropy && mode != render.HilbertModeClass {
+		errs = append(errs, fmt.Errorf("PLUGIN_HILBERT_MODE must be entropy or class, got %q", s.HilbertMode))
+	}
+	atLeast("PLUGIN_HILBERT_SIZE", s.HilbertSize, 1)
+	atLeast("PLUGIN_CHART_WIDTH", s.ChartWidth, 1)
+	atLeast("PLUGIN_CHART_HEIGHT", s.ChartHeight, 1)
+	return errors.Join(errs...)
+}
+
+// Maximum block counts of the other resolutions.
+func (s *EntropySettings) resolutionBlocks() ([]int, error) {
+	counts := []int{}
+	for _, value := range strings.Split(s.ResolutionBlocks, ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 1 {
+			return nil, fmt.Errorf("PLUGIN_RESOLUTION_BLOCKS must be block counts of at least 1, got %q", value)
+		}
+		counts = append(counts, count)
+	}
+	return counts, nil
+}
+
+// Names of the features that aren't published.
+func (s *EntropySettings) disabledFeatures() map[string]bool {
+	return featureNames(s.DisabledFeatures)
+}
+
+// Names of the features of other plugins that give ranges of interest.
+func (s *EntropySettings) interestFeatures() map[string]bool {
+	return featureNames(s.InterestFeatures)
+}
+
+// Parse comma separated feature names.
+func featureNames(value string) map[string]bool {
+	names := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// Bands blocks are classified into, the default bands with the configured thresholds.
+func (s *EntropySettings) bands() []render.Band {
+	bands := slices.Clone(render.DefaultBands)
+	thresholds := []float64{s.RegionPaddingMax, s.RegionTextMax, s.RegionCodeMax, s.RegionCompressedMax}
+	for i, threshold := range thresholds {
+		bands[i].Max = threshold
+		bands[i+1].Min = threshold
+	}
+	return bands
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/render"
+)
+
+func TestParseEntropySettings(t *testing.T) {
+	t.Setenv("PLUGIN_BLOCKS", "64")
+	t.Setenv("PLUGIN_FETCH_CHUNK_SIZE", "1Mi")
+	t.Setenv("PLUGIN_RESOLUTION_BLOCKS", "64,4096")
+	t.Setenv("PLUGIN_REGION_CODE_MAX", "6")
+	t.Setenv("PLUGIN_DISABLED_FEATURES", "entropy_signature, digraph_repeat_ratio")
+	t.Setenv("PLUGIN_TIME_BUDGET", "2m30s")
+	config, err := ParseEntropySettings()
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if resolutions, _ := config.resolutionBlocks(); !reflect.DeepEqual(resolutions, []int{64, 4096}) {
+		t.Errorf("Unexpected resolutions, got: %v", resolutions)
+	}
+	if config.Blocks != 64 || config.FetchChunkSize != 1024*1024 || config.MinBlockSize != 256 || config.TimeBudget != 150*time.Second {
+		t.Errorf("Unexpected settings, got: %+v", config)
+	}
+	if disabled := config.disabledFeatures(); len(disabled) != 2 || !disabled["digraph_repeat_ratio"] {
+		t.Errorf("Unexpected disabled features, got: %v", disabled)
+	}
+	bands := config.bands()
+	if bands[2].Max != 6 || bands[3].Min != 6 || render.DefaultBands[2].Max != 6.5 {
+		t.Errorf("Expected the thresholds to move the bands, got: %+v", bands)
+	}
+
+	t.Setenv("PLUGIN_BLOCKS", "0")
+	_, err = ParseEntropySettings()
+	if err == nil || !strings.Contains(err.Error(), "PLUGIN_BLOCKS") {
+		t.Errorf("Expected an invalid block count to be reported, got: %v", err)
+	}
+}
+
+func TestValidateEntropySettings(t *testing.T) {
+	if err := NewDefaultEntropySettings().Validate(); err != nil {
+		t.Errorf("Expected the defaults to be valid, got: %v", err)
+	}
+	config := NewDefaultEntropySettings()
+	config.MinBlockSize = 0
+	config.ResolutionBlocks = "64, 0"
+	config.RegionTextMax = 7
+	config.StringsMinEntropy = 2
+	config.HilbertMode = "colour"
+	config.SamplingMode = "stratified"
+	config.DisabledFeatures = "entropy,not_a_feature"
+	err := config.Validate()
+	if err == nil {
+		t.Fatalf("Expected invalid settings to be reported")
+	}
+	for _, expected := range []string{
+		"PLUGIN_MIN_BLOCK_SIZE must be at least 1, got 0",
+		"PLUGIN_RESOLUTION_BLOCKS must be block counts of at least 1, got \"0\"",
+		"PLUGIN_REGION_*_MAX must increase from padding to compressed between 0 and 8, got [1 7 6.5 7.2]",
+		"PLUGIN_STRINGS_MIN_ENTROPY must be from 0 to 1, got 2",
+		"PLUGIN_HILBERT_MODE must be entropy or class, got \"colour\"",
+		"PLUGIN_SAMPLING_MODE must be even or random, got \"stratified\"",
+		"PLUGIN_DISABLED_FEATURES has unknown feature \"not_a_feature\"",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q to be reported, got: %v", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "\"entropy\"") {
+		t.Errorf("Expected known features to be accepted, got: %v", err)
+	}
+}
+
+func TestPluginDefaultSettings(t *testing.T) {
+	defaults := (&EntropyPlugin{}).GetDefaultSettings()
+	if defaults.PluginRunTimeout != 600 || defaults.MaxValuesPerFeature != 1000 {
+		t.Errorf("Expected the runner defaults, got: %+v", defaults)
+	}
+
+	config := NewDefaultEntropySettings()
+	config.TimeBudget = 10 * time.Minute
+	config.StringsMaxCandidates = 5000
+	defaults = (&EntropyPlugin{settings: config}).GetDefaultSettings()
+	if defaults.PluginRunTimeout != 660 || defaults.MaxValuesPerFeature != 5000 {
+		t.Errorf("Expected the runner settings to fit the entropy settings, got: %+v", defaults)
+	}
+}
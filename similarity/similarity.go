@@ -0,0 +1,343 @@
+/*
+Local index of entropy signatures for finding the profiles nearest to a file without an external database.
+
+Signatures are split into bands of points and each band is hashed at a coarser quantisation into buckets (locality
+sensitive hashing), so only profiles sharing a bucket with the query are compared. Each band is hashed twice with the
+quantisation shifted by half a step, so adjacent levels either side of a step boundary still share a bucket.
+
+The index is persisted as a file of JSON lines, each adding a signature. Adding appends to the file so the whole index
+isn't rewritten on every addition, and a later line for the same name replaces the earlier one when the file is opened.
+An index limited to a maximum number of entries evicts the oldest when more are added, and rewrites the file with only
+the remaining entries once most of its lines are replaced or evicted, so neither the index nor the file grows without
+bound.
+*/
+package similarity
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/entropy"
+)
+
+// Number of points of the signature hashed together into a bucket.
+const bandSize = 4
+
+// Number of signature levels merged into one level of a bucket key.
+const bucketStep = 2
+
+// A signature added to the index.
+type Entry struct {
+	// Name identifying the profile, the sha256 of the binary.
+	Name      string `json:"name"`
+	Signature string `json:"signature"`
+	// Local path the profile was added from, only kept to describe it.
+	Path string `json:"path,omitempty"`
+}
+
+// An entry near the queried signature.
+type Neighbour struct {
+	Entry
+	// Distance from the queried signature, see entropy.SignatureDistance.
+	Distance float64 `json:"distance"`
+}
+
+// Bucket of signatures sharing a band of coarse levels.
+type bucketKey struct {
+	// Which of the shifted quantisations the key is from.
+	shift int
+	band  int
+	key   [bandSize]byte
+}
+
+// Signatures indexed by bucket, safe for concurrent use.
+type Index struct {
+	mutex   sync.RWMutex
+	entries []Entry
+	// Position of each name in entries.
+	names   map[string]int
+	buckets map[bucketKey][]int
+	// File additions are appended to, empty for an index only held in memory.
+	path string
+	// Maximum number of entries, no limit if 0.
+	maxEntries int
+	// Position in entries before which every entry is replaced or evicted.
+	oldest int
+	// Malformed last line dropped when the index was opened, see Repaired.
+	repaired error
+}
+
+// Create an empty index held in memory.
+func New() *Index {
+	return &Index{names: map[string]int{}, buckets: map[bucketKey][]int{}}
+}
+
+// Open the index persisted at the path, creating it when it is first added to. A malformed last line, such as one cut
+// off by a crash while it was appended, is dropped from the file and reported by Repaired, a malformed line followed
+// by others fails to open.
+func Open(path string) (*Index, error) {
+	index := New()
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		index.path = path
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	line := 0
+	// End of the lines read and whether the last ended with a newline.
+	end, newline := int64(0), true
+	for {
+		content, readErr := reader.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return nil, readErr
+		}
+		if len(content) > 0 {
+			line++
+			if strings.TrimSpace(string(content)) != "" {
+				if index.repaired != nil {
+					return nil, index.repaired
+				}
+				var entry Entry
+				err = json.Unmarshal(content, &entry)
+				if err == nil {
+					err = index.add(entry)
+				}
+				if err != nil {
+					index.repaired = fmt.Errorf("%s line %d: %w", path, line, err)
+					continue
+				}
+			}
+			end, newline = end+int64(len(content)), content[len(content)-1] == '\n'
+		}
+		if readErr != nil {
+			break
+		}
+	}
+	// Entries are appended on a line of their own.
+	if index.repaired != nil {
+		err = os.Truncate(path, end)
+	}
+	if err == nil && !newline {
+		err = appendLine(path, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	index.path = path
+	return index, nil
+}
+
+// Error for the malformed last line dropped from the file when the index was opened, nil if every line was read.
+func (ix *Index) Repaired() error {
+	return ix.repaired
+}
+
+// Number of profiles in the index.
+func (ix *Index) Len() int {
+	ix.mutex.RLock()
+	defer ix.mutex.RUnlock()
+	return len(ix.names)
+}
+
+// Limit the index to maxEntries profiles, evicting the oldest entries when there are more. No limit if 0.
+// An index opened from a file has the file rewritten when entries are evicted.
+func (ix *Index) SetMaxEntries(maxEntries int) error {
+	ix.mutex.Lock()
+	defer ix.mutex.Unlock()
+	ix.maxEntries = max(maxEntries, 0)
+	if !ix.evict() {
+		return nil
+	}
+	return ix.compact()
+}
+
+// Add the signature of a profile to the index, replacing any previous signature with the same name.
+// An index opened from a file has the entry appended to the file.
+func (ix *Index) Add(name string, signature string) error {
+	return ix.AddEntry(Entry{Name: name, Signature: signature})
+}
+
+// Add the entry to the index in the same way as Add, keeping the path it describes the profile with.
+func (ix *Index) AddEntry(entry Entry) error {
+	ix.mutex.Lock()
+	defer ix.mutex.Unlock()
+	if position, ok := ix.names[entry.Name]; ok && ix.entries[position] == entry {
+		return nil
+	}
+	err := ix.add(entry)
+	if err != nil {
+		return err
+	}
+	// Most of the entries are replaced or evicted by the time there are twice the maximum.
+	if ix.evict() && len(ix.entries) >= 2*ix.maxEntries {
+		return ix.compact()
+	}
+	if ix.path == "" {
+		return nil
+	}
+	return ix.persist(entry)
+}
+
+func (ix *Index) add(entry Entry) error {
+	levels, err := entropy.SignatureLevels(entry.Signature)
+	if err != nil {
+		return err
+	}
+	// Replaced entries stay in their buckets and are skipped when found.
+	position := len(ix.entries)
+	ix.entries = append(ix.entries, entry)
+	ix.names[entry.Name] = position
+	for _, key := range bucketKeys(levels) {
+		ix.buckets[key] = append(ix.buckets[key], position)
+	}
+	return nil
+}
+
+// Whether the entry at the position is neither replaced nor evicted.
+func (ix *Index) live(position int) bool {
+	current, ok := ix.names[ix.entries[position].Name]
+	return ok && current == position
+}
+
+// Evict the oldest entries while there are more than the maximum, returning whether any were evicted.
+func (ix *Index) evict() bool {
+	evicted := false
+	for ix.maxEntries > 0 && len(ix.names) > ix.maxEntries {
+		if ix.live(ix.oldest) {
+			delete(ix.names, ix.entries[ix.oldest].Name)
+			evicted = true
+		}
+		ix.oldest++
+	}
+	return evicted
+}
+
+// Drop the replaced and evicted entries, rewriting the file of an index opened from one.
+func (ix *Index) compact() error {
+	entries := []Entry{}
+	for position := ix.oldest; position < len(ix.entries); position++ {
+		if ix.live(position) {
+			entries = append(entries, ix.entries[position])
+		}
+	}
+	ix.entries, ix.oldest = nil, 0
+	ix.names, ix.buckets = map[string]int{}, map[bucketKey][]int{}
+	for _, entry := range entries {
+		// The signatures were valid when first added.
+		_ = ix.add(entry)
+	}
+	if ix.path == "" {
+		return nil
+	}
+	// Written beside the index and renamed over it, so a failure part way leaves the previous file.
+	file, err := os.CreateTemp(filepath.Dir(ix.path), filepath.Base(ix.path)+".*")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range entries {
+		err = encoder.Encode(&entry)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), ix.path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+func (ix *Index) persist(entry Entry) error {
+	line, err := json.Marshal(&entry)
+	if err != nil {
+		return err
+	}
+	return appendLine(ix.path, line)
+}
+
+// Append the line and a newline to the file, creating it if it doesn't exist.
+func appendLine(path string, line []byte) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Find up to k profiles nearest to the signature, nearest first.
+// Only profiles sharing a bucket with the signature are considered, so distant profiles are not returned.
+func (ix *Index) Query(signature string, k int) ([]Neighbour, error) {
+	levels, err := entropy.SignatureLevels(signature)
+	if err != nil {
+		return nil, err
+	}
+	ix.mutex.RLock()
+	defer ix.mutex.RUnlock()
+	seen := map[int]bool{}
+	result := []Neighbour{}
+	for _, key := range bucketKeys(levels) {
+		for _, position := range ix.buckets[key] {
+			if seen[position] || !ix.live(position) {
+				continue
+			}
+			seen[position] = true
+			entry := ix.entries[position]
+			distance, err := entropy.SignatureDistance(signature, entry.Signature)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, Neighbour{Entry: entry, Distance: distance})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Distance != result[j].Distance {
+			return result[i].Distance < result[j].Distance
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result[:min(len(result), max(k, 0))], nil
+}
+
+// Keys of the buckets holding a signature, one for each band at each shift of the quantisation.
+func bucketKeys(levels []int) []bucketKey {
+	keys := make([]bucketKey, 0, 2*len(levels)/bandSize)
+	for shift := range 2 {
+		for band := 0; band+bandSize <= len(levels); band += bandSize {
+			key := bucketKey{shift: shift, band: band / bandSize}
+			for i := range bandSize {
+				key.key[i] = byte((levels[band+i] + shift*bucketStep/2) / bucketStep)
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
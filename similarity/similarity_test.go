@@ -0,0 +1,252 @@
+package similarity
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	packed  = strings.Repeat("2", 8) + strings.Repeat("f", 48) + strings.Repeat("4", 8)
+	variant = strings.Repeat("2", 8) + strings.Repeat("e", 48) + strings.Repeat("4", 8)
+	text    = strings.Repeat("7", 64)
+	padding = strings.Repeat("0", 64)
+)
+
+func TestQuery(t *testing.T) {
+	index := New()
+	for name, signature := range map[string]string{"packed": packed, "variant": variant, "text": text, "padding": padding} {
+		err := index.Add(name, signature)
+		if err != nil {
+			t.Fatalf("error %v", err)
+		}
+	}
+	neighbours, err := index.Query(packed, 10)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	// Profiles with a different shape share no buckets with the query.
+	if len(neighbours) != 2 || neighbours[0].Name != "packed" || neighbours[0].Distance != 0 || neighbours[1].Name != "variant" {
+		t.Errorf("Unexpected neighbours, got: %+v", neighbours)
+	}
+	neighbours, err = index.Query(packed, 1)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if len(neighbours) != 1 {
+		t.Errorf("Expected only the nearest neighbour, got: %+v", neighbours)
+	}
+	_, err = index.Query("zz", 1)
+	if err == nil {
+		t.Errorf("Expected an error for an invalid signature")
+	}
+}
+
+func TestBucketBoundary(t *testing.T) {
+	// Levels 7 and 8 are either side of a step, but share a bucket once the quantisation is shifted.
+	index := New()
+	err := index.Add("eight", strings.Repeat("8", 64))
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	neighbours, err := index.Query(strings.Repeat("7", 64), 10)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if len(neighbours) != 1 {
+		t.Errorf("Expected a neighbour across the step boundary, got: %+v", neighbours)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	index := New()
+	for _, signature := range []string{text, packed} {
+		err := index.Add("sample", signature)
+		if err != nil {
+			t.Fatalf("error %v", err)
+		}
+	}
+	if index.Len() != 1 {
+		t.Errorf("Expected the signature to be replaced, got %v entries", index.Len())
+	}
+	neighbours, err := index.Query(text, 10)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if len(neighbours) != 0 {
+		t.Errorf("Expected the replaced signature to be gone, got: %+v", neighbours)
+	}
+	neighbours, err = index.Query(packed, 10)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if len(neighbours) != 1 || neighbours[0].Name != "sample" {
+		t.Errorf("Expected the new signature, got: %+v", neighbours)
+	}
+}
+
+func TestPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	index, err := Open(path)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	for _, entry := range []Entry{{Name: "a", Signature: text}, {Name: "b", Signature: packed}, {Name: "a", Signature: variant}, {Name: "a", Signature: variant}} {
+		err = index.Add(entry.Name, entry.Signature)
+		if err != nil {
+			t.Fatalf("error %v", err)
+		}
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	// Adding the same signature again isn't persisted.
+	if lines := strings.Count(string(content), "\n"); lines != 3 {
+		t.Errorf("Expected an appended line per change, got: %v", string(content))
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	neighbours, err := reopened.Query(packed, 10)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if reopened.Len() != 2 || len(neighbours) != 2 || neighbours[0].Name != "b" || neighbours[1].Name != "a" {
+		t.Errorf("Unexpected neighbours after reopening, got: %+v", neighbours)
+	}
+
+	// A malformed line followed by others is corruption.
+	good := "{\"name\":\"a\",\"signature\":\"" + text + "\"}\n"
+	err = os.WriteFile(path, []byte("{\"name\":\"bad\",\"signature\":\"0\"}\n"+good), 0o644)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	_, err = Open(path)
+	if err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("Expected an error for an invalid line, got: %v", err)
+	}
+}
+
+func TestPartialLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	good := "{\"name\":\"a\",\"signature\":\"" + text + "\"}\n"
+	for _, partial := range []string{"{\"name\":\"b\",\"signa", "{\"name\":\"b\",\"signature\":\"0\"}\n"} {
+		err := os.WriteFile(path, []byte(good+partial), 0o644)
+		if err != nil {
+			t.Fatalf("error %v", err)
+		}
+		// The line cut off by a crash is dropped from the file, so the next line is appended after the last whole one.
+		index, err := Open(path)
+		if err != nil || index.Len() != 1 || index.Repaired() == nil || !strings.Contains(index.Repaired().Error(), "line 2") {
+			t.Fatalf("Expected the partial line to be dropped, got: %v %v", err, index)
+		}
+		err = index.Add("c", packed)
+		if err != nil {
+			t.Fatalf("error %v", err)
+		}
+		reopened, err := Open(path)
+		if err != nil || reopened.Len() != 2 || reopened.Repaired() != nil {
+			t.Errorf("Expected the repaired index to reopen, got: %v %v", err, reopened)
+		}
+	}
+
+	// A last line missing only its newline is kept, the next line is appended on a line of its own.
+	err := os.WriteFile(path, []byte(strings.TrimSuffix(good, "\n")), 0o644)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	index, err := Open(path)
+	if err == nil {
+		err = index.Add("c", packed)
+	}
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	reopened, err := Open(path)
+	if err != nil || reopened.Len() != 2 {
+		t.Errorf("Expected both lines, got: %v %v", err, reopened)
+	}
+}
+
+func TestMaxEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	index, err := Open(path)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	err = index.SetMaxEntries(2)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	for _, entry := range []Entry{{Name: "a", Signature: text}, {Name: "b", Signature: packed}, {Name: "c", Signature: variant}, {Name: "d", Signature: padding}} {
+		err = index.Add(entry.Name, entry.Signature)
+		if err != nil {
+			t.Fatalf("error %v", err)
+		}
+	}
+	// The oldest entries are evicted.
+	neighbours, err := index.Query(packed, 10)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if index.Len() != 2 || len(neighbours) != 1 || neighbours[0].Name != "c" {
+		t.Errorf("Expected the oldest entries to be evicted, got: %v %+v", index.Len(), neighbours)
+	}
+	// The file is rewritten with only the remaining entries once there are twice the maximum.
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if lines := strings.Count(string(content), "\n"); lines != 2 || strings.Contains(string(content), "\"a\"") {
+		t.Errorf("Expected the file to be compacted, got: %v", string(content))
+	}
+
+	// Limiting an index opened from a larger file evicts its oldest entries.
+	err = index.Add("e", text)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	err = reopened.SetMaxEntries(1)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	neighbours, err = reopened.Query(text, 10)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	if reopened.Len() != 1 || len(neighbours) != 1 || neighbours[0].Name != "e" {
+		t.Errorf("Expected only the newest entry, got: %v %+v", reopened.Len(), neighbours)
+	}
+	content, err = os.ReadFile(path)
+	if err != nil || strings.Count(string(content), "\n") != 1 {
+		t.Errorf("Expected the file to be compacted, got: %v %v", string(content), err)
+	}
+}
+
+func TestEntryPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.jsonl")
+	index, err := Open(path)
+	if err == nil {
+		err = index.AddEntry(Entry{Name: "abc", Signature: packed, Path: "samples/packed.exe"})
+	}
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	// The path describes the profile, it is still named by its hash.
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("error %v", err)
+	}
+	neighbours, err := reopened.Query(packed, 1)
+	if err != nil || len(neighbours) != 1 || neighbours[0].Name != "abc" || neighbours[0].Path != "samples/packed.exe" {
+		t.Errorf("Expected the path to be kept, got: %v %+v", err, neighbours)
+	}
+}
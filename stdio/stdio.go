@@ -0,0 +1,28 @@
+/*
+Keeps stdout for the results of a subcommand.
+
+Bedrock prints its settings to stdout when its packages are initialised, before main runs. This package only imports
+the standard library, so it is initialised before bedrock, and when the binary is run with a subcommand it points
+os.Stdout at stderr. The results of the subcommand are written to Stdout, so they can be piped to another tool.
+*/
+package stdio
+
+import (
+	"os"
+	"strings"
+)
+
+// Stdout of the process, kept while os.Stdout points at stderr.
+var Stdout = os.Stdout
+
+func init() {
+	// Any argument that isn't a flag names a subcommand, the plugin is run without arguments.
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		os.Stdout = os.Stderr
+	}
+}
+
+// Point os.Stdout back at stdout.
+func Restore() {
+	os.Stdout = Stdout
+}
@@ -0,0 +1,339 @@
+/*
+Detect content encoded with a single byte or short repeating XOR key.
+XOR encoding with a short key keeps most of the structure of the original data, so the overall entropy looks normal.
+Two approaches are used to recover keys:
+  - Known plaintext that starts common file formats (PE, ELF and ZIP) is searched for using the XOR of adjacent bytes,
+    which is the same before and after encoding with a single byte key.
+  - Windows of low to mid entropy have their key length estimated with the index of coincidence, the key is derived
+    from the most common byte of each column and kept if decoding drops the entropy of the window. A single byte key
+    only swaps byte values, leaving the entropy and the coincidence of a window unchanged, so windows only report keys
+    of two or more bytes and single byte keys are left to the known plaintext search.
+*/
+package xor
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/entropy"
+)
+
+// Known plaintext used to find a format encoded with a single byte key.
+type signature struct {
+	magic string
+	// Offset of the plaintext from the start of the file.
+	offset    uint64
+	plaintext []byte
+	// XOR of adjacent plaintext bytes, which is unchanged by single byte XOR encoding.
+	diffs []byte
+}
+
+var signatures = newSignatures([]signature{
+	{magic: "pe", offset: 0x4e, plaintext: []byte("This program cannot be run in DOS mode")},
+	{magic: "elf", plaintext: []byte("\x7fELF\x01\x01\x01")},
+	{magic: "elf", plaintext: []byte("\x7fELF\x02\x01\x01")},
+	{magic: "elf", plaintext: []byte("\x7fELF\x01\x02\x01")},
+	{magic: "elf", plaintext: []byte("\x7fELF\x02\x02\x01")},
+	{magic: "zip", plaintext: []byte("PK\x03\x04\x0a\x00")},
+	{magic: "zip", plaintext: []byte("PK\x03\x04\x14\x00")},
+	{magic: "zip", plaintext: []byte("PK\x03\x04\x2d\x00")},
+})
+
+// Longest signature plaintext, the number of bytes carried between appends.
+var maxSignatureLength = func() int {
+	longest := 0
+	for _, sig := range signatures {
+		longest = max(longest, len(sig.plaintext))
+	}
+	return longest
+}()
+
+func newSignatures(sigs []signature) []signature {
+	for i := range sigs {
+		sigs[i].diffs = adjacentDiffs(nil, sigs[i].plaintext)
+	}
+	return sigs
+}
+
+// A recovered XOR key.
+type Candidate struct {
+	// Offset where the key was first found, the start of the encoded file for known plaintext matches.
+	Offset uint64
+	// Key aligned to the start of the file, key[i % len(key)] decodes the byte at offset i.
+	Key []byte
+	// File format found by decoding with the key, empty if the key was found by an entropy drop.
+	Magic string
+	// Number of windows or signatures the key was found in.
+	Count int
+	// Entropy of the first window the key was found in, before and after decoding.
+	Entropy        float64
+	DecodedEntropy float64
+}
+
+// Thresholds controlling the windows analysed and the keys reported.
+type Options struct {
+	// Number of bytes in each window analysed for a repeating key.
+	WindowSize int
+	// Only windows with entropy in this range are analysed.
+	MinEntropy float64
+	MaxEntropy float64
+	// Maximum number of windows analysed, bounding the time spent on large files.
+	MaxWindows int
+	// Longest repeating key length tested.
+	MaxKeyLength int
+	// Minimum drop in entropy from decoding a window for the key to be reported.
+	MinEntropyDrop float64
+	// Maximum number of keys reported.
+	MaxCandidates int
+}
+
+// Scanner searches for XOR keys in bytes appended in order.
+type Scanner struct {
+	options Options
+	offset  uint64
+	// Bytes of the current window.
+	window         []byte
+	windowsChecked int
+	// Last bytes seen and their adjacent XOR, so signatures split across appends are found.
+	tail      []byte
+	diffs     []byte
+	found     map[string]*Candidate
+	foundKeys []string
+}
+
+// Create a new Scanner that reports keys matching the provided options.
+func NewScanner(options Options) *Scanner {
+	return &Scanner{
+		options: options,
+		window:  make([]byte, 0, max(options.WindowSize, 0)),
+		found:   map[string]*Candidate{},
+	}
+}
+
+// Append the next bytes of the file to the scanner.
+func (s *Scanner) Append(buf []byte) {
+	s.searchSignatures(buf)
+	for len(buf) > 0 && s.options.WindowSize > 0 {
+		take := min(s.options.WindowSize-len(s.window), len(buf))
+		s.window = append(s.window, buf[:take]...)
+		buf = buf[take:]
+		if len(s.window) == s.options.WindowSize {
+			s.checkWindow(s.offset + uint64(take) - uint64(s.options.WindowSize))
+			s.window = s.window[:0]
+		}
+		s.offset += uint64(take)
+	}
+	if s.options.WindowSize <= 0 {
+		s.offset += uint64(len(buf))
+	}
+}
+
+// Return the recovered keys, keys found by known plaintext first followed by those found in the most windows.
+// Expected to be called once the whole file has been appended.
+func (s *Scanner) Candidates() []Candidate {
+	result := []Candidate{}
+	for _, key := range s.foundKeys {
+		result = append(result, *s.found[key])
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if (result[i].Magic != "") != (result[j].Magic != "") {
+			return result[i].Magic != ""
+		}
+		return result[i].Count > result[j].Count
+	})
+	if len(result) > s.options.MaxCandidates {
+		result = result[:max(s.options.MaxCandidates, 0)]
+	}
+	return result
+}
+
+// Search for known plaintext encoded with a single byte key.
+func (s *Scanner) searchSignatures(buf []byte) {
+	if len(buf) == 0 {
+		return
+	}
+	// Offset of the first byte in the joined tail and buffer.
+	start := s.offset - uint64(len(s.tail))
+	joined := append(s.tail, buf...)
+	s.diffs = adjacentDiffs(s.diffs[:0], joined)
+	for _, sig := range signatures {
+		searchFrom := 0
+		for {
+			idx := bytes.Index(s.diffs[searchFrom:], sig.diffs)
+			if idx < 0 {
+				break
+			}
+			idx += searchFrom
+			searchFrom = idx + 1
+			// Matches entirely within the tail were found by the previous append.
+			if idx+len(sig.plaintext) <= len(s.tail) {
+				continue
+			}
+			key := joined[idx] ^ sig.plaintext[0]
+			matchOffset := start + uint64(idx)
+			// Unencoded plaintext or a match too close to the start for the format to fit.
+			if key == 0 || matchOffset < sig.offset {
+				continue
+			}
+			s.addCandidate(Candidate{Offset: matchOffset - sig.offset, Key: []byte{key}, Magic: sig.magic})
+		}
+	}
+	keep := min(len(joined), maxSignatureLength-1)
+	s.tail = append(s.tail[:0], joined[len(joined)-keep:]...)
+}
+
+// Estimate the repeating key for a window and keep it if decoding lowers the entropy of the window.
+func (s *Scanner) checkWindow(windowOffset uint64) {
+	if s.windowsChecked >= s.options.MaxWindows {
+		return
+	}
+	windowEntropy := entropy.New(s.window).Value()
+	if windowEntropy < s.options.MinEntropy || windowEntropy > s.options.MaxEntropy {
+		return
+	}
+	s.windowsChecked += 1
+
+	keyLength := EstimateKeyLength(s.window, s.options.MaxKeyLength)
+	key := DeriveKey(s.window, keyLength)
+	// Decoding with a single byte key can't change the entropy of the window, there is no evidence for it here.
+	if len(key) < 2 || isZero(key) {
+		return
+	}
+	decoded := Decode(s.window, key)
+	decodedEntropy := entropy.New(decoded).Value()
+	if windowEntropy-decodedEntropy < s.options.MinEntropyDrop {
+		return
+	}
+	// Rotate the key so it is aligned to the start of the file rather than the window.
+	aligned := make([]byte, len(key))
+	for i := range key {
+		aligned[(windowOffset+uint64(i))%uint64(len(key))] = key[i]
+	}
+	s.addCandidate(Candidate{
+		Offset:         windowOffset,
+		Key:            aligned,
+		Entropy:        windowEntropy,
+		DecodedEntropy: decodedEntropy,
+	})
+}
+
+// Keep a candidate key, counting repeat occurrences of the same key.
+func (s *Scanner) addCandidate(candidate Candidate) {
+	id := candidate.Magic + ":" + string(candidate.Key)
+	if existing, ok := s.found[id]; ok {
+		existing.Count += 1
+		return
+	}
+	candidate.Count = 1
+	s.found[id] = &candidate
+	s.foundKeys = append(s.foundKeys, id)
+}
+
+// Estimate the length of a repeating XOR key from the index of coincidence of the columns each key byte encodes.
+// The true key length (and its multiples) keeps the coincidence of the plaintext, other lengths mix columns
+// encoded with different key bytes and lower it. The shortest length close to the best is chosen.
+func EstimateKeyLength(buf []byte, maxKeyLength int) int {
+	if maxKeyLength < 1 || len(buf) < 2 {
+		return 1
+	}
+	coincidence := make([]float64, maxKeyLength+1)
+	best := 0.0
+	for length := 1; length <= maxKeyLength; length++ {
+		coincidence[length] = indexOfCoincidence(buf, length)
+		best = max(best, coincidence[length])
+	}
+	for length := 1; length <= maxKeyLength; length++ {
+		if coincidence[length] >= 0.9*best {
+			return length
+		}
+	}
+	return 1
+}
+
+// Average index of coincidence over the columns of buf taken every length bytes.
+func indexOfCoincidence(buf []byte, length int) float64 {
+	total := 0.0
+	for column := 0; column < length; column++ {
+		var counts [256]int
+		n := 0
+		for i := column; i < len(buf); i += length {
+			counts[buf[i]]++
+			n++
+		}
+		if n < 2 {
+			continue
+		}
+		same := 0
+		for _, c := range counts {
+			same += c * (c - 1)
+		}
+		total += float64(same) / float64(n*(n-1))
+	}
+	return total / float64(length)
+}
+
+// Derive a key of the given length assuming the most common plaintext byte in each column is null,
+// the key is reduced to its shortest repeating period.
+func DeriveKey(buf []byte, length int) []byte {
+	key := make([]byte, length)
+	for column := 0; column < length; column++ {
+		var counts [256]int
+		for i := column; i < len(buf); i += length {
+			counts[buf[i]]++
+		}
+		mostCommon := 0
+		for b := 1; b < 256; b++ {
+			if counts[b] > counts[mostCommon] {
+				mostCommon = b
+			}
+		}
+		key[column] = byte(mostCommon)
+	}
+	return shortestPeriod(key)
+}
+
+// Decode buf with a repeating key starting at the beginning of the key.
+func Decode(buf []byte, key []byte) []byte {
+	decoded := make([]byte, len(buf))
+	for i, b := range buf {
+		decoded[i] = b ^ key[i%len(key)]
+	}
+	return decoded
+}
+
+// Reduce a key to the shortest key that repeats to produce it.
+func shortestPeriod(key []byte) []byte {
+	for period := 1; period < len(key); period++ {
+		if len(key)%period != 0 {
+			continue
+		}
+		repeats := true
+		for i := period; i < len(key); i++ {
+			if key[i] != key[i%period] {
+				repeats = false
+				break
+			}
+		}
+		if repeats {
+			return key[:period]
+		}
+	}
+	return key
+}
+
+func isZero(key []byte) bool {
+	for _, b := range key {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// XOR of each byte with the byte following it.
+func adjacentDiffs(dst []byte, buf []byte) []byte {
+	for i := 1; i < len(buf); i++ {
+		dst = append(dst, buf[i-1]^buf[i])
+	}
+	return dst
+}
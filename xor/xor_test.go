@@ -0,0 +1,177 @@
+package xor
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/AustralianCyberSecurityCentre/azul-entropy.git/entropy"
+)
+
+// Deterministic bytes with the structure of an executable, mostly nulls with some small values.
+func structuredBytes(length int) []byte {
+	buf := make([]byte, length)
+	r := rand.New(rand.NewSource(1))
+	for i := range buf {
+		if r.Intn(3) == 0 {
+			buf[i] = byte(r.Intn(16))
+		}
+	}
+	return buf
+}
+
+func randomBytes(length int) []byte {
+	buf := make([]byte, length)
+	rand.New(rand.NewSource(2)).Read(buf)
+	return buf
+}
+
+func defaultOptions() Options {
+	return Options{
+		WindowSize:     4096,
+		MinEntropy:     1,
+		MaxEntropy:     7,
+		MaxWindows:     32,
+		MaxKeyLength:   32,
+		MinEntropyDrop: 0.5,
+		MaxCandidates:  10,
+	}
+}
+
+func TestEstimateKeyLengthAndDeriveKey(t *testing.T) {
+	plain := structuredBytes(8192)
+	tables := []struct {
+		key []byte
+	}{
+		{[]byte{0x5a}},
+		{[]byte("key")},
+		{[]byte("secret")},
+		{[]byte("0123456789abcdef")},
+	}
+	for _, table := range tables {
+		encoded := Decode(plain, table.key)
+		length := EstimateKeyLength(encoded, 32)
+		if length != len(table.key) {
+			t.Errorf("Unexpected Key Length for: %q, got: %v", table.key, length)
+		}
+		key := DeriveKey(encoded, length)
+		if !bytes.Equal(key, table.key) {
+			t.Errorf("Unexpected Key for: %q, got: %q", table.key, key)
+		}
+	}
+}
+
+func TestShortestPeriod(t *testing.T) {
+	tables := []struct {
+		input  []byte
+		output []byte
+	}{
+		{[]byte("abab"), []byte("ab")},
+		{[]byte("aaaa"), []byte("a")},
+		{[]byte("abcab"), []byte("abcab")},
+		{[]byte("key"), []byte("key")},
+	}
+	for _, table := range tables {
+		output := shortestPeriod(table.input)
+		if !bytes.Equal(output, table.output) {
+			t.Errorf("Unexpected Period for: %q, got: %q", table.input, output)
+		}
+	}
+}
+
+func TestScannerRepeatingKey(t *testing.T) {
+	key := []byte("secret")
+	// Encoded region starts part way into the key so the key must be realigned to the file.
+	prefix := randomBytes(4096)
+	encoded := Decode(structuredBytes(16384), []byte("etsecr"))
+	input := append(prefix, encoded...)
+
+	for _, sliceSize := range []int{1000, 4096, len(input)} {
+		scanner := NewScanner(defaultOptions())
+		for i := 0; i < len(input); i += sliceSize {
+			scanner.Append(input[i:min(i+sliceSize, len(input))])
+		}
+		candidates := scanner.Candidates()
+		if len(candidates) != 1 {
+			t.Fatalf("SliceSize %d - Expected one candidate, got: %v", sliceSize, candidates)
+		}
+		if !bytes.Equal(candidates[0].Key, key) || candidates[0].Offset != 4096 || candidates[0].Count != 4 || candidates[0].Magic != "" {
+			t.Errorf("SliceSize %d - Unexpected Candidate, got: %v", sliceSize, candidates[0])
+		}
+		if candidates[0].Entropy-candidates[0].DecodedEntropy < 0.5 {
+			t.Errorf("SliceSize %d - Expected entropy to drop, got: %v", sliceSize, candidates[0])
+		}
+	}
+}
+
+func TestScannerSignatures(t *testing.T) {
+	pe := make([]byte, 512)
+	copy(pe, "MZ")
+	copy(pe[0x4e:], "This program cannot be run in DOS mode")
+	elf := []byte("\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+
+	input := randomBytes(1000)
+	input = append(input, Decode(pe, []byte{0x5a})...)
+	input = append(input, randomBytes(100)...)
+	input = append(input, Decode(elf, []byte{0x13})...)
+	// Unencoded formats aren't reported.
+	input = append(input, pe...)
+	input = append(input, elf...)
+
+	expected := []Candidate{
+		{Offset: 1000, Key: []byte{0x5a}, Magic: "pe", Count: 1},
+		{Offset: 1612, Key: []byte{0x13}, Magic: "elf", Count: 1},
+	}
+	// Results must not depend on how the bytes are split across appends.
+	for sliceSize := 1; sliceSize <= 64; sliceSize++ {
+		options := defaultOptions()
+		options.MaxWindows = 0
+		scanner := NewScanner(options)
+		for i := 0; i < len(input); i += sliceSize {
+			scanner.Append(input[i:min(i+sliceSize, len(input))])
+		}
+		candidates := scanner.Candidates()
+		if !reflect.DeepEqual(candidates, expected) {
+			t.Errorf("SliceSize %d - Unexpected Candidates expected: %v, got: %v", sliceSize, expected, candidates)
+		}
+	}
+}
+
+func TestScannerSingleByteWindows(t *testing.T) {
+	// Single byte encoding keeps the entropy of each window, so only the known plaintext finds the key.
+	pe := make([]byte, 512)
+	copy(pe, "MZ")
+	copy(pe[0x4e:], "This program cannot be run in DOS mode")
+	input := append(pe, structuredBytes(16384)...)
+	encoded := Decode(input, []byte{0x5a})
+	if math.Abs(entropy.New(encoded).Value()-entropy.New(input).Value()) > 1e-9 {
+		t.Fatalf("Expected single byte encoding to keep the entropy")
+	}
+
+	options := defaultOptions()
+	options.MinEntropyDrop = 0
+	scanner := NewScanner(options)
+	scanner.Append(encoded)
+	expected := []Candidate{{Offset: 0, Key: []byte{0x5a}, Magic: "pe", Count: 1}}
+	if candidates := scanner.Candidates(); !reflect.DeepEqual(candidates, expected) {
+		t.Errorf("Unexpected Candidates expected: %v, got: %v", expected, candidates)
+	}
+
+	scanner = NewScanner(options)
+	scanner.Append(Decode(structuredBytes(16384), []byte{0x5a}))
+	if candidates := scanner.Candidates(); len(candidates) != 0 {
+		t.Errorf("Expected no candidates without known plaintext, got: %v", candidates)
+	}
+}
+
+func TestScannerIgnoresPlainAndRandom(t *testing.T) {
+	scanner := NewScanner(defaultOptions())
+	scanner.Append(structuredBytes(16384))
+	scanner.Append(randomBytes(16384))
+	candidates := scanner.Candidates()
+	if len(candidates) != 0 {
+		t.Errorf("Expected no candidates, got: %v", candidates)
+	}
+}